@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/reminder"
+	"github.com/adamkpickering/reminder-boi/state"
+)
+
+// Reads and parses the reminders config at reminders_path, which may be a
+// single file or a directory of them. Configs may be JSON, YAML or TOML;
+// the format is picked by file extension. Reminders of every version are
+// upgraded to v2.
+func load_reminders(reminders_path string) ([]reminder.ReminderV2, error) {
+	config, err := load_config(reminders_path)
+	if err != nil {
+		return nil, err
+	}
+	return config.Reminders, nil
+}
+
+// Like load_reminders, but also returns the recipients' delivery settings.
+func load_config(reminders_path string) (*reminder.Config, error) {
+	config, err := reminder.LoadConfig(reminders_path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load config file: %w", err)
+	}
+	return config, nil
+}
+
+// Splits a comma-separated list of tags, as given to the -tags flag.
+func parse_tags(value string) []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Returns the reminders that this process should serve: those that are
+// enabled and have at least one of tags. If tags is empty, every enabled
+// reminder is served.
+func select_reminders(reminder_list []reminder.ReminderV2, tags []string) []reminder.ReminderV2 {
+	selected := make([]reminder.ReminderV2, 0, len(reminder_list))
+	for _, r := range reminder_list {
+		if !r.Enabled {
+			logger.Info("skipping reminder", "reminder_id", r.ID, "reason", "it is disabled")
+			continue
+		}
+		if !r.HasAnyTag(tags) {
+			logger.Info("skipping reminder", "reminder_id", r.ID, "reason", "it has none of the tags",
+				"tags", tags)
+			continue
+		}
+		selected = append(selected, r)
+	}
+	return selected
+}
+
+// Logs a warning for each reminder whose ID was made from its contents but
+// that keeps state by its ID, since editing the reminder changes its ID and
+// loses that state.
+func warn_generated_ids(reminder_list []reminder.ReminderV2) {
+	for _, r := range reminder_list {
+		if r.GeneratedID && r.UsesID() {
+			logger.Warn("reminder has no id", "reminder_id", r.ID, "source", r.Source,
+				"reason", "its send count or window times are lost when it is edited")
+		}
+	}
+}
+
+// Returns the reminders that have not expired, logging a warning for each one
+// that has, since an expired reminder in the config is probably a mistake or
+// something that can be cleaned up.
+func drop_expired(reminder_list []reminder.ReminderV2, st *state.State, now time.Time) []reminder.ReminderV2 {
+	live := make([]reminder.ReminderV2, 0, len(reminder_list))
+	for _, r := range reminder_list {
+		if expired, reason := r.Expired(now, st.Count(r.ID)); expired {
+			logger.Warn("reminder has expired", "reminder_id", r.ID, "source", r.Source, "reason", reason)
+			continue
+		}
+		live = append(live, r)
+	}
+	return live
+}
@@ -0,0 +1,251 @@
+// Package delivery sends messages to their recipients. Every message that
+// text-me-when sends goes through a Deliverer, which applies each recipient's
+// delivery settings, such as quiet hours, and the limits on how many messages
+// are sent, so that they are respected whatever caused the message to be sent.
+package delivery
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/reminder"
+	"github.com/adamkpickering/reminder-boi/state"
+)
+
+// A Sender sends a message to a single recipient, with attributes that say
+// how it is sent, such as AWS SNS's "AWS.SNS.SMS.SMSType". attributes may be
+// nil. It returns the ID that the provider gave the message, if any.
+type Sender interface {
+	Send(body string, recipient string, attributes map[string]string) (string, error)
+}
+
+// A Message is a message that a reminder sends to a single recipient. If the
+// Body was split into numbered SMS messages, they are its Parts, and they are
+// sent instead of it. Attributes are passed on to the Sender. FireTime is when
+// the reminder fired, which is earlier than when the Message is sent if it was
+// deferred. HistoryID is the ID of the Message's record in the history, if it
+// has one, and is kept when the Message is deferred.
+type Message struct {
+	ReminderID string
+	Recipient  string
+	Body       string
+	Parts      []string
+	Attributes map[string]string
+	Urgent     bool
+	FireTime   time.Time
+	HistoryID  string
+}
+
+// Returns the texts that are sent for m: its Parts, or else its Body.
+func (m Message) texts() []string {
+	if len(m.Parts) > 0 {
+		return m.Parts
+	}
+	return []string{m.Body}
+}
+
+// A deferred message whose send fails is deferred again for RetryDelay, which
+// doubles with each failure, until it has failed MaxAttempts times.
+const (
+	RetryDelay  = time.Minute
+	MaxAttempts = 5
+)
+
+// An Outcome is what happened to a Message that was given to a Deliverer.
+type Outcome int
+
+const (
+	// Sent means that the Message was sent.
+	Sent Outcome = iota
+	// Dropped means that the Message was thrown away without being sent.
+	Dropped
+	// Deferred means that the Message will be sent later.
+	Deferred
+	// Failed means that sending the Message failed.
+	Failed
+	// Summarized means that the Message was not sent because the budget ran
+	// out, but will be counted in a summary that is sent once there is budget
+	// again.
+	Summarized
+)
+
+// Returns the name of the Outcome, for example "deferred".
+func (o Outcome) String() string {
+	switch o {
+	case Sent:
+		return "sent"
+	case Dropped:
+		return "dropped"
+	case Deferred:
+		return "deferred"
+	case Failed:
+		return "failed"
+	case Summarized:
+		return "summarized"
+	default:
+		return fmt.Sprintf("Outcome(%d)", int(o))
+	}
+}
+
+// A Result says what happened to a Message. Reason explains an Outcome other
+// than Sent, for example "quiet hours until 07:00 PST". Alert is set when the
+// Message is the first one in a budget period that could not be sent because
+// the budget ran out, and says so. MessageIDs are the IDs that the provider
+// gave the texts that were sent, one for each part. Attempts is the number of
+// times that a deferred Message had already failed to be sent.
+type Result struct {
+	Message    Message
+	Outcome    Outcome
+	Reason     string
+	Alert      string
+	MessageIDs []string
+	Attempts   int
+}
+
+// A Deliverer sends Messages through a Sender, applying the delivery settings
+// of their recipients and the Limits. Deferred messages, the number of
+// messages sent against the budget, and the messages held back for summaries
+// are kept in the State, so they survive restarts. Rate limits start afresh
+// when the Deliverer is created.
+type Deliverer struct {
+	sender     Sender
+	recipients map[string]*reminder.Recipient
+	limits     *reminder.Limits
+	st         *state.State
+	global     *tokenBucket
+	buckets    map[string]*tokenBucket
+	alerted    map[string]bool
+}
+
+// Returns a Deliverer that sends through sender, with the delivery settings in
+// recipients (keyed by phone number) and limits, either of which may be nil,
+// and that keeps its state in st.
+func New(sender Sender, recipients map[string]*reminder.Recipient, limits *reminder.Limits,
+	st *state.State) *Deliverer {
+	if recipients == nil {
+		recipients = map[string]*reminder.Recipient{}
+	}
+	d := &Deliverer{
+		sender:     sender,
+		recipients: recipients,
+		limits:     limits,
+		st:         st,
+		buckets:    map[string]*tokenBucket{},
+		alerted:    map[string]bool{},
+	}
+	if limits != nil && limits.Rate != nil {
+		d.global = newTokenBucket(limits.Rate)
+	}
+	return d
+}
+
+// Delivers message at now. If now is during the recipient's quiet hours and
+// the message is not urgent, it is dropped or deferred until they end,
+// depending on the recipient's quiet action. Otherwise, it is dropped if it
+// would go over the recipient's or the global rate limit, and dropped or
+// summarized if the budget has run out. A message with Parts counts once
+// against the rate limits and once for each part against the budget.
+func (d *Deliverer) Deliver(message Message, now time.Time) Result {
+	recipient, ok := d.recipients[message.Recipient]
+	if ok && !message.Urgent {
+		if until, quiet := recipient.QuietUntil(now); quiet {
+			reason := "quiet hours until " + until.In(recipient.Location).Format("2006-01-02 15:04 MST")
+			if recipient.QuietAction == reminder.QuietDrop {
+				return Result{Message: message, Outcome: Dropped, Reason: reason}
+			}
+			deferred := state.DeferredMessage{
+				ReminderID: message.ReminderID,
+				Recipient:  message.Recipient,
+				Body:       message.Body,
+				Parts:      message.Parts,
+				Attributes: message.Attributes,
+				FireTime:   message.FireTime,
+				Until:      until,
+				HistoryID:  message.HistoryID,
+			}
+			if err := d.st.Defer(deferred); err != nil {
+				return Result{Message: message, Outcome: Failed, Reason: fmt.Sprintf("failed to defer: %s", err)}
+			}
+			return Result{Message: message, Outcome: Deferred, Reason: reason}
+		}
+	}
+	texts := message.texts()
+	if ok, reason := d.checkBudget(now, len(texts)); !ok {
+		return d.overBudget(message, reason)
+	}
+	if reason := d.checkRate(message.Recipient, now); reason != "" {
+		return Result{Message: message, Outcome: Dropped, Reason: reason}
+	}
+	message_ids := make([]string, 0, len(texts))
+	for i, text := range texts {
+		message_id, err := d.sender.Send(text, message.Recipient, message.Attributes)
+		if err != nil {
+			reason := err.Error()
+			if len(texts) > 1 {
+				reason = fmt.Sprintf("failed to send part %d of %d: %s", i+1, len(texts), err)
+			}
+			if i > 0 {
+				// the parts that were sent still cost money
+				if err := d.st.RecordSpend(now.In(time.Local), i); err != nil {
+					reason = fmt.Sprintf("%s; failed to record spend: %s", reason, err)
+				}
+			}
+			return Result{Message: message, Outcome: Failed, Reason: reason, MessageIDs: message_ids}
+		}
+		if message_id != "" {
+			message_ids = append(message_ids, message_id)
+		}
+	}
+	if err := d.st.RecordSpend(now.In(time.Local), len(texts)); err != nil {
+		return Result{Message: message, Outcome: Sent, Reason: fmt.Sprintf("failed to record spend: %s", err),
+			MessageIDs: message_ids}
+	}
+	return Result{Message: message, Outcome: Sent, MessageIDs: message_ids}
+}
+
+// Delivers the deferred messages whose quiet hours have ended by now. If the
+// recipient's settings have changed so that now is during quiet hours again,
+// a message is dropped or deferred again. A message whose send fails is
+// deferred again, to be retried after a delay, unless it has failed
+// MaxAttempts times. Then, if there is budget, sends the summaries of
+// messages that were held back because the budget ran out.
+func (d *Deliverer) Flush(now time.Time) ([]Result, error) {
+	due, err := d.st.TakeDue(now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take deferred messages: %w", err)
+	}
+	results := make([]Result, 0, len(due))
+	for _, deferred := range due {
+		message := Message{
+			ReminderID: deferred.ReminderID,
+			Recipient:  deferred.Recipient,
+			Body:       deferred.Body,
+			Parts:      deferred.Parts,
+			Attributes: deferred.Attributes,
+			FireTime:   deferred.FireTime,
+			HistoryID:  deferred.HistoryID,
+		}
+		result := d.Deliver(message, now)
+		result.Attempts = deferred.Attempts
+		if result.Outcome == Failed {
+			result.Reason = result.Reason + "; " + d.retry(deferred, now)
+		}
+		results = append(results, result)
+	}
+	results = append(results, d.sendSummaries(now)...)
+	return results, nil
+}
+
+// Defers message again after its send failed at now, unless it has failed
+// MaxAttempts times, and returns what was done, for the Result's Reason.
+func (d *Deliverer) retry(message state.DeferredMessage, now time.Time) string {
+	message.Attempts = message.Attempts + 1
+	if message.Attempts >= MaxAttempts {
+		return fmt.Sprintf("giving up after %d attempts", message.Attempts)
+	}
+	message.Until = now.Add(RetryDelay << uint(message.Attempts-1))
+	if err := d.st.Defer(message); err != nil {
+		return fmt.Sprintf("failed to defer for a retry: %s", err)
+	}
+	return "retrying at " + message.Until.In(time.Local).Format("2006-01-02 15:04 MST")
+}
@@ -0,0 +1,254 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/reminder"
+	"github.com/adamkpickering/reminder-boi/state"
+)
+
+// fakeSender records the messages that it is asked to send, and the
+// attributes of the last one. Messages to recipients in fail are not sent and
+// return an error.
+type fakeSender struct {
+	sent       []string
+	attributes map[string]string
+	fail       map[string]bool
+}
+
+func (s *fakeSender) Send(body string, recipient string, attributes map[string]string) (string, error) {
+	if s.fail[recipient] {
+		return "", errors.New("send failed")
+	}
+	s.sent = append(s.sent, recipient+": "+body)
+	s.attributes = attributes
+	return fmt.Sprintf("message-%d", len(s.sent)), nil
+}
+
+// Returns a Deliverer with a fresh State, a fakeSender, and the recipients in
+// config, along with the path of the state file. The caller must remove the
+// directory that the state file is in.
+func newTestDeliverer(t *testing.T, config string) (*Deliverer, *fakeSender, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "text-me-when-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	config_path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(config_path, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+	loaded, err := reminder.LoadConfig(config_path)
+	if err != nil {
+		t.Fatalf("got unexpected error loading config: %s", err)
+	}
+	state_path := filepath.Join(dir, "state.json")
+	st, err := state.Load(state_path)
+	if err != nil {
+		t.Fatalf("got unexpected error loading state: %s", err)
+	}
+	sender := &fakeSender{fail: map[string]bool{}}
+	return New(sender, loaded.Recipients, loaded.Limits, st), sender, state_path
+}
+
+const testRecipients = `{"recipients": {
+	"+15555550001": {"timezone": "UTC", "quiet_hours": [{"from": "22:00", "to": "07:00"}]},
+	"+15555550002": {"timezone": "UTC", "quiet_hours": [{"from": "22:00", "to": "07:00"}], "quiet_action": "drop"}
+}}`
+
+func TestDeliverQuietHours(t *testing.T) {
+	d, sender, state_path := newTestDeliverer(t, testRecipients)
+	defer os.RemoveAll(filepath.Dir(state_path))
+	night := time.Date(2021, time.March, 3, 23, 0, 0, 0, time.UTC)
+	test_cases := []struct {
+		message Message
+		outcome Outcome
+	}{
+		{Message{ReminderID: "a", Recipient: "+15555550001", Body: "deferred"}, Deferred},
+		{Message{ReminderID: "a", Recipient: "+15555550002", Body: "dropped"}, Dropped},
+		{Message{ReminderID: "a", Recipient: "+15555550001", Body: "urgent", Urgent: true}, Sent},
+		{Message{ReminderID: "a", Recipient: "+15555550002", Body: "urgent", Urgent: true}, Sent},
+		{Message{ReminderID: "a", Recipient: "+15555550003", Body: "no settings"}, Sent},
+	}
+	for _, test_case := range test_cases {
+		result := d.Deliver(test_case.message, night)
+		if result.Outcome != test_case.outcome {
+			t.Errorf("message %v was %s (%s expected): %s", test_case.message, result.Outcome,
+				test_case.outcome, result.Reason)
+		}
+	}
+	if len(sender.sent) != 3 {
+		t.Errorf("got sent messages %v (3 expected)", sender.sent)
+	}
+
+	day := time.Date(2021, time.March, 4, 12, 0, 0, 0, time.UTC)
+	for _, recipient := range []string{"+15555550001", "+15555550002"} {
+		result := d.Deliver(Message{ReminderID: "a", Recipient: recipient, Body: "day"}, day)
+		if result.Outcome != Sent {
+			t.Errorf("message to %s during the day was %s", recipient, result.Outcome)
+		}
+	}
+
+	sender.fail["+15555550003"] = true
+	result := d.Deliver(Message{ReminderID: "a", Recipient: "+15555550003", Body: "fails"}, day)
+	if result.Outcome != Failed || result.Reason != "send failed" {
+		t.Errorf("failed send gave %s: %s", result.Outcome, result.Reason)
+	}
+}
+
+func TestFlushDeferred(t *testing.T) {
+	d, sender, state_path := newTestDeliverer(t, testRecipients)
+	defer os.RemoveAll(filepath.Dir(state_path))
+	start := time.Date(2021, time.March, 3, 22, 0, 0, 0, time.UTC)
+	// a reminder that fires every 5 minutes all night is only sent once
+	for minutes := 0; minutes < 9*60; minutes += 5 {
+		body := "at " + start.Add(time.Duration(minutes)*time.Minute).Format("15:04")
+		d.Deliver(Message{ReminderID: "every-5", Recipient: "+15555550001", Body: body},
+			start.Add(time.Duration(minutes)*time.Minute))
+	}
+	d.Deliver(Message{ReminderID: "other", Recipient: "+15555550001", Body: "other"}, start)
+
+	results, err := d.Flush(time.Date(2021, time.March, 4, 6, 59, 0, 0, time.UTC))
+	if err != nil || len(results) != 0 || len(sender.sent) != 0 {
+		t.Errorf("got results %v and error %v before the quiet hours ended", results, err)
+	}
+
+	// deferred messages survive a restart
+	st, err := state.Load(state_path)
+	if err != nil {
+		t.Fatalf("got unexpected error reloading state: %s", err)
+	}
+	if len(st.Deferred) != 2 {
+		t.Errorf("got %d deferred messages after reload (2 expected)", len(st.Deferred))
+	}
+
+	results, err = d.Flush(time.Date(2021, time.March, 4, 7, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	expected := []string{"+15555550001: at 06:55", "+15555550001: other"}
+	if len(results) != 2 || len(sender.sent) != 2 || sender.sent[0] != expected[0] || sender.sent[1] != expected[1] {
+		t.Errorf("got results %v and sent %v (%v expected)", results, sender.sent, expected)
+	}
+	for _, result := range results {
+		if result.Attempts != 0 {
+			t.Errorf("got %d attempts for a message that was only held for quiet hours", result.Attempts)
+		}
+	}
+	results, _ = d.Flush(time.Date(2021, time.March, 4, 7, 1, 0, 0, time.UTC))
+	if len(results) != 0 {
+		t.Errorf("messages were flushed twice: %v", results)
+	}
+}
+
+func TestFlushFailedSend(t *testing.T) {
+	d, sender, state_path := newTestDeliverer(t, testRecipients)
+	defer os.RemoveAll(filepath.Dir(state_path))
+	night := time.Date(2021, time.March, 3, 23, 0, 0, 0, time.UTC)
+	d.Deliver(Message{ReminderID: "a", Recipient: "+15555550001", Body: "retried"}, night)
+
+	// a message whose send fails is deferred again, with a growing delay, and
+	// survives a restart
+	sender.fail["+15555550001"] = true
+	morning := time.Date(2021, time.March, 4, 7, 0, 0, 0, time.UTC)
+	results, err := d.Flush(morning)
+	if err != nil || len(results) != 1 || results[0].Outcome != Failed {
+		t.Fatalf("got results %v and error %v", results, err)
+	}
+	st, err := state.Load(state_path)
+	if err != nil {
+		t.Fatalf("got unexpected error reloading state: %s", err)
+	}
+	if len(st.Deferred) != 1 || !st.Deferred[0].Until.Equal(morning.Add(RetryDelay)) || st.Deferred[0].Attempts != 1 {
+		t.Fatalf("got deferred messages %v after a failed send", st.Deferred)
+	}
+	if results, _ := d.Flush(morning.Add(RetryDelay - time.Second)); len(results) != 0 {
+		t.Errorf("message was retried too soon: %v", results)
+	}
+	results, _ = d.Flush(morning.Add(RetryDelay))
+	if len(results) != 1 || results[0].Outcome != Failed || len(d.st.Deferred) != 1 ||
+		!d.st.Deferred[0].Until.Equal(morning.Add(3*RetryDelay)) {
+		t.Fatalf("got results %v and deferred messages %v after a second failure", results, d.st.Deferred)
+	}
+
+	sender.fail["+15555550001"] = false
+	results, _ = d.Flush(morning.Add(3 * RetryDelay))
+	if len(results) != 1 || results[0].Outcome != Sent || results[0].Attempts != 2 || len(sender.sent) != 1 ||
+		len(d.st.Deferred) != 0 {
+		t.Errorf("got results %v, sent %v and deferred %v after the retry", results, sender.sent, d.st.Deferred)
+	}
+
+	// after MaxAttempts failures, the message is given up on
+	d.Deliver(Message{ReminderID: "b", Recipient: "+15555550001", Body: "given up"}, night.Add(24*time.Hour))
+	sender.fail["+15555550001"] = true
+	now := morning.Add(24 * time.Hour)
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		results, _ = d.Flush(now)
+		if len(results) != 1 || results[0].Outcome != Failed {
+			t.Fatalf("got results %v on attempt %d", results, attempt)
+		}
+		now = now.Add(time.Hour)
+	}
+	if len(d.st.Deferred) != 0 || !strings.HasSuffix(results[0].Reason, "giving up after 5 attempts") {
+		t.Errorf("got reason \"%s\" and deferred messages %v", results[0].Reason, d.st.Deferred)
+	}
+}
+
+func TestDeliverParts(t *testing.T) {
+	d, sender, state_path := newTestDeliverer(t, `{
+		"limits": {"daily_budget": 3},
+		"recipients": {"+15555550001": {"timezone": "UTC", "quiet_hours": [{"from": "22:00", "to": "07:00"}]}}
+	}`)
+	defer os.RemoveAll(filepath.Dir(state_path))
+	night := time.Date(2021, time.March, 3, 23, 0, 0, 0, time.UTC)
+	message := Message{
+		ReminderID: "a",
+		Recipient:  "+15555550001",
+		Body:       "one two",
+		Parts:      []string{"(1/2) one", "(2/2) two"},
+		Attributes: map[string]string{"AWS.SNS.SMS.SMSType": "Transactional"},
+		FireTime:   night,
+		HistoryID:  "9f86d081884c7d65",
+	}
+
+	// the parts are deferred together, with their attributes, fire time and
+	// history ID, and sent together
+	if result := d.Deliver(message, night); result.Outcome != Deferred {
+		t.Errorf("message was %s (deferred expected)", result.Outcome)
+	}
+	results, err := d.Flush(night.Add(8 * time.Hour))
+	if err != nil || len(results) != 1 || results[0].Outcome != Sent {
+		t.Fatalf("got results %v and error %v", results, err)
+	}
+	expected := []string{"+15555550001: (1/2) one", "+15555550001: (2/2) two"}
+	if len(sender.sent) != 2 || sender.sent[0] != expected[0] || sender.sent[1] != expected[1] {
+		t.Errorf("got sent messages %v (%v expected)", sender.sent, expected)
+	}
+	if sender.attributes["AWS.SNS.SMS.SMSType"] != "Transactional" {
+		t.Errorf("got attributes %v", sender.attributes)
+	}
+	ids := results[0].MessageIDs
+	if len(ids) != 2 || ids[0] != "message-1" || ids[1] != "message-2" || !results[0].Message.FireTime.Equal(night) {
+		t.Errorf("got message IDs %v and fire time %s", ids, results[0].Message.FireTime)
+	}
+	if results[0].Message.HistoryID != message.HistoryID {
+		t.Errorf("got history ID \"%s\" (\"%s\" expected)", results[0].Message.HistoryID, message.HistoryID)
+	}
+
+	// each part counts against the budget, so there is only room for one more
+	// message today
+	morning := night.Add(9 * time.Hour)
+	if result := d.Deliver(message, morning); result.Outcome != Dropped {
+		t.Errorf("message over budget was %s (dropped expected)", result.Outcome)
+	}
+	if outcome := deliverAt(d, "b", "+15555550001", morning); outcome != Sent {
+		t.Errorf("message within budget was %s (sent expected)", outcome)
+	}
+}
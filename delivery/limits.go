@@ -0,0 +1,172 @@
+package delivery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/reminder"
+)
+
+// SummaryID is the reminder ID of the summaries that are sent to recipients
+// whose messages were held back because the budget ran out.
+const SummaryID = "budget-summary"
+
+// A tokenBucket enforces a RateLimit. It starts full.
+type tokenBucket struct {
+	limit  *reminder.RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit *reminder.RateLimit) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst)}
+}
+
+// Adds the tokens that have accumulated since the bucket was last used.
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		per_token := b.limit.Period / time.Duration(b.limit.Count)
+		b.tokens = b.tokens + float64(now.Sub(b.last))/float64(per_token)
+		if b.tokens > float64(b.limit.Burst) {
+			b.tokens = float64(b.limit.Burst)
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
+
+// Tells the caller whether a message may be sent at now, without using up a
+// token.
+func (b *tokenBucket) allows(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= 1
+}
+
+// Uses up a token. The caller must have checked allows first.
+func (b *tokenBucket) take() {
+	b.tokens = b.tokens - 1
+}
+
+// Checks the global rate limit and the rate limit of recipient. If neither is
+// exceeded, a token is taken from each and "" is returned; otherwise the
+// reason the message can't be sent is returned.
+func (d *Deliverer) checkRate(recipient string, now time.Time) string {
+	buckets := make([]*tokenBucket, 0, 2)
+	if settings, ok := d.recipients[recipient]; ok && settings.Rate != nil {
+		bucket, ok := d.buckets[recipient]
+		if !ok {
+			bucket = newTokenBucket(settings.Rate)
+			d.buckets[recipient] = bucket
+		}
+		if !bucket.allows(now) {
+			return "recipient rate limit of " + settings.Rate.Describe() + " exceeded"
+		}
+		buckets = append(buckets, bucket)
+	}
+	if d.global != nil {
+		if !d.global.allows(now) {
+			return "global rate limit of " + d.global.limit.Describe() + " exceeded"
+		}
+		buckets = append(buckets, d.global)
+	}
+	for _, bucket := range buckets {
+		bucket.take()
+	}
+	return ""
+}
+
+// Tells the caller whether count messages may be sent at now without going
+// over the daily or monthly budget. If they may not, the returned string
+// explains which budget has run out.
+func (d *Deliverer) checkBudget(now time.Time, count int) (bool, string) {
+	if d.limits == nil {
+		return true, ""
+	}
+	local_now := now.In(time.Local)
+	day, month := d.st.Spent(local_now)
+	if d.limits.DailyBudget > 0 && day+count > d.limits.DailyBudget {
+		return false, fmt.Sprintf("daily budget of %d messages for %s is used up", d.limits.DailyBudget,
+			local_now.Format("2006-01-02"))
+	}
+	if d.limits.MonthlyBudget > 0 && month+count > d.limits.MonthlyBudget {
+		return false, fmt.Sprintf("monthly budget of %d messages for %s is used up", d.limits.MonthlyBudget,
+			local_now.Format("2006-01"))
+	}
+	return true, ""
+}
+
+// Handles a message that can't be sent because the budget has run out. The
+// first time that happens for each budget period, the Result carries an
+// alert.
+func (d *Deliverer) overBudget(message Message, reason string) Result {
+	result := Result{Message: message, Outcome: Dropped, Reason: reason}
+	if d.limits.BudgetAction == reminder.BudgetSummarize {
+		if err := d.st.Suppress(message.Recipient, message.ReminderID); err != nil {
+			result.Reason = fmt.Sprintf("%s, and failed to record it for the summary: %s", reason, err)
+		} else {
+			result.Outcome = Summarized
+		}
+	}
+	if !d.alerted[reason] {
+		d.alerted[reason] = true
+		result.Alert = fmt.Sprintf("%s; further messages are %s until there is budget again", reason,
+			result.Outcome)
+	}
+	return result
+}
+
+// Sends each recipient a summary of the messages that were held back from
+// them because the budget ran out, as long as there is budget for it now. If
+// a summary is not sent or deferred, its counts are kept for the next one.
+func (d *Deliverer) sendSummaries(now time.Time) []Result {
+	results := make([]Result, 0)
+	recipients := d.st.SuppressedRecipients()
+	sort.Strings(recipients)
+	for _, recipient := range recipients {
+		if ok, _ := d.checkBudget(now, 1); !ok {
+			break
+		}
+		counts, err := d.st.TakeSuppressed(recipient)
+		if err != nil {
+			message := Message{ReminderID: SummaryID, Recipient: recipient}
+			results = append(results, Result{Message: message, Outcome: Failed, Reason: err.Error()})
+			continue
+		}
+		message := Message{ReminderID: SummaryID, Recipient: recipient, Body: summarize(counts)}
+		result := d.Deliver(message, now)
+		if result.Outcome != Sent && result.Outcome != Deferred {
+			// keep the counts, so that the summary is tried again
+			if err := d.st.RestoreSuppressed(recipient, counts); err != nil {
+				result.Reason = fmt.Sprintf("%s, and failed to keep the counts for the summary: %s", result.Reason, err)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Returns the text of a summary of suppressed messages, for example
+// "text-me-when: 3 messages were not sent because the budget ran out:
+// standup (2), water-plants (1)".
+func summarize(counts map[string]int) string {
+	ids := make([]string, 0, len(counts))
+	total := 0
+	for id, count := range counts {
+		ids = append(ids, id)
+		total = total + count
+	}
+	sort.Strings(ids)
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, fmt.Sprintf("%s (%d)", id, counts[id]))
+	}
+	verb := "messages were"
+	if total == 1 {
+		verb = "message was"
+	}
+	return fmt.Sprintf("text-me-when: %d %s not sent because the budget ran out: %s", total, verb,
+		strings.Join(parts, ", "))
+}
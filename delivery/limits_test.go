@@ -0,0 +1,167 @@
+package delivery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/state"
+)
+
+// Delivers a message from reminder id to recipient at now and returns its
+// Outcome.
+func deliverAt(d *Deliverer, id string, recipient string, now time.Time) Outcome {
+	return d.Deliver(Message{ReminderID: id, Recipient: recipient, Body: id}, now).Outcome
+}
+
+func TestRateLimits(t *testing.T) {
+	d, sender, state_path := newTestDeliverer(t, `{
+		"limits": {"rate": "2/h"},
+		"recipients": {"+15555550001": {"rate": "1/h"}}
+	}`)
+	defer os.RemoveAll(filepath.Dir(state_path))
+	start := time.Date(2021, time.March, 3, 12, 0, 0, 0, time.Local)
+
+	test_cases := []struct {
+		recipient string
+		minutes   int
+		outcome   Outcome
+	}{
+		{"+15555550001", 0, Sent},
+		// over the recipient's own limit
+		{"+15555550001", 1, Dropped},
+		// a message dropped by the recipient's limit does not use up the
+		// global one
+		{"+15555550002", 1, Sent},
+		// over the global limit
+		{"+15555550002", 2, Dropped},
+		// the global limit allows one message every 30 minutes
+		{"+15555550002", 31, Sent},
+		{"+15555550001", 45, Dropped},
+		{"+15555550001", 61, Sent},
+	}
+	for _, test_case := range test_cases {
+		now := start.Add(time.Duration(test_case.minutes) * time.Minute)
+		if outcome := deliverAt(d, "a", test_case.recipient, now); outcome != test_case.outcome {
+			t.Errorf("message to %s after %d minutes was %s (%s expected)", test_case.recipient,
+				test_case.minutes, outcome, test_case.outcome)
+		}
+	}
+	if len(sender.sent) != 4 {
+		t.Errorf("got sent messages %v (4 expected)", sender.sent)
+	}
+
+	result := d.Deliver(Message{ReminderID: "a", Recipient: "+15555550002"}, start.Add(62*time.Minute))
+	if result.Reason != "global rate limit of at most 2 messages per hour exceeded" {
+		t.Errorf("got reason \"%s\"", result.Reason)
+	}
+}
+
+func TestDailyBudgetDrop(t *testing.T) {
+	d, sender, state_path := newTestDeliverer(t, `{"limits": {"daily_budget": 2}}`)
+	defer os.RemoveAll(filepath.Dir(state_path))
+	day := time.Date(2021, time.March, 3, 12, 0, 0, 0, time.Local)
+
+	alerts := 0
+	for i := 0; i < 5; i++ {
+		result := d.Deliver(Message{ReminderID: "a", Recipient: "+15555550001"}, day.Add(time.Duration(i)*time.Minute))
+		expected := Sent
+		if i >= 2 {
+			expected = Dropped
+		}
+		if result.Outcome != expected {
+			t.Errorf("message %d was %s (%s expected)", i, result.Outcome, expected)
+		}
+		if result.Alert != "" {
+			alerts = alerts + 1
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("got %d alerts (1 expected)", alerts)
+	}
+
+	// the budget is kept in the state file, so a restart does not reset it
+	st, err := state.Load(state_path)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	restarted := New(sender, nil, d.limits, st)
+	if outcome := deliverAt(restarted, "a", "+15555550001", day.Add(time.Hour)); outcome != Dropped {
+		t.Errorf("message after restart was %s (dropped expected)", outcome)
+	}
+	if outcome := deliverAt(restarted, "a", "+15555550001", day.AddDate(0, 0, 1)); outcome != Sent {
+		t.Errorf("message on the next day was %s (sent expected)", outcome)
+	}
+}
+
+func TestMonthlyBudgetSummarize(t *testing.T) {
+	d, sender, state_path := newTestDeliverer(t, `{"limits": {"monthly_budget": 1, "budget_action": "summarize"}}`)
+	defer os.RemoveAll(filepath.Dir(state_path))
+	day := time.Date(2021, time.March, 30, 12, 0, 0, 0, time.Local)
+
+	if outcome := deliverAt(d, "standup", "+15555550001", day); outcome != Sent {
+		t.Errorf("first message was %s", outcome)
+	}
+	for _, id := range []string{"standup", "standup", "pills"} {
+		if outcome := deliverAt(d, id, "+15555550001", day); outcome != Summarized {
+			t.Errorf("message over budget was %s (summarized expected)", outcome)
+		}
+	}
+	if outcome := deliverAt(d, "standup", "+15555550002", day); outcome != Summarized {
+		t.Errorf("message over budget was %s (summarized expected)", outcome)
+	}
+
+	// no summaries until the month is over
+	results, err := d.Flush(day.AddDate(0, 0, 1))
+	if err != nil || len(results) != 0 {
+		t.Errorf("got results %v and error %v before the budget renewed", results, err)
+	}
+	// one summary fits in April's budget; the other waits for May's
+	results, err = d.Flush(time.Date(2021, time.April, 1, 0, 0, 0, 0, time.Local))
+	if err != nil || len(results) != 1 || results[0].Outcome != Sent {
+		t.Fatalf("got results %v and error %v", results, err)
+	}
+	expected := "+15555550001: text-me-when: 3 messages were not sent because the budget ran out: " +
+		"pills (1), standup (2)"
+	if sender.sent[len(sender.sent)-1] != expected {
+		t.Errorf("got summary \"%s\" (\"%s\" expected)", sender.sent[len(sender.sent)-1], expected)
+	}
+	results, _ = d.Flush(time.Date(2021, time.May, 1, 0, 0, 0, 0, time.Local))
+	if len(results) != 1 || !strings.HasPrefix(sender.sent[len(sender.sent)-1], "+15555550002: text-me-when: 1 message was") {
+		t.Errorf("got results %v and sent %v", results, sender.sent)
+	}
+}
+
+func TestFailedSummaryKeepsCounts(t *testing.T) {
+	d, sender, state_path := newTestDeliverer(t, `{"limits": {"daily_budget": 1, "budget_action": "summarize"}}`)
+	defer os.RemoveAll(filepath.Dir(state_path))
+	day := time.Date(2021, time.March, 3, 12, 0, 0, 0, time.Local)
+	deliverAt(d, "standup", "+15555550001", day)
+	deliverAt(d, "standup", "+15555550001", day)
+	deliverAt(d, "pills", "+15555550001", day)
+
+	// a summary that fails to send is tried again with the same counts
+	sender.fail["+15555550001"] = true
+	next_day := day.AddDate(0, 0, 1)
+	results, err := d.Flush(next_day)
+	if err != nil || len(results) != 1 || results[0].Outcome != Failed {
+		t.Fatalf("got results %v and error %v", results, err)
+	}
+	st, err := state.Load(state_path)
+	if err != nil {
+		t.Fatalf("got unexpected error reloading state: %s", err)
+	}
+	if counts := st.Suppressed["+15555550001"]; counts["standup"] != 1 || counts["pills"] != 1 {
+		t.Errorf("got suppressed counts %v after the summary failed", st.Suppressed)
+	}
+
+	sender.fail["+15555550001"] = false
+	results, _ = d.Flush(next_day.Add(time.Minute))
+	expected := "+15555550001: text-me-when: 2 messages were not sent because the budget ran out: " +
+		"pills (1), standup (1)"
+	if len(results) != 1 || results[0].Outcome != Sent || len(sender.sent) != 2 || sender.sent[1] != expected {
+		t.Errorf("got results %v and sent %v (\"%s\" expected)", results, sender.sent, expected)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Implements the describe command, which prints an English description of
+// when each reminder in the config is sent.
+func run_describe(args []string) int {
+	flag_set := flag.NewFlagSet("describe", flag.ExitOnError)
+	flag_set.Usage = func() {
+		usage_header := "Usage: %s describe [OPTIONS]\n" +
+			"\n" +
+			"  Prints an English description of when each reminder is sent, of the\n" +
+			"  quiet hours of each recipient, and of the limits on messages.\n" +
+			"\n" +
+			"Options:\n"
+		fmt.Fprintf(flag_set.Output(), usage_header, os.Args[0])
+		flag_set.PrintDefaults()
+	}
+	reminders_path := flag_set.String("c", "/etc/text-me-when.json", "The path to the reminders config file or directory")
+	tags := flag_set.String("tags", "", "Only describe reminders that have at least one of these comma-separated tags")
+	flag_set.Parse(args)
+	if flag_set.NArg() != 0 {
+		flag_set.Usage()
+		return 1
+	}
+
+	config, err := load_config(*reminders_path)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	reminder_list := config.Reminders
+	tag_list := parse_tags(*tags)
+	first := true
+	for _, r := range reminder_list {
+		if !r.HasAnyTag(tag_list) {
+			continue
+		}
+		if !first {
+			fmt.Println()
+		}
+		first = false
+		fmt.Printf("id: %s\n", r.ID)
+		if r.Name != "" {
+			fmt.Printf("name: %s\n", r.Name)
+		}
+		if len(r.Tags) > 0 {
+			fmt.Printf("tags: %s\n", strings.Join(r.Tags, ", "))
+		}
+		if !r.Enabled {
+			fmt.Printf("enabled: false\n")
+		}
+		if len(r.Recipients) > 0 {
+			fmt.Printf("recipients: %s\n", strings.Join(r.Recipients, ", "))
+		}
+		if r.Timezone != "" {
+			fmt.Printf("timezone: %s\n", r.Timezone)
+		}
+		if !r.NotBefore.IsZero() {
+			fmt.Printf("not before: %s\n", r.NotBefore.Format("2006-01-02 15:04 MST"))
+		}
+		if !r.NotAfter.IsZero() {
+			fmt.Printf("not after: %s\n", r.NotAfter.Format("2006-01-02 15:04 MST"))
+		}
+		if r.Urgent {
+			fmt.Println("urgent: sent even during quiet hours")
+		}
+		if r.Condition != nil {
+			fmt.Printf("condition: %s\n", r.Condition.Describe())
+		}
+		if len(r.Exclude) > 0 {
+			fmt.Printf("exclude: %s\n", strings.Join(r.Exclude, ", "))
+		}
+		fmt.Printf("message: %s\n", r.Message)
+		if r.MessageCommand != nil {
+			fmt.Printf("message command: %s\n", r.MessageCommand.Describe())
+		}
+		if r.SMS != nil {
+			fmt.Printf("sms: %s\n", r.SMS.Describe())
+		}
+		for _, trigger := range r.Triggers {
+			fmt.Printf("  %s trigger: %s\n", trigger.TriggerType(), trigger.Describe())
+		}
+	}
+	addresses := make([]string, 0, len(config.Recipients))
+	for address := range config.Recipients {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		if !first {
+			fmt.Println()
+		}
+		first = false
+		recipient := config.Recipients[address]
+		fmt.Printf("recipient: %s\n", address)
+		if recipient.Timezone != "" {
+			fmt.Printf("timezone: %s\n", recipient.Timezone)
+		}
+		fmt.Printf("%s\n", recipient.Describe())
+	}
+	if config.Limits != nil {
+		if !first {
+			fmt.Println()
+		}
+		fmt.Printf("limits: %s\n", config.Limits.Describe())
+	}
+	return 0
+}
@@ -2,4 +2,8 @@ module github.com/adamkpickering/reminder-boi
 
 go 1.13
 
-require github.com/aws/aws-sdk-go v1.36.2
+require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/aws/aws-sdk-go v1.36.2
+	gopkg.in/yaml.v2 v2.4.0
+)
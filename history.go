@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/delivery"
+	"github.com/adamkpickering/reminder-boi/history"
+	"github.com/adamkpickering/reminder-boi/reminder"
+)
+
+// The statuses that history records can have, which are the names of the
+// delivery outcomes.
+var history_statuses = []string{"sent", "failed", "dropped", "deferred", "summarized"}
+
+// history_recorder appends what happened to each message to the history
+// store, and compacts the store once a day. A nil history_recorder records
+// nothing.
+type history_recorder struct {
+	store     *history.Store
+	retention time.Duration
+	compacted string
+}
+
+// Returns a history_recorder for the history file at path that drops records
+// older than retention_days when it compacts, or keeps them forever if
+// retention_days is 0. If path is empty, nil is returned, so that no history
+// is kept.
+func new_history_recorder(path string, retention_days int) *history_recorder {
+	if path == "" {
+		return nil
+	}
+	return &history_recorder{
+		store:     history.Open(path),
+		retention: time.Duration(retention_days) * 24 * time.Hour,
+	}
+}
+
+// Appends a record of result, which happened at now, to the history store.
+// The record has the message's HistoryID, if it has one, so that a deferred
+// message's record is replaced when it is sent.
+func (h *history_recorder) record(result delivery.Result, now time.Time) {
+	if h == nil {
+		return
+	}
+	message := result.Message
+	fire_time := message.FireTime
+	if fire_time.IsZero() {
+		fire_time = now
+	}
+	ack := history.AckNone
+	if result.Outcome == delivery.Sent {
+		ack = history.AckPending
+	}
+	id := message.HistoryID
+	if id == "" {
+		id = history.NewID()
+	}
+	record := history.Record{
+		ID:         id,
+		ReminderID: message.ReminderID,
+		FireTime:   fire_time,
+		Recipient:  message.Recipient,
+		Channel:    channel_of(message.Recipient),
+		MessageIDs: result.MessageIDs,
+		Status:     result.Outcome.String(),
+		Reason:     result.Reason,
+		Ack:        ack,
+	}
+	if err := h.store.Append(record); err != nil {
+		logger.Error("failed to record history", "reminder_id", message.ReminderID, "recipient",
+			message.Recipient, "error", err)
+	}
+}
+
+// Compacts the history store if it hasn't been compacted yet on the day of
+// now.
+func (h *history_recorder) compact_daily(now time.Time) {
+	if h == nil {
+		return
+	}
+	day := now.In(time.Local).Format("2006-01-02")
+	if day == h.compacted {
+		return
+	}
+	h.compacted = day
+	removed, err := h.store.Compact(now, h.retention)
+	if err != nil {
+		logger.Error("failed to compact history", "error", err)
+		return
+	}
+	if removed > 0 {
+		logger.Info("compacted history", "removed", removed)
+	}
+}
+
+// Implements the history command, which prints the records in the history
+// store, acknowledges one of them, or compacts the store.
+func run_history(args []string) int {
+	flag_set := flag.NewFlagSet("history", flag.ExitOnError)
+	flag_set.Usage = func() {
+		usage_header := "Usage: %s history [OPTIONS]\n" +
+			"\n" +
+			"  Prints the history of the messages that reminders sent, or tried to send,\n" +
+			"  oldest first. With -ack, acknowledges the sent message with that record ID\n" +
+			"  instead. With -compact, rewrites the history file without replaced records\n" +
+			"  and records older than -retention-days.\n" +
+			"\n" +
+			"Options:\n"
+		fmt.Fprintf(flag_set.Output(), usage_header, os.Args[0])
+		flag_set.PrintDefaults()
+	}
+	history_path := flag_set.String("history", "/var/lib/text-me-when/history.jsonl", "The path to the history file")
+	id := flag_set.String("id", "", "Only show messages from the reminder with this ID")
+	from := flag_set.String("from", "", "Only show messages fired on or after this date (2006-01-02) or RFC 3339 time")
+	to := flag_set.String("to", "", "Only show messages fired up to this date (2006-01-02), or before this RFC 3339 time")
+	status := flag_set.String("status", "",
+		"Only show messages with this status: sent, failed, dropped, deferred or summarized")
+	ack_state := flag_set.String("ack-state", "", "Only show messages with this ack state: none, pending or acked")
+	count := flag_set.Int("n", 0, "Only show the last n matching messages; 0 shows them all")
+	as_json := flag_set.Bool("json", false, "Print records as JSON Lines rather than a table")
+	ack := flag_set.String("ack", "", "Acknowledge the sent message with this record ID")
+	compact := flag_set.Bool("compact", false, "Compact the history file")
+	retention_days := flag_set.Int("retention-days", 0,
+		"When compacting, drop records fired more than this many days ago; 0 keeps them forever")
+	flag_set.Parse(args)
+	if flag_set.NArg() != 0 || *count < 0 || *retention_days < 0 {
+		flag_set.Usage()
+		return 1
+	}
+	store := history.Open(*history_path)
+
+	if *ack != "" {
+		record, err := store.Ack(*ack, time.Now())
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+		fmt.Printf("acknowledged %s: reminder %s to %s\n", record.ID, record.ReminderID, record.Recipient)
+		return 0
+	}
+	if *compact {
+		removed, err := store.Compact(time.Now(), time.Duration(*retention_days)*24*time.Hour)
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			return 1
+		}
+		fmt.Printf("removed %s\n", reminder.CountOf(removed, "line"))
+		return 0
+	}
+
+	filter := history.Filter{ReminderID: *id, Status: *status, Ack: *ack_state}
+	if *status != "" && !contains(history_statuses, *status) {
+		fmt.Printf("status \"%s\" is not one of sent, failed, dropped, deferred and summarized\n", *status)
+		return 1
+	}
+	if *ack_state != "" && !contains([]string{history.AckNone, history.AckPending, history.AckAcked}, *ack_state) {
+		fmt.Printf("ack state \"%s\" is not one of none, pending and acked\n", *ack_state)
+		return 1
+	}
+	var err error
+	if *from != "" {
+		if filter.From, _, err = parse_history_time(*from); err != nil {
+			fmt.Printf("Failed to parse -from: %s\n", err)
+			return 1
+		}
+	}
+	if *to != "" {
+		var date_only bool
+		if filter.To, date_only, err = parse_history_time(*to); err != nil {
+			fmt.Printf("Failed to parse -to: %s\n", err)
+			return 1
+		}
+		if date_only {
+			filter.To = filter.To.AddDate(0, 0, 1)
+		}
+	}
+
+	records, err := store.Read()
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	matching := make([]history.Record, 0, len(records))
+	for _, record := range records {
+		if filter.Match(record) {
+			matching = append(matching, record)
+		}
+	}
+	if *count > 0 && len(matching) > *count {
+		matching = matching[len(matching)-*count:]
+	}
+	if *as_json {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, record := range matching {
+			if err := encoder.Encode(record); err != nil {
+				fmt.Printf("%s\n", err)
+				return 1
+			}
+		}
+		return 0
+	}
+	print_history(matching)
+	return 0
+}
+
+// Parses a time given to the -from or -to flag of the history command, which
+// is either a date, taken to be midnight local time, or an RFC 3339 time. The
+// returned bool is true if it was a date.
+func parse_history_time(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("\"%s\" is not a date like 2021-04-12 or an RFC 3339 time", value)
+	}
+	return t, false, nil
+}
+
+// Prints records as a table, with fire times in local time.
+func print_history(records []history.Record) {
+	if len(records) == 0 {
+		fmt.Println("no messages")
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tFIRED\tREMINDER\tRECIPIENT\tCHANNEL\tSTATUS\tACK\tDETAILS")
+	for _, record := range records {
+		details := record.Reason
+		if len(record.MessageIDs) > 0 {
+			details = "message ID " + strings.Join(record.MessageIDs, ", ")
+			if record.Reason != "" {
+				details = details + "; " + record.Reason
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", record.ID,
+			record.FireTime.In(time.Local).Format("2006-01-02 15:04:05 MST"), record.ReminderID, record.Recipient,
+			record.Channel, record.Status, record.Ack, details)
+	}
+	writer.Flush()
+}
+
+// Tells the caller whether list contains value.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
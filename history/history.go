@@ -0,0 +1,283 @@
+// Package history keeps a record of every message that text-me-when tried to
+// send, and what happened to it. Records are stored as JSON Lines: each is
+// appended to the end of the file as a line of JSON, and is never changed in
+// place. A record is updated, for example when it is acknowledged, by
+// appending a new version of it with the same ID, which replaces the old one
+// when the file is read. Compaction rewrites the file without the replaced
+// versions and the records that are older than the retention period. Appends
+// and compactions take a lock on a file next to the history file, so that a
+// record appended by another process while the file is compacted isn't lost.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The acknowledgement states of a Record. A message that was sent is pending
+// until it is acknowledged; messages that weren't sent can't be acknowledged.
+const (
+	AckNone    = "none"
+	AckPending = "pending"
+	AckAcked   = "acked"
+)
+
+// A Record is what happened to a message that a reminder sent to a single
+// recipient. FireTime is when the reminder fired. Channel is how the message
+// was sent, such as "sms". MessageIDs are the IDs that the provider gave the
+// message, one for each SMS part that was sent. Status is what happened to the
+// message, such as "sent" or "deferred", and Reason explains it.
+type Record struct {
+	ID         string     `json:"id"`
+	ReminderID string     `json:"reminder_id"`
+	FireTime   time.Time  `json:"fire_time"`
+	Recipient  string     `json:"recipient"`
+	Channel    string     `json:"channel"`
+	MessageIDs []string   `json:"message_ids,omitempty"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	Ack        string     `json:"ack"`
+	AckedAt    *time.Time `json:"acked_at,omitempty"`
+}
+
+// Returns a new, random Record ID, such as "9f86d081884c7d65".
+func NewID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		// fall back on the time, which is unique enough for one process
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
+
+// A Store is a history file. Appending to it and compacting it are safe from
+// several goroutines and several processes.
+type Store struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// Returns the Store at path. The file and its directory are created when the
+// first Record is appended.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Appends records to s.
+func (s *Store) Append(records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var buffer bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode history record: %w", err)
+		}
+		buffer.Write(line)
+		buffer.WriteString("\n")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	if _, err := file.Write(buffer.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return file.Close()
+}
+
+// Returns the Records in s, in the order they were first appended, with each
+// replaced by its latest version. If the file does not exist, there are no
+// Records.
+func (s *Store) Read() ([]Record, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.read()
+}
+
+func (s *Store) read() ([]Record, error) {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return []Record{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+	records := make([]Record, 0)
+	index := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line_number := 0
+	for scanner.Scan() {
+		line_number = line_number + 1
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of history file %s: %w", line_number, s.path, err)
+		}
+		if i, ok := index[record.ID]; ok {
+			records[i] = record
+			continue
+		}
+		index[record.ID] = len(records)
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	return records, nil
+}
+
+// Acknowledges the Record with the ID id at now, and returns it. It is an
+// error if there is no such Record or it is not pending.
+func (s *Store) Ack(id string, now time.Time) (Record, error) {
+	records, err := s.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	for _, record := range records {
+		if record.ID != id {
+			continue
+		}
+		if record.Ack != AckPending {
+			return Record{}, fmt.Errorf("history record %s can't be acknowledged: its ack state is %s", id,
+				record.Ack)
+		}
+		record.Ack = AckAcked
+		record.AckedAt = &now
+		return record, s.Append(record)
+	}
+	return Record{}, fmt.Errorf("there is no history record %s", id)
+}
+
+// Rewrites s with only the latest version of each Record, dropping the
+// Records that fired more than retention before now. If retention is 0, no
+// Records are dropped. Returns the number of lines removed.
+func (s *Store) Compact(now time.Time, retention time.Duration) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	before, err := s.countLines()
+	if err != nil {
+		return 0, err
+	}
+	records, err := s.read()
+	if err != nil {
+		return 0, err
+	}
+	var buffer bytes.Buffer
+	kept := 0
+	for _, record := range records {
+		if retention > 0 && record.FireTime.Before(now.Add(-retention)) {
+			continue
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode history record: %w", err)
+		}
+		buffer.Write(line)
+		buffer.WriteString("\n")
+		kept = kept + 1
+	}
+	if before == kept {
+		return 0, nil
+	}
+	tmp_path := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp_path, buffer.Bytes(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := os.Rename(tmp_path, s.path); err != nil {
+		return 0, fmt.Errorf("failed to replace history file: %w", err)
+	}
+	return before - kept, nil
+}
+
+// Takes the lock that appends and compactions of s hold, creating the
+// directory of its file if need be, and returns the function that releases
+// it. The lock is on a separate file, since compacting replaces the history
+// file. The caller must hold s.mutex.
+func (s *Store) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	file, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history lock file: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock history file: %w", err)
+	}
+	return func() { file.Close() }, nil
+}
+
+// Returns the number of non-empty lines in the file of s.
+func (s *Store) countLines() (int, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read history file: %w", err)
+	}
+	count := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			count = count + 1
+		}
+	}
+	return count, nil
+}
+
+// A Filter picks Records. Empty fields match every Record; From and To are
+// inclusive and exclusive bounds on FireTime.
+type Filter struct {
+	ReminderID string
+	From       time.Time
+	To         time.Time
+	Status     string
+	Ack        string
+}
+
+// Tells the caller whether record is picked by f.
+func (f Filter) Match(record Record) bool {
+	switch {
+	case f.ReminderID != "" && record.ReminderID != f.ReminderID:
+		return false
+	case !f.From.IsZero() && record.FireTime.Before(f.From):
+		return false
+	case !f.To.IsZero() && !record.FireTime.Before(f.To):
+		return false
+	case f.Status != "" && record.Status != f.Status:
+		return false
+	case f.Ack != "" && record.Ack != f.Ack:
+		return false
+	}
+	return true
+}
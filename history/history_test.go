@@ -0,0 +1,163 @@
+package history
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a Store in a new temp dir, which the caller must remove.
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "text-me-when-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	return Open(filepath.Join(dir, "history", "history.jsonl")), dir
+}
+
+func TestAppendAndAck(t *testing.T) {
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+	records, err := s.Read()
+	if err != nil || len(records) != 0 {
+		t.Fatalf("got records %v and error %v from a missing file", records, err)
+	}
+
+	fired := time.Date(2021, time.April, 12, 8, 0, 0, 0, time.UTC)
+	err = s.Append(
+		Record{ID: "a", ReminderID: "pills", FireTime: fired, Recipient: "+15555550123", Channel: "sms",
+			MessageIDs: []string{"m1"}, Status: "sent", Ack: AckPending},
+		Record{ID: "b", ReminderID: "pills", FireTime: fired, Recipient: "+15555550124", Channel: "sms",
+			Status: "deferred", Reason: "quiet hours until 2021-04-12 09:00 UTC", Ack: AckNone},
+	)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	acked_at := fired.Add(time.Hour)
+	record, err := s.Ack("a", acked_at)
+	if err != nil || record.Ack != AckAcked || !record.AckedAt.Equal(acked_at) {
+		t.Errorf("got record %+v and error %v", record, err)
+	}
+	if _, err := s.Ack("a", acked_at); err == nil {
+		t.Error("no error acknowledging a record twice")
+	}
+	if _, err := s.Ack("b", acked_at); err == nil {
+		t.Error("no error acknowledging a message that wasn't sent")
+	}
+	if _, err := s.Ack("c", acked_at); err == nil {
+		t.Error("no error acknowledging a record that doesn't exist")
+	}
+
+	// the acknowledgement is appended, and replaces the first version
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		t.Fatalf("failed to read history file: %s", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("history file has %d lines (3 expected):\n%s", lines, data)
+	}
+	records, err = s.Read()
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if len(records) != 2 || records[0].ID != "a" || records[0].Ack != AckAcked || records[0].MessageIDs[0] != "m1" ||
+		records[1].ID != "b" || records[1].Reason == "" {
+		t.Errorf("got records %+v", records)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+	now := time.Date(2021, time.April, 12, 8, 0, 0, 0, time.UTC)
+	s.Append(
+		Record{ID: "old", FireTime: now.AddDate(0, 0, -31), Status: "sent", Ack: AckPending},
+		Record{ID: "new", FireTime: now.AddDate(0, 0, -1), Status: "sent", Ack: AckPending},
+	)
+	s.Ack("new", now)
+
+	// without retention, only the replaced version goes
+	removed, err := s.Compact(now, 0)
+	if err != nil || removed != 1 {
+		t.Errorf("removed %d lines with error %v (1 expected)", removed, err)
+	}
+	removed, err = s.Compact(now, 30*24*time.Hour)
+	if err != nil || removed != 1 {
+		t.Errorf("removed %d lines with error %v (1 expected)", removed, err)
+	}
+	records, err := s.Read()
+	if err != nil || len(records) != 1 || records[0].ID != "new" || records[0].Ack != AckAcked {
+		t.Errorf("got records %+v and error %v", records, err)
+	}
+	if removed, err := s.Compact(now, 30*24*time.Hour); err != nil || removed != 0 {
+		t.Errorf("removed %d lines with error %v from a compacted file", removed, err)
+	}
+}
+
+func TestCompactWhileAppending(t *testing.T) {
+	// separate Stores for the same file stand in for separate processes
+	s, dir := newTestStore(t)
+	defer os.RemoveAll(dir)
+	other := Open(s.path)
+	now := time.Date(2021, time.April, 12, 8, 0, 0, 0, time.UTC)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 2000; i++ {
+			id := fmt.Sprintf("%d", i)
+			// each record is replaced, so that there is always something to compact
+			other.Append(Record{ID: id, FireTime: now, Status: "sent", Ack: AckPending})
+			other.Append(Record{ID: id, FireTime: now, Status: "sent", Ack: AckAcked})
+		}
+		close(done)
+	}()
+	for compacting := true; compacting; {
+		select {
+		case <-done:
+			compacting = false
+		default:
+		}
+		if _, err := s.Compact(now, 0); err != nil {
+			t.Fatalf("got unexpected error: %s", err)
+		}
+	}
+	records, err := s.Read()
+	if err != nil || len(records) != 2000 {
+		t.Fatalf("got %d records and error %v (2000 expected)", len(records), err)
+	}
+	for _, record := range records {
+		if record.Ack != AckAcked {
+			t.Errorf("record %s lost its ack", record.ID)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	fired := time.Date(2021, time.April, 12, 8, 0, 0, 0, time.UTC)
+	record := Record{ID: "a", ReminderID: "pills", FireTime: fired, Status: "sent", Ack: AckPending}
+	test_cases := []struct {
+		filter  Filter
+		matches bool
+	}{
+		{Filter{}, true},
+		{Filter{ReminderID: "pills", Status: "sent", Ack: AckPending}, true},
+		{Filter{ReminderID: "plants"}, false},
+		{Filter{Status: "failed"}, false},
+		{Filter{Ack: AckAcked}, false},
+		{Filter{From: fired, To: fired.Add(time.Second)}, true},
+		{Filter{From: fired.Add(time.Second)}, false},
+		{Filter{To: fired}, false},
+	}
+	for _, test_case := range test_cases {
+		if matches := test_case.filter.Match(record); matches != test_case.matches {
+			t.Errorf("filter %+v matched: %t (%t expected)", test_case.filter, matches, test_case.matches)
+		}
+	}
+	if NewID() == NewID() || len(NewID()) != 16 {
+		t.Error("NewID did not return unique 16 character IDs")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package history
+
+import (
+	"os"
+	"syscall"
+)
+
+// Takes an exclusive lock on file, waiting until no other process holds it.
+// The lock is released when file is closed.
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
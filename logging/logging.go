@@ -0,0 +1,287 @@
+// Package logging writes leveled, structured log records, one per line, as
+// logfmt or JSON. Each record has a time, a level, a message and fields given
+// as alternating keys and values. Recipients are masked, and message bodies
+// can be redacted, so that logs can be shipped elsewhere without leaking them.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// A Level is how important a log record is. Records below a Logger's Level
+// are thrown away.
+type Level int
+
+// The levels, from least to most important.
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+// The formats that a Logger can write records in.
+const (
+	Logfmt = "logfmt"
+	JSON   = "json"
+)
+
+// RecipientKey is the key of fields whose values, which may be a recipient or
+// a list of them, are masked with MaskRecipient.
+const RecipientKey = "recipient"
+
+// BodyKey is the key of fields whose values are redacted when a Logger's
+// RedactBodies is true.
+const BodyKey = "body"
+
+// redacted replaces redacted values.
+const redacted = "[redacted]"
+
+// Returns the name of the Level, for example "warn".
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Warn:
+		return "warn"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// Parses the name of a Level, such as "info".
+func ParseLevel(name string) (Level, error) {
+	for level := Debug; level <= Error; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return Info, fmt.Errorf("log level \"%s\" is not one of debug, info, warn and error", name)
+}
+
+// Checks that format is one of the formats that a Logger can write.
+func CheckFormat(format string) error {
+	if format != Logfmt && format != JSON {
+		return fmt.Errorf("log format \"%s\" is not %s or %s", format, Logfmt, JSON)
+	}
+	return nil
+}
+
+// Options are the settings of a Logger. Format is Logfmt or JSON. If
+// RedactBodies is true, fields with the key BodyKey are written as
+// "[redacted]".
+type Options struct {
+	Level        Level
+	Format       string
+	RedactBodies bool
+}
+
+// A Logger writes log records to an io.Writer. It is safe to use from several
+// goroutines at once.
+type Logger struct {
+	mutex   sync.Mutex
+	out     io.Writer
+	options Options
+	now     func() time.Time
+}
+
+// Returns a Logger that writes to out with options.
+func New(out io.Writer, options Options) *Logger {
+	return &Logger{out: out, options: options, now: time.Now}
+}
+
+// Changes the options of l.
+func (l *Logger) SetOptions(options Options) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.options = options
+}
+
+// Tells the caller whether records at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return level >= l.options.Level
+}
+
+// Writes a record at the debug level. keyvals are alternating keys and
+// values.
+func (l *Logger) Debug(message string, keyvals ...interface{}) {
+	l.log(Debug, message, keyvals)
+}
+
+// Writes a record at the info level. keyvals are alternating keys and values.
+func (l *Logger) Info(message string, keyvals ...interface{}) {
+	l.log(Info, message, keyvals)
+}
+
+// Writes a record at the warn level. keyvals are alternating keys and values.
+func (l *Logger) Warn(message string, keyvals ...interface{}) {
+	l.log(Warn, message, keyvals)
+}
+
+// Writes a record at the error level. keyvals are alternating keys and
+// values.
+func (l *Logger) Error(message string, keyvals ...interface{}) {
+	l.log(Error, message, keyvals)
+}
+
+// A field is a key and value of a log record.
+type field struct {
+	key   string
+	value interface{}
+}
+
+func (l *Logger) log(level Level, message string, keyvals []interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if level < l.options.Level {
+		return
+	}
+	fields := []field{
+		{"time", l.now().Format("2006-01-02T15:04:05.000Z07:00")},
+		{"level", level.String()},
+		{"msg", message},
+	}
+	for i := 0; i < len(keyvals); i = i + 2 {
+		key := fmt.Sprint(keyvals[i])
+		if i+1 == len(keyvals) {
+			fields = append(fields, field{"!BADKEY", key})
+			break
+		}
+		fields = append(fields, field{key, l.fieldValue(key, keyvals[i+1])})
+	}
+	var line string
+	if l.options.Format == JSON {
+		line = encodeJSON(fields)
+	} else {
+		line = encodeLogfmt(fields)
+	}
+	io.WriteString(l.out, line+"\n")
+}
+
+// Returns the value that is written for the field key, after masking and
+// redaction. Lists of strings are joined with commas, and errors, durations
+// and other values that aren't strings, numbers or bools are written as
+// strings.
+func (l *Logger) fieldValue(key string, value interface{}) interface{} {
+	switch {
+	case key == RecipientKey:
+		if recipients, ok := value.([]string); ok {
+			masked := make([]string, 0, len(recipients))
+			for _, recipient := range recipients {
+				masked = append(masked, MaskRecipient(recipient))
+			}
+			return strings.Join(masked, ",")
+		}
+		return MaskRecipient(fmt.Sprint(value))
+	case key == BodyKey && l.options.RedactBodies:
+		return redacted
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string, bool, int, int64, uint, uint64, float64:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Returns recipient with all but the first two and last two characters of
+// the phone number masked, for example "+1********23". SNS topic ARNs aren't
+// personal, so they are returned as they are.
+func MaskRecipient(recipient string) string {
+	if strings.HasPrefix(recipient, "arn:") {
+		return recipient
+	}
+	runes := []rune(recipient)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:2]) + strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-2:])
+}
+
+// Encodes fields as a JSON object, keeping their order.
+func encodeJSON(fields []field) string {
+	var builder strings.Builder
+	builder.WriteString("{")
+	for i, f := range fields {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f.value))
+		}
+		builder.Write(key)
+		builder.WriteString(":")
+		builder.Write(value)
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// Encodes fields as logfmt: key=value pairs separated by spaces, with values
+// quoted when they need to be.
+func encodeLogfmt(fields []field) string {
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		var value string
+		switch v := f.value.(type) {
+		case nil:
+			value = ""
+		case string:
+			value = v
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+		parts = append(parts, logfmtKey(f.key)+"="+logfmtValue(value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Returns key with the characters that logfmt doesn't allow in keys replaced
+// by underscores.
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// Returns value quoted if it is empty or has spaces, quotes, equals signs or
+// control characters in it.
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
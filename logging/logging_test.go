@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a Logger that writes to the returned buffer, with its clock
+// stopped at 2021-03-03 12:00 UTC.
+func newTestLogger(options Options) (*Logger, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	l := New(out, options)
+	l.now = func() time.Time {
+		return time.Date(2021, time.March, 3, 12, 0, 0, 0, time.UTC)
+	}
+	return l, out
+}
+
+func TestLogfmt(t *testing.T) {
+	l, out := newTestLogger(Options{Level: Info, Format: Logfmt})
+	l.Debug("not written")
+	l.Info("sent", "reminder_id", "pills", "recipient", "+15555550123", "body", "Take your pills.",
+		"latency_ms", 12.5, "attempt", 1, "error", errors.New("oops"), "trigger", "")
+	l.Warn("odd", "key")
+	expected := `time=2021-03-03T12:00:00.000Z level=info msg=sent reminder_id=pills recipient=+1********23 ` +
+		`body="Take your pills." latency_ms=12.5 attempt=1 error=oops trigger=""` + "\n" +
+		`time=2021-03-03T12:00:00.000Z level=warn msg=odd !BADKEY=key` + "\n"
+	if out.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	l, out := newTestLogger(Options{Level: Debug, Format: JSON, RedactBodies: true})
+	l.Debug("sent", "recipient", "arn:aws:sns:us-west-2:123456789012:reminders", "body", "Take your pills.",
+		"latency_ms", 12.5, "urgent", true, "recipient_count", 2)
+	expected := `{"time":"2021-03-03T12:00:00.000Z","level":"debug","msg":"sent",` +
+		`"recipient":"arn:aws:sns:us-west-2:123456789012:reminders","body":"[redacted]","latency_ms":12.5,` +
+		`"urgent":true,"recipient_count":2}` + "\n"
+	if out.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Errorf("record is not valid JSON: %s", err)
+	}
+}
+
+func TestMaskRecipient(t *testing.T) {
+	test_cases := []struct {
+		recipient string
+		masked    string
+	}{
+		{"+15555550123", "+1********23"},
+		{"+447700900123", "+4*********23"},
+		{"+12", "***"},
+		{"arn:aws:sns:us-west-2:123456789012:reminders", "arn:aws:sns:us-west-2:123456789012:reminders"},
+	}
+	for _, test_case := range test_cases {
+		if masked := MaskRecipient(test_case.recipient); masked != test_case.masked {
+			t.Errorf("%s was masked to %s (%s expected)", test_case.recipient, masked, test_case.masked)
+		}
+	}
+
+	l, out := newTestLogger(Options{Level: Info, Format: Logfmt})
+	l.Info("loaded", "recipient", []string{"+15555550123", "+15555550124"})
+	if !strings.Contains(out.String(), "recipient=+1********23,+1********24") {
+		t.Errorf("got %s", out.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "info", "WARN", "error"} {
+		level, err := ParseLevel(name)
+		if err != nil || level.String() != strings.ToLower(name) {
+			t.Errorf("%s parsed to %s with error %v", name, level, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("no error for level \"verbose\"")
+	}
+	if CheckFormat(JSON) != nil || CheckFormat(Logfmt) != nil || CheckFormat("text") == nil {
+		t.Error("CheckFormat accepted or rejected the wrong formats")
+	}
+}
@@ -0,0 +1,287 @@
+// Package metrics keeps counters, gauges and histograms, and writes them in
+// the Prometheus text exposition format, so that a Prometheus server can
+// scrape them. Each metric may have labels, such as the ID of a reminder;
+// every distinct set of label values is a separate series.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// nameRegexp matches valid metric names.
+	nameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	// labelRegexp matches valid label names.
+	labelRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// A Registry holds metrics and writes them out. It is safe to use, along with
+// its metrics, from several goroutines at once.
+type Registry struct {
+	mutex    sync.Mutex
+	families []*family
+	names    map[string]bool
+}
+
+// Returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// A family is a metric and all of its series.
+type family struct {
+	registry *Registry
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	buckets  []float64
+	series   map[string]*series
+}
+
+// A series is the value of a metric for one set of label values. Counters and
+// gauges use value; histograms use counts, which are per bucket rather than
+// cumulative, sum and count.
+type series struct {
+	values []string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Adds a family to r. It panics if name or labels are invalid or name is
+// already registered, since that is a mistake in the program rather than
+// something that can be handled.
+func (r *Registry) register(name string, help string, kind string, labels []string, buckets []float64) *family {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !nameRegexp.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name \"%s\"", name))
+	}
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: metric %s is already registered", name))
+	}
+	for _, label := range labels {
+		if !labelRegexp.MatchString(label) || strings.HasPrefix(label, "__") || (kind == "histogram" && label == "le") {
+			panic(fmt.Sprintf("metrics: invalid label name \"%s\" for metric %s", label, name))
+		}
+	}
+	f := &family{
+		registry: r,
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   append([]string(nil), labels...),
+		buckets:  buckets,
+		series:   map[string]*series{},
+	}
+	if len(labels) == 0 {
+		// metrics without labels are written out even before they are used
+		f.get(nil)
+	}
+	r.names[name] = true
+	r.families = append(r.families, f)
+	return f
+}
+
+// Returns the series of f for values, creating it if need be. The caller must
+// hold the Registry's mutex. It panics if the number of values is not the
+// number of labels.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: metric %s has %d labels but was given %d values", f.name, len(f.labels),
+			len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// A Counter is a metric whose value only goes up, such as the number of
+// messages sent.
+type Counter struct {
+	f *family
+}
+
+// Adds a Counter to r. Its value is given separately for each combination of
+// values of labels.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", labels, nil)}
+}
+
+// Adds one to the series of c for values, which are in the order of c's
+// labels.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Adds delta, which must not be negative, to the series of c for values.
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't go down", c.f.name))
+	}
+	c.f.registry.mutex.Lock()
+	defer c.f.registry.mutex.Unlock()
+	c.f.get(values).value += delta
+}
+
+// A Gauge is a metric whose value can go up and down, such as the number of
+// reminders that are loaded.
+type Gauge struct {
+	f *family
+}
+
+// Adds a Gauge to r. Its value is given separately for each combination of
+// values of labels.
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", labels, nil)}
+}
+
+// Sets the series of g for values to value.
+func (g *Gauge) Set(value float64, values ...string) {
+	g.f.registry.mutex.Lock()
+	defer g.f.registry.mutex.Unlock()
+	g.f.get(values).value = value
+}
+
+// Removes every series of g, for when the set of label values has changed. A
+// Gauge without labels is set to 0 instead.
+func (g *Gauge) Reset() {
+	g.f.registry.mutex.Lock()
+	defer g.f.registry.mutex.Unlock()
+	g.f.series = map[string]*series{}
+	if len(g.f.labels) == 0 {
+		g.f.get(nil)
+	}
+}
+
+// A Histogram counts observations, such as how late a check ran, in buckets.
+type Histogram struct {
+	f *family
+}
+
+// Adds a Histogram to r whose buckets have the upper bounds buckets, which
+// must be in increasing order. A bucket for +Inf is always added.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of histogram %s are not in increasing order", name))
+	}
+	return &Histogram{r.register(name, help, "histogram", labels, append([]float64(nil), buckets...))}
+}
+
+// Records value in the series of h for values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.f.registry.mutex.Lock()
+	defer h.f.registry.mutex.Unlock()
+	s := h.f.get(values)
+	for i, bound := range h.f.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Writes every metric in r to w in the Prometheus text exposition format, in
+// the order they were added. Series are sorted by their label values.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var builder strings.Builder
+	for _, f := range r.families {
+		fmt.Fprintf(&builder, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&builder, "# TYPE %s %s\n", f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != "histogram" {
+				fmt.Fprintf(&builder, "%s%s %s\n", f.name, formatLabels(f.labels, s.values), formatFloat(s.value))
+				continue
+			}
+			cumulative := uint64(0)
+			for i, bound := range f.buckets {
+				cumulative += s.counts[i]
+				labels := formatLabels(with(f.labels, "le"), with(s.values, formatFloat(bound)))
+				fmt.Fprintf(&builder, "%s_bucket%s %d\n", f.name, labels, cumulative)
+			}
+			labels := formatLabels(with(f.labels, "le"), with(s.values, "+Inf"))
+			fmt.Fprintf(&builder, "%s_bucket%s %d\n", f.name, labels, s.count)
+			fmt.Fprintf(&builder, "%s_sum%s %s\n", f.name, formatLabels(f.labels, s.values), formatFloat(s.sum))
+			fmt.Fprintf(&builder, "%s_count%s %d\n", f.name, formatLabels(f.labels, s.values), s.count)
+		}
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// Serves the metrics in r to a Prometheus scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.Write(w)
+}
+
+// Returns labels and their values in braces, for example
+// `{channel="sms",reminder_id="pills"}`, or "" if there are no labels.
+func formatLabels(labels []string, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels))
+	for i, label := range labels {
+		pairs = append(pairs, label+"=\""+escapeLabelValue(values[i])+"\"")
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Returns a copy of list with value added to the end.
+func with(list []string, value string) []string {
+	return append(append(make([]string, 0, len(list)+1), list...), value)
+}
+
+// Returns value as the text format writes it, for example "0.25" or "+Inf".
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Escapes backslashes, double quotes and newlines in a label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Escapes backslashes and newlines in help text.
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	sends := r.NewCounter("sends_total", "Messages sent.", "channel", "reminder_id")
+	reminders := r.NewGauge("reminders", "Reminders loaded.")
+	lag := r.NewHistogram("lag_seconds", "How late checks ran.\nIn seconds.", []float64{0.1, 1})
+	sends.Inc("sms", "pills")
+	sends.Add(2, "sms", "pills")
+	sends.Inc("sns_topic", "say \"hi\"\\now")
+	reminders.Set(3)
+	lag.Observe(0.05)
+	lag.Observe(0.5)
+	lag.Observe(2)
+
+	out := &bytes.Buffer{}
+	if err := r.Write(out); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	expected := `# HELP sends_total Messages sent.
+# TYPE sends_total counter
+sends_total{channel="sms",reminder_id="pills"} 3
+sends_total{channel="sns_topic",reminder_id="say \"hi\"\\now"} 1
+# HELP reminders Reminders loaded.
+# TYPE reminders gauge
+reminders 3
+# HELP lag_seconds How late checks ran.\nIn seconds.
+# TYPE lag_seconds histogram
+lag_seconds_bucket{le="0.1"} 1
+lag_seconds_bucket{le="1"} 2
+lag_seconds_bucket{le="+Inf"} 3
+lag_seconds_sum 2.55
+lag_seconds_count 3
+`
+	if out.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+
+	reminders.Reset()
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	if recorder.Header().Get("Content-Type") != ContentType || !strings.Contains(body, "\nreminders 0\n") {
+		t.Errorf("got response %v:\n%s", recorder.Header(), body)
+	}
+}
+
+func TestLabeledHistogram(t *testing.T) {
+	r := NewRegistry()
+	lag := r.NewHistogram("lag_seconds", "How late checks ran.", []float64{1}, "loop")
+	lag.Observe(0.5, "second")
+	out := &bytes.Buffer{}
+	r.Write(out)
+	expected := `# HELP lag_seconds How late checks ran.
+# TYPE lag_seconds histogram
+lag_seconds_bucket{loop="second",le="1"} 1
+lag_seconds_bucket{loop="second",le="+Inf"} 1
+lag_seconds_sum{loop="second"} 0.5
+lag_seconds_count{loop="second"} 1
+`
+	if out.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestMistakesPanic(t *testing.T) {
+	test_cases := []struct {
+		description string
+		f           func(r *Registry)
+	}{
+		{"invalid name", func(r *Registry) { r.NewCounter("sends-total", "") }},
+		{"invalid label", func(r *Registry) { r.NewCounter("sends_total", "", "reminder-id") }},
+		{"le label on a histogram", func(r *Registry) { r.NewHistogram("lag", "", []float64{1}, "le") }},
+		{"unsorted buckets", func(r *Registry) { r.NewHistogram("lag", "", []float64{1, 0.1}) }},
+		{"duplicate name", func(r *Registry) { r.NewGauge("reminders", ""); r.NewGauge("reminders", "") }},
+		{"wrong number of values", func(r *Registry) { r.NewCounter("sends_total", "", "channel").Inc() }},
+		{"negative delta", func(r *Registry) { r.NewCounter("sends_total", "").Add(-1) }},
+	}
+	for _, test_case := range test_cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic for %s", test_case.description)
+				}
+			}()
+			test_case.f(NewRegistry())
+		}()
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/adamkpickering/reminder-boi/reminder"
+)
+
+// Implements the migrate command, which rewrites config files so that every
+// reminder uses the latest schema version. The original of each rewritten
+// file is kept next to it with a .bak extension.
+func run_migrate(args []string) int {
+	flag_set := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flag_set.Usage = func() {
+		usage_header := "Usage: %s migrate [OPTIONS]\n" +
+			"\n" +
+			"  Rewrites the reminders config so that every reminder uses the latest schema\n" +
+			"  version (v2). The original of each rewritten file is kept next to it with a\n" +
+			"  .bak extension. Comments and key order are not preserved.\n" +
+			"\n" +
+			"Options:\n"
+		fmt.Fprintf(flag_set.Output(), usage_header, os.Args[0])
+		flag_set.PrintDefaults()
+	}
+	reminders_path := flag_set.String("c", "/etc/text-me-when.json", "The path to the reminders config file or directory")
+	dry_run := flag_set.Bool("n", false, "Print the migrated configs instead of writing them")
+	flag_set.Parse(args)
+	if flag_set.NArg() != 0 {
+		flag_set.Usage()
+		return 1
+	}
+
+	paths, err := reminder.ConfigFiles(*reminders_path)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	for _, path := range paths {
+		if err := migrate_file(path, *dry_run); err != nil {
+			fmt.Printf("Failed to migrate %s: %s\n", path, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// Migrates a single config file. If dry_run is true, the migrated config is
+// printed rather than written.
+func migrate_file(path string, dry_run bool) error {
+	format, err := reminder.FormatForPath(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	new_data, migrated, err := reminder.MigrateConfig(data, format)
+	if err != nil {
+		return err
+	}
+	if migrated == 0 {
+		fmt.Printf("%s: already up to date\n", path)
+		return nil
+	}
+	if dry_run {
+		fmt.Printf("%s: would migrate %d reminders:\n%s", path, migrated, new_data)
+		return nil
+	}
+	if err := ioutil.WriteFile(path+".bak", data, info.Mode()); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := ioutil.WriteFile(path, new_data, info.Mode()); err != nil {
+		return err
+	}
+	fmt.Printf("%s: migrated %d reminders\n", path, migrated)
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/delivery"
+	"github.com/adamkpickering/reminder-boi/metrics"
+	"github.com/adamkpickering/reminder-boi/reminder"
+	"github.com/adamkpickering/reminder-boi/state"
+)
+
+// The upper bounds, in seconds, of the buckets of the loop lag and check
+// duration histograms.
+var loop_buckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// How long to wait before looking again for the next fire of a reminder that
+// isn't sent within reminder.NextRunHorizon, since looking is slow.
+const next_fire_recheck = 24 * time.Hour
+
+// monitor keeps the metrics that are served at /metrics, and the time of the
+// scheduler's last tick, which /healthz reports on. The loop records what it
+// does in it, and the HTTP listener reads from it.
+type monitor struct {
+	registry       *metrics.Registry
+	fires          *metrics.Counter
+	sends          *metrics.Counter
+	failures       *metrics.Counter
+	retries        *metrics.Counter
+	reminders      *metrics.Gauge
+	next_fire      *metrics.Gauge
+	loop_lag       *metrics.Histogram
+	check_duration *metrics.Histogram
+
+	mutex         sync.Mutex
+	next_fires    map[string]next_fire
+	last_tick     time.Time
+	tick_interval time.Duration
+	stale_after   time.Duration
+	now           func() time.Time
+}
+
+// next_fire is when a reminder is next sent, if found is true, and when to
+// look for it again.
+type next_fire struct {
+	at       time.Time
+	found    bool
+	check_at time.Time
+}
+
+// Returns a monitor whose /healthz reports unhealthy when the scheduler hasn't
+// ticked for stale_after. If stale_after is 0, twice the tick interval plus 30
+// seconds is used instead.
+func new_monitor(stale_after time.Duration) *monitor {
+	registry := metrics.NewRegistry()
+	return &monitor{
+		registry: registry,
+		fires: registry.NewCounter("text_me_when_fires_total",
+			"Times a reminder fired and its message was handed over for delivery.", "reminder_id"),
+		sends: registry.NewCounter("text_me_when_sends_total",
+			"Messages sent.", "channel", "reminder_id"),
+		failures: registry.NewCounter("text_me_when_failures_total",
+			"Messages that failed to send.", "channel", "reminder_id"),
+		retries: registry.NewCounter("text_me_when_retries_total",
+			"Deferred messages that delivery was tried again for.", "channel", "reminder_id"),
+		reminders: registry.NewGauge("text_me_when_reminders_loaded",
+			"Reminders that are loaded and being checked."),
+		next_fire: registry.NewGauge("text_me_when_next_fire_seconds",
+			"Seconds until the reminder is next sent.", "reminder_id"),
+		loop_lag: registry.NewHistogram("text_me_when_loop_lag_seconds",
+			"How long after the time being checked the check started.", loop_buckets),
+		check_duration: registry.NewHistogram("text_me_when_check_duration_seconds",
+			"How long checking the reminders for a time took, including sending.", loop_buckets),
+		next_fires:    map[string]next_fire{},
+		last_tick:     time.Now(),
+		tick_interval: time.Minute,
+		stale_after:   stale_after,
+		now:           time.Now,
+	}
+}
+
+// Records that the scheduler ticks every interval.
+func (m *monitor) set_tick_interval(interval time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.tick_interval = interval
+}
+
+// Records that the scheduler has ticked.
+func (m *monitor) tick() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.last_tick = m.now()
+}
+
+// Records that a check of the reminders for eval_time is starting, and returns
+// the time it started, to be given to finish_check.
+func (m *monitor) start_check(eval_time time.Time) time.Time {
+	start := m.now()
+	m.loop_lag.Observe(start.Sub(eval_time).Seconds())
+	return start
+}
+
+// Records that the check that started at start has finished.
+func (m *monitor) finish_check(start time.Time) {
+	m.check_duration.Observe(m.now().Sub(start).Seconds())
+}
+
+// Records what happened to a message. retry is true if the message had been
+// deferred before.
+func (m *monitor) record_result(result delivery.Result, retry bool) {
+	channel := channel_of(result.Message.Recipient)
+	reminder_id := result.Message.ReminderID
+	if retry {
+		m.retries.Inc(channel, reminder_id)
+	}
+	switch result.Outcome {
+	case delivery.Sent:
+		m.sends.Inc(channel, reminder_id)
+	case delivery.Failed:
+		m.failures.Inc(channel, reminder_id)
+	}
+}
+
+// Works out when each reminder is next sent after now. Times that are still
+// in the future are kept rather than worked out again. Reminders that have
+// expired have no next fire.
+func (m *monitor) update_next_fires(reminder_list []reminder.ReminderV2, st *state.State, now time.Time) {
+	m.mutex.Lock()
+	previous := m.next_fires
+	m.mutex.Unlock()
+	next_fires := make(map[string]next_fire, len(reminder_list))
+	for _, r := range reminder_list {
+		if next, ok := previous[r.ID]; ok && next.check_at.After(now) {
+			next_fires[r.ID] = next
+			continue
+		}
+		if expired, _ := r.Expired(now, st.Count(r.ID)); expired {
+			next_fires[r.ID] = next_fire{check_at: now.Add(next_fire_recheck)}
+			continue
+		}
+		at, found := r.NextRun(now)
+		if !found {
+			next_fires[r.ID] = next_fire{check_at: now.Add(next_fire_recheck)}
+			continue
+		}
+		next_fires[r.ID] = next_fire{at: at, found: true, check_at: at}
+	}
+	m.mutex.Lock()
+	m.next_fires = next_fires
+	m.mutex.Unlock()
+	m.reminders.Set(float64(len(reminder_list)))
+}
+
+// Returns the handler of the HTTP listener, which serves /metrics and
+// /healthz.
+func (m *monitor) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.serve_metrics)
+	mux.HandleFunc("/healthz", m.serve_health)
+	return mux
+}
+
+// Serves the metrics, after setting the seconds until each reminder's next
+// fire.
+func (m *monitor) serve_metrics(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	now := m.now()
+	m.next_fire.Reset()
+	for reminder_id, next := range m.next_fires {
+		if !next.found {
+			continue
+		}
+		seconds := next.at.Sub(now).Seconds()
+		if seconds < 0 {
+			seconds = 0
+		}
+		m.next_fire.Set(seconds, reminder_id)
+	}
+	m.mutex.Unlock()
+	m.registry.ServeHTTP(w, r)
+}
+
+// Serves 200 if the scheduler has ticked recently, and 503 if it hasn't.
+func (m *monitor) serve_health(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	age := m.now().Sub(m.last_tick).Truncate(time.Second)
+	stale_after := m.stale_after
+	if stale_after == 0 {
+		stale_after = 2*m.tick_interval + 30*time.Second
+	}
+	m.mutex.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if age > stale_after {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "unhealthy: the scheduler last ticked %s ago, more than %s\n", age, stale_after)
+		return
+	}
+	fmt.Fprintf(w, "ok: the scheduler last ticked %s ago\n", age)
+}
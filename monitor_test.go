@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/delivery"
+	"github.com/adamkpickering/reminder-boi/reminder"
+	"github.com/adamkpickering/reminder-boi/state"
+)
+
+// Returns the status code and body of a GET of path from mon.
+func get(mon *monitor, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	mon.handler().ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestHealthz(t *testing.T) {
+	now := time.Date(2021, time.March, 3, 12, 0, 0, 0, time.UTC)
+	mon := new_monitor(0)
+	mon.now = func() time.Time { return now }
+	mon.tick()
+
+	test_cases := []struct {
+		since       time.Duration
+		interval    time.Duration
+		stale_after time.Duration
+		code        int
+	}{
+		{time.Minute, time.Minute, 0, 200},
+		{2*time.Minute + 30*time.Second, time.Minute, 0, 200},
+		{2*time.Minute + 31*time.Second, time.Minute, 0, 503},
+		{31 * time.Second, time.Second, 0, 200},
+		{33 * time.Second, time.Second, 0, 503},
+		{5 * time.Minute, time.Minute, 10 * time.Minute, 200},
+		{11 * time.Minute, time.Minute, 10 * time.Minute, 503},
+	}
+	for _, test_case := range test_cases {
+		mon.last_tick = now.Add(-test_case.since)
+		mon.stale_after = test_case.stale_after
+		mon.set_tick_interval(test_case.interval)
+		code, body := get(mon, "/healthz")
+		if code != test_case.code {
+			t.Errorf("got %d (%d expected) %s after the last tick with interval %s: %s", code, test_case.code,
+				test_case.since, test_case.interval, body)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	config := `[{"version": "v2", "id": "pills", "message": "Take your pills.",
+		"triggers": [{"trigger_type": "weekly", "weekday": "monday", "time": "08:00"}]}]`
+	reminder_list, err := reminder.ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "text-me-when-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := state.Load(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatalf("got unexpected error loading state: %s", err)
+	}
+	now := time.Date(2021, time.April, 12, 7, 59, 0, 0, time.Local)
+	mon := new_monitor(0)
+	mon.now = func() time.Time { return now.Add(250 * time.Millisecond) }
+	mon.update_next_fires(reminder_list, st, now)
+	start := mon.start_check(now)
+	mon.fires.Inc("pills")
+	sent := delivery.Message{ReminderID: "pills", Recipient: "+15555550123"}
+	mon.record_result(delivery.Result{Message: sent, Outcome: delivery.Sent}, false)
+	mon.record_result(delivery.Result{Message: sent, Outcome: delivery.Sent}, true)
+	failed := delivery.Message{ReminderID: "pills", Recipient: "arn:aws:sns:us-west-2:123456789012:reminders"}
+	mon.record_result(delivery.Result{Message: failed, Outcome: delivery.Failed}, false)
+	mon.finish_check(start)
+
+	code, body := get(mon, "/metrics")
+	if code != 200 {
+		t.Fatalf("got status %d", code)
+	}
+	expected := []string{
+		`text_me_when_fires_total{reminder_id="pills"} 1`,
+		`text_me_when_sends_total{channel="sms",reminder_id="pills"} 2`,
+		`text_me_when_failures_total{channel="sns_topic",reminder_id="pills"} 1`,
+		`text_me_when_retries_total{channel="sms",reminder_id="pills"} 1`,
+		`text_me_when_reminders_loaded 1`,
+		`text_me_when_next_fire_seconds{reminder_id="pills"} 59.75`,
+		`text_me_when_loop_lag_seconds_bucket{le="0.5"} 1`,
+		`text_me_when_loop_lag_seconds_sum 0.25`,
+		`text_me_when_check_duration_seconds_count 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics do not contain %s:\n%s", line, body)
+		}
+	}
+}
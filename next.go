@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/state"
+)
+
+// Implements the next command, which prints the next times at which each
+// reminder will be sent, along with any occurrences in between that will be
+// skipped because of an exclusion calendar.
+func run_next(args []string) int {
+	flag_set := flag.NewFlagSet("next", flag.ExitOnError)
+	flag_set.Usage = func() {
+		usage_header := "Usage: %s next [OPTIONS]\n" +
+			"\n" +
+			"  Prints the next times at which each reminder will be sent, and the\n" +
+			"  occurrences that will be skipped because of an exclusion calendar.\n" +
+			"\n" +
+			"Options:\n"
+		fmt.Fprintf(flag_set.Output(), usage_header, os.Args[0])
+		flag_set.PrintDefaults()
+	}
+	reminders_path := flag_set.String("c", "/etc/text-me-when.json", "The path to the reminders config file or directory")
+	tags := flag_set.String("tags", "", "Only show reminders that have at least one of these comma-separated tags")
+	id := flag_set.String("id", "", "Only show the reminder with this ID")
+	count := flag_set.Int("n", 5, "The number of times to show for each reminder")
+	state_path := flag_set.String("s", "/var/lib/text-me-when/state.json", "The path to the state file")
+	from := flag_set.String("from", "", "Show times after this RFC 3339 time instead of after now")
+	flag_set.Parse(args)
+	if flag_set.NArg() != 0 || *count < 1 {
+		flag_set.Usage()
+		return 1
+	}
+	after := time.Now()
+	if *from != "" {
+		parsed, err := time.Parse(time.RFC3339, *from)
+		if err != nil {
+			fmt.Printf("Failed to parse -from: %s\n", err)
+			return 1
+		}
+		after = parsed
+	}
+
+	reminder_list, err := load_reminders(*reminders_path)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	st, err := state.Load(*state_path)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	tag_list := parse_tags(*tags)
+	first := true
+	for _, r := range reminder_list {
+		if !r.Enabled || !r.HasAnyTag(tag_list) || (*id != "" && r.ID != *id) {
+			continue
+		}
+		if !first {
+			fmt.Println()
+		}
+		first = false
+		fmt.Printf("%s:\n", r.ID)
+		sent_count := st.Count(r.ID)
+		if expired, reason := r.Expired(after, sent_count); expired {
+			fmt.Printf("  expired: %s\n", reason)
+			continue
+		}
+		limit := *count
+		remaining := r.MaxCount - sent_count
+		if r.MaxCount > 0 && remaining < limit {
+			limit = remaining
+		}
+		occurrences := r.Occurrences(after, limit)
+		if len(occurrences) == 0 {
+			fmt.Printf("  not sent in the next year\n")
+		}
+		layout := "Mon 2006-01-02 15:04 MST"
+		if r.UsesSeconds() {
+			layout = "Mon 2006-01-02 15:04:05 MST"
+		}
+		fired := 0
+		for _, occurrence := range occurrences {
+			formatted := occurrence.Time.In(r.Location).Format(layout)
+			if occurrence.Skipped {
+				fmt.Printf("  %s  skipped: %s\n", formatted, occurrence.Reason)
+				continue
+			}
+			fmt.Printf("  %s\n", formatted)
+			fired = fired + 1
+		}
+		if r.MaxCount > 0 && fired == remaining {
+			fmt.Printf("  max_count (%d) reached\n", r.MaxCount)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,371 @@
+package reminder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A Calendar is a named set of days, such as public holidays or a vacation,
+// on which reminders that exclude it are not sent. Calendars are defined
+// under the top-level "calendars" key of a config, and are made of any
+// combination of:
+//
+// "dates": a list of single dates ("2021-12-25").
+//
+// "ranges": a list of maps with "from" and "to" dates (both inclusive) and
+// an optional "name".
+//
+// "rules": a list of date rules, such as "easter +1d" for Easter Monday. Each
+// excludes the day it gives in every year. See ParseDateRule.
+//
+// "ics_file": the path to a local iCalendar (.ics) file. Every event in it
+// excludes the days that it covers. Relative paths are relative to the
+// directory of the config file. Recurrence rules are not supported, so only
+// the first occurrence of a recurring event is excluded.
+//
+// Days are compared in the time zone of the reminder that is being checked.
+type Calendar struct {
+	Name    string
+	Source  string
+	Entries []CalendarEntry
+	Rules   []*DateRule
+}
+
+// A CalendarEntry is a range of days in a Calendar. From and To are
+// inclusive and are given as midnight UTC on their respective days.
+type CalendarEntry struct {
+	From  time.Time
+	To    time.Time
+	Label string
+}
+
+// Tells the caller whether the day of current_time, in current_time's time
+// zone, is in the Calendar. If it is, a reason that names the Calendar and the
+// matching entry is returned as well.
+func (c *Calendar) Match(current_time time.Time) (bool, string) {
+	day := civilDate(current_time)
+	for _, entry := range c.Entries {
+		if !day.Before(entry.From) && !day.After(entry.To) {
+			return true, fmt.Sprintf("calendar \"%s\": %s", c.Name, entry.Label)
+		}
+	}
+	for _, rule := range c.Rules {
+		if rule.On(day) {
+			return true, fmt.Sprintf("calendar \"%s\": %s", c.Name, rule.Describe())
+		}
+	}
+	return false, ""
+}
+
+// Returns midnight UTC on the day of t in t's time zone. This lets days be
+// compared without regard to time zones.
+func civilDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Parses a single calendar, as decoded from any config format. base_dir is
+// the directory that a relative "ics_file" path is relative to.
+func parseCalendar(name string, i interface{}, base_dir string) (*Calendar, error) {
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse calendar into a map")
+	}
+	c := &Calendar{Name: name, Entries: make([]CalendarEntry, 0)}
+	for key, value := range obj_map {
+		switch key {
+		case "dates":
+			dates, err := stringList(key, value)
+			if err != nil {
+				return nil, err
+			}
+			for _, date := range dates {
+				day, err := time.Parse("2006-01-02", date)
+				if err != nil {
+					return nil, fmt.Errorf("\"%s\" is not a date (YYYY-MM-DD)", date)
+				}
+				c.Entries = append(c.Entries, CalendarEntry{From: day, To: day, Label: date})
+			}
+
+		case "ranges":
+			interface_list, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"ranges\" into a list")
+			}
+			for _, item := range interface_list {
+				entry, err := parseCalendarRange(item)
+				if err != nil {
+					return nil, err
+				}
+				c.Entries = append(c.Entries, entry)
+			}
+
+		case "rules":
+			raw_rules, err := stringList(key, value)
+			if err != nil {
+				return nil, err
+			}
+			for _, raw_rule := range raw_rules {
+				rule, err := ParseDateRule(raw_rule)
+				if err != nil {
+					return nil, err
+				}
+				c.Rules = append(c.Rules, rule)
+			}
+
+		case "ics_file":
+			path, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"ics_file\" into string")
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(base_dir, path)
+			}
+			entries, err := readICSFile(path)
+			if err != nil {
+				return nil, err
+			}
+			c.Entries = append(c.Entries, entries...)
+
+		default:
+			return nil, fmt.Errorf("the key \"%s\" is not a valid key", key)
+		}
+	}
+	return c, nil
+}
+
+// Parses a single item of a calendar's "ranges" list.
+func parseCalendarRange(i interface{}) (CalendarEntry, error) {
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return CalendarEntry{}, fmt.Errorf("failed to parse range into a map")
+	}
+	raw_dates := map[string]time.Time{}
+	label := ""
+	for key, value := range obj_map {
+		str_value, ok := stringValue(value)
+		if !ok {
+			return CalendarEntry{}, fmt.Errorf("failed to parse value of key \"%s\" into string", key)
+		}
+		switch key {
+		case "from", "to":
+			day, err := time.Parse("2006-01-02", str_value)
+			if err != nil {
+				return CalendarEntry{}, fmt.Errorf("\"%s\" is not a date (YYYY-MM-DD)", str_value)
+			}
+			raw_dates[key] = day
+		case "name":
+			label = str_value
+		default:
+			return CalendarEntry{}, fmt.Errorf("the key \"%s\" is not a valid key", key)
+		}
+	}
+	from, has_from := raw_dates["from"]
+	to, has_to := raw_dates["to"]
+	if !has_from || !has_to {
+		return CalendarEntry{}, fmt.Errorf("ranges must have both \"from\" and \"to\"")
+	}
+	if to.Before(from) {
+		return CalendarEntry{}, fmt.Errorf("range \"to\" is before \"from\"")
+	}
+	if label == "" {
+		label = fmt.Sprintf("%s to %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	return CalendarEntry{From: from, To: to, Label: label}, nil
+}
+
+// Reads the events in an iCalendar file into CalendarEntries. Only the
+// DTSTART, DTEND and SUMMARY properties of VEVENTs are used. As in the
+// iCalendar spec, a DTEND is exclusive, so a DTEND that is a date, or a time
+// at midnight, ends the event on the day before. An event without a DTEND
+// lasts one day.
+func readICSFile(path string) ([]CalendarEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ics file: %w", err)
+	}
+	defer file.Close()
+
+	// unfold lines: a line starting with a space or tab continues the previous one
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] = lines[len(lines)-1] + line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ics file: %w", err)
+	}
+
+	entries := make([]CalendarEntry, 0)
+	in_event := false
+	var start, end time.Time
+	var end_at_midnight bool
+	summary := ""
+	for number, line := range lines {
+		name, value := splitICSLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			in_event = true
+			start, end, end_at_midnight, summary = time.Time{}, time.Time{}, false, ""
+		case name == "END" && value == "VEVENT":
+			in_event = false
+			if start.IsZero() {
+				return nil, fmt.Errorf("%s: event ending on line %d has no DTSTART", path, number+1)
+			}
+			to := start
+			if !end.IsZero() {
+				to = end
+				if end_at_midnight && end.After(start) {
+					to = end.AddDate(0, 0, -1)
+				}
+			}
+			if summary == "" {
+				summary = start.Format("2006-01-02")
+			}
+			entries = append(entries, CalendarEntry{From: start, To: to, Label: summary})
+		case in_event && name == "DTSTART":
+			start, _, err = parseICSDate(value, icsTZID(line))
+			if err != nil {
+				return nil, fmt.Errorf("%s: line %d: %w", path, number+1, err)
+			}
+		case in_event && name == "DTEND":
+			end, end_at_midnight, err = parseICSDate(value, icsTZID(line))
+			if err != nil {
+				return nil, fmt.Errorf("%s: line %d: %w", path, number+1, err)
+			}
+		case in_event && name == "SUMMARY":
+			summary = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`).Replace(value)
+		}
+	}
+	return entries, nil
+}
+
+// Splits an unfolded iCalendar content line into its property name, without
+// parameters, and its value.
+func splitICSLine(line string) (string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return "", ""
+	}
+	name := line[:colon]
+	if semicolon := strings.Index(name, ";"); semicolon >= 0 {
+		name = name[:semicolon]
+	}
+	return strings.ToUpper(name), line[colon+1:]
+}
+
+// Returns the value of the TZID parameter of an unfolded iCalendar content
+// line, such as "America/New_York" for "DTEND;TZID=America/New_York:...", or
+// "" if it has none.
+func icsTZID(line string) string {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return ""
+	}
+	for _, param := range strings.Split(line[:colon], ";")[1:] {
+		if strings.HasPrefix(strings.ToUpper(param), "TZID=") {
+			return strings.Trim(param[len("TZID="):], `"`)
+		}
+	}
+	return ""
+}
+
+// Parses an iCalendar DATE ("20211225") or DATE-TIME ("20211225T090000Z")
+// value into midnight UTC of its day, and tells the caller whether it is at
+// the start of that day: always for a DATE, and for a DATE-TIME at 00:00. A
+// DATE-TIME in UTC, or in the time zone tzid, is taken to be on its day in
+// the local time zone; one without either, or with a tzid that isn't known,
+// is on the day that it gives.
+func parseICSDate(value string, tzid string) (time.Time, bool, error) {
+	if len(value) == 8 {
+		day, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("\"%s\" is not a valid iCalendar date", value)
+		}
+		return day, true, nil
+	}
+	location, zoned := time.UTC, strings.HasSuffix(value, "Z")
+	if tz, err := time.LoadLocation(tzid); tzid != "" && !zoned && err == nil {
+		location, zoned = tz, true
+	}
+	date_time, err := time.ParseInLocation("20060102T150405", strings.TrimSuffix(value, "Z"), location)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("\"%s\" is not a valid iCalendar date", value)
+	}
+	if zoned {
+		date_time = date_time.In(time.Local)
+	}
+	day := time.Date(date_time.Year(), date_time.Month(), date_time.Day(), 0, 0, 0, 0, time.UTC)
+	midnight := date_time.Hour() == 0 && date_time.Minute() == 0 && date_time.Second() == 0
+	return day, midnight, nil
+}
+
+// ExcludedTrigger wraps a Trigger of any type that has an "exclude" key in the
+// config. It runs when the wrapped Trigger runs, except on days that are in
+// any of its Calendars. The Calendars are looked up by name once all config
+// files have been loaded.
+type ExcludedTrigger struct {
+	Trigger
+	CalendarNames []string
+	Calendars     []*Calendar
+}
+
+// Given a time as a time.Time object, tells the caller whether the
+// ExcludedTrigger should run at this time.
+func (et *ExcludedTrigger) ShouldRun(current_time time.Time) bool {
+	skipped, _ := et.Skipped(current_time)
+	return !skipped && et.Trigger.ShouldRun(current_time)
+}
+
+// Tells the caller whether the wrapped Trigger would run at current_time but
+// is suppressed by one of the Calendars, and if so, why.
+func (et *ExcludedTrigger) Skipped(current_time time.Time) (bool, string) {
+	if !et.Trigger.ShouldRun(current_time) {
+		return false, ""
+	}
+	return matchCalendars(et.Calendars, current_time)
+}
+
+// Tells the caller whether the wrapped Trigger uses seconds.
+func (et *ExcludedTrigger) UsesSeconds() bool {
+	return triggerUsesSeconds(et.Trigger)
+}
+
+// Returns an English description of when the ExcludedTrigger runs.
+func (et *ExcludedTrigger) Describe() string {
+	return et.Trigger.Describe() + " " + describeExclusions(et.CalendarNames)
+}
+
+// ExcludedTriggers are created by the loader rather than from a trigger_type,
+// so they cannot be parsed directly.
+func (et *ExcludedTrigger) ParseTriggerFromInterfaceMap(obj_map map[string]interface{}) error {
+	return fmt.Errorf("ExcludedTrigger cannot be parsed directly")
+}
+
+// Returns true and a reason if current_time is in any of calendars.
+func matchCalendars(calendars []*Calendar, current_time time.Time) (bool, string) {
+	for _, calendar := range calendars {
+		if matched, reason := calendar.Match(current_time); matched {
+			return true, reason
+		}
+	}
+	return false, ""
+}
+
+// Describes a list of excluded calendars, for example
+// "except on days in calendars holidays or vacation".
+func describeExclusions(calendar_names []string) string {
+	if len(calendar_names) == 1 {
+		return "except on days in calendar " + calendar_names[0]
+	}
+	return "except on days in calendars " + joinEnglish(calendar_names, "or")
+}
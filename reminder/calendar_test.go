@@ -0,0 +1,195 @@
+package reminder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testICSFile = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20211225\r\n" +
+	"DTEND;VALUE=DATE:20211226\r\n" +
+	"SUMMARY:Christmas\r\n" +
+	" Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20211227T000000Z\r\n" +
+	"DTEND:20211228T235959Z\r\n" +
+	"SUMMARY:Boxing Day\\, observed\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+const testCalendarConfig = `
+calendars:
+  holidays:
+    ics_file: holidays.ics
+    dates: ["2022-01-03"]
+reminders:
+  - version: v2
+    id: standup
+    exclude: [vacation]
+    message: Standup
+    triggers:
+      - {trigger_type: cron, minute: 55, hour: 9, day_of_month: "*", month: "*", day_of_week: "1,2,3,4,5", exclude: [holidays]}
+`
+
+const testVacationConfig = `
+calendars:
+  vacation:
+    ranges:
+      - {from: "2021-12-30", to: "2021-12-31", name: ski trip}
+`
+
+func TestCalendarExclusions(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"holidays.ics":  testICSFile,
+		"standup.yaml":  testCalendarConfig,
+		"vacation.yaml": testVacationConfig,
+	})
+	defer os.RemoveAll(dir)
+
+	reminder_list, err := Load(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	r.Location = time.UTC
+
+	expected := []Occurrence{
+		Occurrence{Time: time.Date(2021, time.December, 24, 9, 55, 0, 0, time.UTC)},
+		Occurrence{Time: time.Date(2021, time.December, 27, 9, 55, 0, 0, time.UTC), Skipped: true,
+			Reason: "calendar \"holidays\": Boxing Day, observed"},
+		Occurrence{Time: time.Date(2021, time.December, 28, 9, 55, 0, 0, time.UTC), Skipped: true,
+			Reason: "calendar \"holidays\": Boxing Day, observed"},
+		Occurrence{Time: time.Date(2021, time.December, 29, 9, 55, 0, 0, time.UTC)},
+		Occurrence{Time: time.Date(2021, time.December, 30, 9, 55, 0, 0, time.UTC), Skipped: true,
+			Reason: "calendar \"vacation\": ski trip"},
+		Occurrence{Time: time.Date(2021, time.December, 31, 9, 55, 0, 0, time.UTC), Skipped: true,
+			Reason: "calendar \"vacation\": ski trip"},
+		Occurrence{Time: time.Date(2022, time.January, 3, 9, 55, 0, 0, time.UTC), Skipped: true,
+			Reason: "calendar \"holidays\": 2022-01-03"},
+		Occurrence{Time: time.Date(2022, time.January, 4, 9, 55, 0, 0, time.UTC)},
+	}
+	occurrences := r.Occurrences(time.Date(2021, time.December, 24, 0, 0, 0, 0, time.UTC), 3)
+	if len(occurrences) != len(expected) {
+		t.Fatalf("got occurrences %v (%v expected)", occurrences, expected)
+	}
+	for i, occurrence := range occurrences {
+		if !occurrence.Time.Equal(expected[i].Time) || occurrence.Skipped != expected[i].Skipped ||
+			occurrence.Reason != expected[i].Reason {
+			t.Errorf("got occurrence %v (%v expected)", occurrence, expected[i])
+		}
+	}
+
+	next_run, ok := r.NextRun(time.Date(2021, time.December, 25, 0, 0, 0, 0, time.UTC))
+	if !ok || !next_run.Equal(time.Date(2021, time.December, 29, 9, 55, 0, 0, time.UTC)) {
+		t.Errorf("got next run %s", next_run)
+	}
+}
+
+func TestSkippedOccurrencesCapped(t *testing.T) {
+	config := `
+calendars:
+  vacation: {ranges: [{from: "2021-12-20", to: "2021-12-31"}]}
+reminders:
+  - version: v2
+    exclude: [vacation]
+    timezone: UTC
+    triggers:
+      - {trigger_type: cron, minute: "*", hour: "*", day_of_month: "*", month: "*", day_of_week: "*"}
+`
+	reminder_list, err := ParseConfig([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	occurrences := r.Occurrences(time.Date(2021, time.December, 20, 0, 0, 0, 0, time.UTC), 1)
+	if len(occurrences) != MaxSkippedOccurrences+1 {
+		t.Fatalf("got %d occurrences (%d expected)", len(occurrences), MaxSkippedOccurrences+1)
+	}
+	last := occurrences[len(occurrences)-1]
+	if last.Skipped || !last.Time.Equal(time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got last occurrence %v (2022-01-01 00:00 expected)", last)
+	}
+}
+
+func TestParseICSDate(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+	time.Local, _ = time.LoadLocation("America/New_York")
+
+	test_cases := []struct {
+		value    string
+		tzid     string
+		day      int
+		midnight bool
+	}{
+		{"20211228", "", 28, true},
+		{"20211228T000000", "", 28, true},
+		{"20211228T093000", "", 28, false},
+		// UTC times are on their New York day
+		{"20211228T030000Z", "", 27, false},
+		{"20211228T050000Z", "", 28, true},
+		{"20211228T000000", "America/New_York", 28, true},
+		{"20211228T000000", "Europe/Berlin", 27, false},
+		{"20211228T000000", "Eastern Standard Time", 28, true},
+	}
+	for _, test_case := range test_cases {
+		day, midnight, err := parseICSDate(test_case.value, test_case.tzid)
+		expected := time.Date(2021, time.December, test_case.day, 0, 0, 0, 0, time.UTC)
+		if err != nil || !day.Equal(expected) || midnight != test_case.midnight {
+			t.Errorf("%s with TZID \"%s\" gave %s, %t and error %v (%s and %t expected)", test_case.value,
+				test_case.tzid, day, midnight, err, expected, test_case.midnight)
+		}
+	}
+
+	// a timed event that ends at midnight doesn't cover the next day
+	ics := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n" +
+		"DTSTART;TZID=America/New_York:20211224T180000\r\n" +
+		"DTEND;TZID=America/New_York:20211225T000000\r\n" +
+		"SUMMARY:Party\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	dir := writeConfigDir(t, map[string]string{"party.ics": ics})
+	defer os.RemoveAll(dir)
+	entries, err := readICSFile(filepath.Join(dir, "party.ics"))
+	christmas_eve := time.Date(2021, time.December, 24, 0, 0, 0, 0, time.UTC)
+	if err != nil || len(entries) != 1 || !entries[0].From.Equal(christmas_eve) || !entries[0].To.Equal(christmas_eve) {
+		t.Errorf("got entries %v and error %v (only December 24 expected)", entries, err)
+	}
+}
+
+func TestCalendarAbnormal(t *testing.T) {
+	test_cases := []string{
+		// undefined calendar
+		"reminders:\n  - {version: v2, exclude: [nope]}\n",
+		"reminders:\n  - {version: v2, triggers: [{trigger_type: any, triggers: [{trigger_type: cron, exclude: [nope]}]}]}\n",
+		// bad dates and ranges
+		"calendars:\n  c: {dates: [\"2021-13-01\"]}\n",
+		"calendars:\n  c: {ranges: [{from: \"2021-12-02\", to: \"2021-12-01\"}]}\n",
+		"calendars:\n  c: {ranges: [{from: \"2021-12-02\"}]}\n",
+		"calendars:\n  c: {ics_file: does-not-exist.ics}\n",
+		"calendars:\n  c: {weekdays: [1]}\n",
+	}
+	for _, config := range test_cases {
+		if _, err := ParseConfig([]byte(config), "yaml"); err == nil {
+			t.Errorf("no error when there should have been with config %q", config)
+		}
+	}
+}
+
+func TestLoadDirectoryDuplicateCalendars(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"a.yaml": testVacationConfig,
+		"b.yaml": testVacationConfig,
+	})
+	defer os.RemoveAll(dir)
+
+	if _, err := Load(dir); err == nil {
+		t.Error("no error for calendar defined in two files")
+	}
+	if _, err := LoadFile(filepath.Join(dir, "a.yaml")); err != nil {
+		t.Errorf("got unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,168 @@
+package reminder
+
+import (
+	"fmt"
+	"time"
+)
+
+// CompositeTrigger is a type of Trigger that combines other Triggers. Its
+// child Triggers are listed under the "triggers" key and may be of any type,
+// including CompositeTrigger. There are three kinds, chosen by trigger_type:
+//
+// "all": runs when every one of its child Triggers would run.
+//
+// "any": runs when at least one of its child Triggers would run.
+//
+// "not": runs when none of its child Triggers would run.
+//
+// For example, "every weekday at 9 except during December" is an "all" trigger
+// whose children are a cron trigger for weekdays at 9 and a "not" trigger
+// containing a cron trigger for December.
+type CompositeTrigger struct {
+	triggerType string
+	Triggers    []Trigger
+}
+
+func init() {
+	for _, trigger_type := range []string{"all", "any", "not"} {
+		trigger_type := trigger_type
+		RegisterTriggerType(trigger_type, func() Trigger {
+			return &CompositeTrigger{triggerType: trigger_type}
+		})
+	}
+}
+
+// Creates a new CompositeTrigger. trigger_type must be "all", "any" or "not".
+func NewCompositeTrigger(trigger_type string, triggers ...Trigger) (*CompositeTrigger, error) {
+	if trigger_type != "all" && trigger_type != "any" && trigger_type != "not" {
+		return nil, fmt.Errorf("trigger type \"%s\" is not a composite trigger type", trigger_type)
+	}
+	if len(triggers) == 0 {
+		return nil, fmt.Errorf("a composite trigger must have at least one child trigger")
+	}
+	return &CompositeTrigger{triggerType: trigger_type, Triggers: triggers}, nil
+}
+
+// Returns the type of the Trigger.
+func (ct *CompositeTrigger) TriggerType() string {
+	return ct.triggerType
+}
+
+// Given a time as a time.Time object, tells the caller whether the
+// CompositeTrigger should run at this time.
+func (ct *CompositeTrigger) ShouldRun(current_time time.Time) bool {
+	switch ct.triggerType {
+	case "all":
+		for _, trigger := range ct.Triggers {
+			if !trigger.ShouldRun(current_time) {
+				return false
+			}
+		}
+		return len(ct.Triggers) > 0
+	case "any":
+		for _, trigger := range ct.Triggers {
+			if trigger.ShouldRun(current_time) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		for _, trigger := range ct.Triggers {
+			if trigger.ShouldRun(current_time) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// Tells the caller whether any of the child Triggers uses seconds. If one
+// does, the other children match every second of the minutes they match.
+func (ct *CompositeTrigger) UsesSeconds() bool {
+	for _, trigger := range ct.Triggers {
+		if triggerUsesSeconds(trigger) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns an English description of when the CompositeTrigger runs, for
+// example "at 09:00 on Monday and Friday except every day in December".
+func (ct *CompositeTrigger) Describe() string {
+	switch ct.triggerType {
+	case "all":
+		positives := make([]string, 0, len(ct.Triggers))
+		negatives := make([]string, 0)
+		for _, trigger := range ct.Triggers {
+			if child, ok := trigger.(*CompositeTrigger); ok && child.triggerType == "not" {
+				negatives = append(negatives, describeChildren(child.Triggers)...)
+				continue
+			}
+			positives = append(positives, describeChild(trigger, len(ct.Triggers) > 1))
+		}
+		if len(positives) == 0 {
+			positives = append(positives, "every minute")
+		}
+		description := joinEnglish(positives, "and")
+		if len(negatives) > 0 {
+			description = description + " except " + joinEnglish(negatives, "or")
+		}
+		return description
+	case "any":
+		return joinEnglish(describeChildren(ct.Triggers), "or")
+	case "not":
+		return "every minute except " + joinEnglish(describeChildren(ct.Triggers), "or")
+	default:
+		return "never"
+	}
+}
+
+// Parses a map[string]interface{} into a CompositeTrigger. Each child trigger
+// is parsed recursively according to its own trigger_type.
+func (ct *CompositeTrigger) ParseTriggerFromInterfaceMap(obj_map map[string]interface{}) error {
+	for key, i := range obj_map {
+		switch key {
+		case "trigger_type":
+			value, ok := i.(string)
+			if !ok || (value != "all" && value != "any" && value != "not") {
+				return fmt.Errorf("trigger type \"%v\" is not a composite trigger type", i)
+			}
+			ct.triggerType = value
+		case "triggers":
+			triggers, err := parseTriggerList(i)
+			if err != nil {
+				return err
+			}
+			ct.Triggers = triggers
+		default:
+			return fmt.Errorf("the key \"%s\" is not a valid key", key)
+		}
+	}
+	if len(ct.Triggers) == 0 {
+		return fmt.Errorf("a composite trigger must have at least one child trigger")
+	}
+	return nil
+}
+
+// Describes each of triggers, bracketing the descriptions of any that are
+// themselves composite if there is more than one.
+func describeChildren(triggers []Trigger) []string {
+	descriptions := make([]string, 0, len(triggers))
+	for _, trigger := range triggers {
+		descriptions = append(descriptions, describeChild(trigger, len(triggers) > 1))
+	}
+	return descriptions
+}
+
+// Describes trigger, bracketing the description if bracket is true and trigger
+// is composite so that it is not confused with the parts around it.
+func describeChild(trigger Trigger, bracket bool) string {
+	description := trigger.Describe()
+	if _, ok := trigger.(*CompositeTrigger); ok && bracket {
+		return "(" + description + ")"
+	}
+	return description
+}
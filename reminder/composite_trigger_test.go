@@ -0,0 +1,84 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+const testCompositeConfig = `
+- version: v2
+  message: standup
+  triggers:
+    - trigger_type: all
+      triggers:
+        - {trigger_type: cron, minute: 0, hour: 9, day_of_month: "*", month: "*", day_of_week: "1,2,3,4,5"}
+        - trigger_type: not
+          triggers:
+            - {trigger_type: cron, minute: "*", hour: "*", day_of_month: "*", month: 12, day_of_week: "*"}
+`
+
+func TestCompositeTrigger(t *testing.T) {
+	reminder_list, err := ParseConfig([]byte(testCompositeConfig), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+
+	test_cases := map[time.Time]bool{
+		// Monday in November at 09:00
+		time.Date(2021, time.November, 29, 9, 0, 0, 0, time.Local): true,
+		// Saturday in November at 09:00
+		time.Date(2021, time.November, 27, 9, 0, 0, 0, time.Local): false,
+		// Monday in November at 10:00
+		time.Date(2021, time.November, 29, 10, 0, 0, 0, time.Local): false,
+		// Wednesday in December at 09:00
+		time.Date(2021, time.December, 1, 9, 0, 0, 0, time.Local): false,
+	}
+	for test_time, expected := range test_cases {
+		if r.ShouldRun(test_time) != expected {
+			t.Errorf("ShouldRun returned %t at %s (%t expected)", !expected, test_time, expected)
+		}
+	}
+
+	expected := "at 09:00 on Monday, Tuesday, Wednesday, Thursday and Friday except every minute every day in December"
+	if r.Describe() != expected {
+		t.Errorf("got description \"%s\" (\"%s\" expected)", r.Describe(), expected)
+	}
+}
+
+func TestCompositeTriggerAny(t *testing.T) {
+	first := getCronTrigger(t, "0", "9", "*", "*", "*")
+	second := getCronTrigger(t, "0", "17", "*", "*", "*")
+	ct, err := NewCompositeTrigger("any", first, second)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	for _, hour := range []int{9, 17} {
+		if !ct.ShouldRun(time.Date(2021, time.January, 1, hour, 0, 0, 0, time.UTC)) {
+			t.Errorf("any trigger did not run at hour %d", hour)
+		}
+	}
+	if ct.ShouldRun(time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Error("any trigger ran at hour 12")
+	}
+	if ct.Describe() != "at 09:00 or at 17:00" {
+		t.Errorf("got description \"%s\"", ct.Describe())
+	}
+}
+
+func TestCompositeTriggerAbnormal(t *testing.T) {
+	test_cases := []string{
+		`[{"version": "v2", "triggers": [{"trigger_type": "all"}]}]`,
+		`[{"version": "v2", "triggers": [{"trigger_type": "any", "triggers": []}]}]`,
+		`[{"version": "v2", "triggers": [{"trigger_type": "not", "triggers": [{"trigger_type": "nope"}]}]}]`,
+		`[{"version": "v2", "triggers": [{"trigger_type": "all", "triggers": [], "extra": 1}]}]`,
+	}
+	for _, config := range test_cases {
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with config %s", config)
+		}
+	}
+	if _, err := NewCompositeTrigger("xor", &CronTrigger{}); err == nil {
+		t.Error("no error for composite trigger type \"xor\"")
+	}
+}
@@ -0,0 +1,286 @@
+package reminder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultConditionTimeout is how long a Condition's command may run for if
+// the Condition does not give a timeout.
+const DefaultConditionTimeout = 10 * time.Second
+
+// MaxCommandTimeout is the longest timeout that a Condition or a
+// MessageCommand may give. Their commands are run between the minute ticks of
+// the scheduler, so a reminder's condition and message command together must
+// finish well within a minute.
+const MaxCommandTimeout = 20 * time.Second
+
+// A Condition is a check that is made when a reminder's Triggers say that it
+// should be sent. The reminder is only sent if the Condition holds. It is
+// given under a reminder's "condition" key, and is either a command or a file
+// test:
+//
+// "command": a command to run, either as a list of arguments or as a string
+// that is run with /bin/sh -c. The Condition holds if the command exits with
+// status 0.
+//
+// "timeout": how long the command may run for, such as "5s". Defaults to 10
+// seconds, and may be at most MaxCommandTimeout. A command that runs for
+// longer is killed and the Condition does not hold.
+//
+// "path": a file or directory. The Condition holds if it exists.
+//
+// "older_than" and "newer_than": durations, such as "3d" or "12h", that the
+// time since the file at path was last modified must be longer or shorter
+// than. The Condition does not hold if the file does not exist.
+//
+// "negate": if true, the Condition holds when the command or file test fails
+// instead. A command that cannot be run or times out never holds.
+type Condition struct {
+	Command   []string
+	Timeout   time.Duration
+	Path      string
+	OlderThan time.Duration
+	NewerThan time.Duration
+	Negate    bool
+}
+
+// Checks whether the Condition holds at current_time. The returned string
+// says what was found, for logging next to the send.
+func (c *Condition) Evaluate(current_time time.Time) (bool, string) {
+	var passed bool
+	var detail string
+	if len(c.Command) > 0 {
+		var err error
+		passed, detail, err = c.runCommand()
+		if err != nil {
+			return false, err.Error()
+		}
+	} else {
+		passed, detail = c.testPath(current_time)
+	}
+	if c.Negate {
+		return !passed, detail
+	}
+	return passed, detail
+}
+
+// Runs the command and tells the caller whether it exited with status 0. An
+// error is returned if the command could not be run or timed out.
+func (c *Condition) runCommand() (bool, string, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultConditionTimeout
+	}
+	err := runWithTimeout(c.Command, timeout, nil, nil)
+	var exit_error *exec.ExitError
+	if errors.As(err, &exit_error) {
+		return false, fmt.Sprintf("command %s exited with status %d", quoteCommand(c.Command),
+			exit_error.ExitCode()), nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, fmt.Sprintf("command %s exited with status 0", quoteCommand(c.Command)), nil
+}
+
+// Runs command, killing it if it is still running after timeout. env is the
+// command's environment; if it is nil, the command gets text-me-when's own.
+// stdout is where the command's output goes, and may be nil to discard it. If
+// the command exits with a status other than 0, the returned error is an
+// *exec.ExitError.
+func runWithTimeout(command []string, timeout time.Duration, env []string, stdout *os.File) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = env
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command %s timed out after %s", quoteCommand(command), timeout)
+	}
+	var exit_error *exec.ExitError
+	if err != nil && !errors.As(err, &exit_error) {
+		return fmt.Errorf("command %s could not be run: %w", quoteCommand(command), err)
+	}
+	return err
+}
+
+// Tests the file at c.Path.
+func (c *Condition) testPath(current_time time.Time) (bool, string) {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, fmt.Sprintf("%s does not exist", c.Path)
+		}
+		return false, fmt.Sprintf("%s could not be checked: %s", c.Path, err)
+	}
+	if c.OlderThan == 0 && c.NewerThan == 0 {
+		return true, fmt.Sprintf("%s exists", c.Path)
+	}
+	age := current_time.Sub(info.ModTime()).Truncate(time.Second)
+	detail := fmt.Sprintf("%s was modified %s ago", c.Path, age)
+	if c.OlderThan != 0 && age <= c.OlderThan {
+		return false, detail
+	}
+	if c.NewerThan != 0 && age >= c.NewerThan {
+		return false, detail
+	}
+	return true, detail
+}
+
+// Returns an English description of the Condition, for example
+// "/var/lib/plants/watered was modified more than 72h0m0s ago".
+func (c *Condition) Describe() string {
+	if len(c.Command) > 0 {
+		if c.Negate {
+			return fmt.Sprintf("command %s fails", quoteCommand(c.Command))
+		}
+		return fmt.Sprintf("command %s succeeds", quoteCommand(c.Command))
+	}
+	tests := make([]string, 0, 2)
+	if c.OlderThan != 0 {
+		tests = append(tests, "more than "+c.OlderThan.String()+" ago")
+	}
+	if c.NewerThan != 0 {
+		tests = append(tests, "less than "+c.NewerThan.String()+" ago")
+	}
+	switch {
+	case len(tests) == 0 && c.Negate:
+		return fmt.Sprintf("%s does not exist", c.Path)
+	case len(tests) == 0:
+		return fmt.Sprintf("%s exists", c.Path)
+	case c.Negate:
+		return fmt.Sprintf("%s was not modified %s", c.Path, joinEnglish(tests, "and"))
+	default:
+		return fmt.Sprintf("%s was modified %s", c.Path, joinEnglish(tests, "and"))
+	}
+}
+
+// Returns command quoted for messages, for example "mountpoint -q /mnt".
+func quoteCommand(command []string) string {
+	if len(command) == 3 && command[0] == "/bin/sh" && command[1] == "-c" {
+		return strconv.Quote(command[2])
+	}
+	return strconv.Quote(strings.Join(command, " "))
+}
+
+// Parses the value of a "command" key, which is either a list of arguments or
+// a string that is run with /bin/sh -c.
+func parseCommand(key string, value interface{}) ([]string, error) {
+	if command, ok := value.(string); ok {
+		if command == "" {
+			return nil, fmt.Errorf("%s must not be empty", key)
+		}
+		return []string{"/bin/sh", "-c", command}, nil
+	}
+	command, err := stringList(key, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(command) == 0 {
+		return nil, fmt.Errorf("%s must not be empty", key)
+	}
+	return command, nil
+}
+
+// Parses the value of a reminder's "condition" key into a Condition.
+func parseCondition(i interface{}) (*Condition, error) {
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value of key \"condition\" into a map")
+	}
+	c := &Condition{}
+	for key, value := range obj_map {
+		switch key {
+		case "command":
+			command, err := parseCommand(key, value)
+			if err != nil {
+				return nil, err
+			}
+			c.Command = command
+		case "path":
+			path, ok := value.(string)
+			if !ok || path == "" {
+				return nil, fmt.Errorf("failed to parse value of key \"path\" into non-empty string")
+			}
+			c.Path = path
+		case "timeout":
+			timeout, err := parseTimeout(value)
+			if err != nil {
+				return nil, err
+			}
+			c.Timeout = timeout
+		case "older_than", "newer_than":
+			str_value, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"%s\" into string", key)
+			}
+			duration, err := parseLongDuration(str_value)
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("%s \"%s\" is not a positive duration like \"12h\" or \"3d\"", key, str_value)
+			}
+			if key == "older_than" {
+				c.OlderThan = duration
+			} else {
+				c.NewerThan = duration
+			}
+		case "negate":
+			negate, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"negate\" into bool")
+			}
+			c.Negate = negate
+		default:
+			return nil, fmt.Errorf("the key \"%s\" is not a valid condition key", key)
+		}
+	}
+	if (len(c.Command) > 0) == (c.Path != "") {
+		return nil, fmt.Errorf("a condition must have exactly one of \"command\" and \"path\"")
+	}
+	if c.Path == "" && (c.OlderThan != 0 || c.NewerThan != 0) {
+		return nil, fmt.Errorf("older_than and newer_than need a path")
+	}
+	if len(c.Command) == 0 && c.Timeout != 0 {
+		return nil, fmt.Errorf("timeout needs a command")
+	}
+	return c, nil
+}
+
+// Parses the value of a command's "timeout" key, which must be a positive
+// duration of at most MaxCommandTimeout.
+func parseTimeout(value interface{}) (time.Duration, error) {
+	str_value, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("failed to parse value of key \"timeout\" into string")
+	}
+	timeout, err := time.ParseDuration(str_value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("timeout \"%s\" is not a positive duration like \"5s\"", str_value)
+	}
+	if timeout > MaxCommandTimeout {
+		return 0, fmt.Errorf("timeout %s is longer than the maximum of %s", timeout, MaxCommandTimeout)
+	}
+	return timeout, nil
+}
+
+// Parses a duration like time.ParseDuration does, but also accepts a whole
+// number of days, such as "3d".
+func parseLongDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("\"%s\" is not a number of days", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,139 @@
+package reminder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestCondition(t *testing.T, condition string) *Condition {
+	t.Helper()
+	c := parseTestReminder(t, "m", "condition", condition).Condition
+	if c == nil {
+		t.Fatalf("condition %s was not kept when upgrading to v2", condition)
+	}
+	return c
+}
+
+// Parses a v1 reminder with message whose key has the JSON value value, and
+// returns it upgraded to v2.
+func parseTestReminder(t *testing.T, message string, key string, value string) *ReminderV2 {
+	t.Helper()
+	config := `[{"version": "v1", "message": "` + message + `", "` + key + `": ` + value + `, "triggers": []}]`
+	reminder_list, err := ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error for %s %s: %s", key, value, err)
+	}
+	return &reminder_list[0]
+}
+
+func TestConditionCommand(t *testing.T) {
+	test_cases := map[string]bool{
+		`{"command": ["true"]}`:                   true,
+		`{"command": ["false"]}`:                  false,
+		`{"command": "exit 3"}`:                   false,
+		`{"command": "test 1 -eq 1"}`:             true,
+		`{"command": "exit 3", "negate": true}`:   true,
+		`{"command": ["true"], "negate": true}`:   false,
+		`{"command": ["no-such-command-exists"]}`: false,
+		// a command that cannot be run never holds, even when negated
+		`{"command": ["no-such-command-exists"], "negate": true}`: false,
+	}
+	for condition, expected := range test_cases {
+		holds, detail := parseTestCondition(t, condition).Evaluate(time.Now())
+		if holds != expected {
+			t.Errorf("condition %s gave %t (%t expected): %s", condition, holds, expected, detail)
+		}
+	}
+
+	holds, detail := parseTestCondition(t, `{"command": "exit 3"}`).Evaluate(time.Now())
+	if holds || detail != `command "exit 3" exited with status 3` {
+		t.Errorf("got detail \"%s\"", detail)
+	}
+}
+
+func TestConditionTimeout(t *testing.T) {
+	c := parseTestCondition(t, `{"command": ["sleep", "5"], "timeout": "100ms", "negate": true}`)
+	start := time.Now()
+	holds, detail := c.Evaluate(start)
+	if holds {
+		t.Error("condition held after the command timed out")
+	}
+	if !strings.Contains(detail, "timed out after 100ms") {
+		t.Errorf("got detail \"%s\" (timed out expected)", detail)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("command was not killed at its timeout")
+	}
+}
+
+func TestConditionPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "text-me-when-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "watered")
+	if err := ioutil.WriteFile(path, []byte{}, 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+	modified := time.Date(2021, time.March, 1, 9, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatalf("failed to set modification time: %s", err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	test_cases := []struct {
+		condition string
+		now       time.Time
+		expected  bool
+	}{
+		{`{"path": "` + path + `"}`, modified, true},
+		{`{"path": "` + missing + `"}`, modified, false},
+		{`{"path": "` + missing + `", "negate": true}`, modified, true},
+		{`{"path": "` + path + `", "older_than": "3d"}`, modified.AddDate(0, 0, 4), true},
+		{`{"path": "` + path + `", "older_than": "3d"}`, modified.AddDate(0, 0, 2), false},
+		{`{"path": "` + missing + `", "older_than": "3d"}`, modified.AddDate(0, 0, 4), false},
+		{`{"path": "` + path + `", "newer_than": "1h"}`, modified.Add(30 * time.Minute), true},
+		{`{"path": "` + path + `", "newer_than": "1h"}`, modified.Add(2 * time.Hour), false},
+	}
+	for _, test_case := range test_cases {
+		holds, detail := parseTestCondition(t, test_case.condition).Evaluate(test_case.now)
+		if holds != test_case.expected {
+			t.Errorf("condition %s at %s gave %t (%t expected): %s", test_case.condition, test_case.now,
+				holds, test_case.expected, detail)
+		}
+	}
+
+	c := parseTestCondition(t, `{"path": "`+path+`", "older_than": "3d"}`)
+	if c.Describe() != path+" was modified more than 72h0m0s ago" {
+		t.Errorf("got description \"%s\"", c.Describe())
+	}
+}
+
+func TestConditionAbnormal(t *testing.T) {
+	test_cases := []string{
+		`{}`,
+		`{"command": "true", "path": "/tmp"}`,
+		`{"command": ""}`,
+		`{"command": []}`,
+		`{"command": "true", "timeout": "soon"}`,
+		`{"command": "true", "timeout": "-1s"}`,
+		`{"command": "true", "timeout": "1m"}`,
+		`{"command": "true", "timeout": "1d"}`,
+		`{"command": "true", "older_than": "1d"}`,
+		`{"path": "/tmp", "timeout": "1s"}`,
+		`{"path": "/tmp", "negate": "yes"}`,
+		`{"path": "/tmp", "size": 10}`,
+		`"true"`,
+	}
+	for _, condition := range test_cases {
+		config := `[{"version": "v2", "condition": ` + condition + `}]`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with condition %s", condition)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package reminder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formats maps config file extensions to the format they are decoded with.
+var formats = map[string]string{
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "toml",
+}
+
+// Returns the config format for path based on its file extension.
+func FormatForPath(path string) (string, error) {
+	format, ok := formats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", fmt.Errorf("cannot tell config format of %s from its extension", path)
+	}
+	return format, nil
+}
+
+// Returns the config files that path refers to: path itself if it is a file,
+// or, if it is a directory (a "conf.d" directory), every file in it with a
+// supported extension, in lexical order. Hidden files and files with other
+// extensions are ignored.
+func ConfigFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if _, ok := formats[strings.ToLower(filepath.Ext(name))]; !ok {
+			continue
+		}
+		paths = append(paths, filepath.Join(path, name))
+	}
+	return paths, nil
+}
+
+// A Config is everything that is loaded from a reminders config: the
+// reminders themselves, the Recipients that have delivery settings, keyed by
+// phone number, and the Limits on the messages that are sent. Limits is nil
+// if no config file has any.
+type Config struct {
+	Reminders  []ReminderV2
+	Recipients map[string]*Recipient
+	Limits     *Limits
+}
+
+// Reads the reminders config at path, which is either a single config file or
+// a directory of them, and returns its reminders. See LoadConfig.
+func Load(path string) ([]ReminderV2, error) {
+	config, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return config.Reminders, nil
+}
+
+// Reads the reminders config at path, which is either a single config file or
+// a directory of them. The reminders, calendars and recipients in all of the
+// files returned by ConfigFiles are merged, so a reminder may exclude a
+// calendar that is defined in another file. Reminder IDs, calendar names and
+// recipients must be unique across all loaded files, and only one file may
+// have limits.
+func LoadConfig(path string) (*Config, error) {
+	paths, err := ConfigFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	reminder_list := make([]ReminderV2, 0)
+	calendars := map[string]*Calendar{}
+	recipients := map[string]*Recipient{}
+	var limits *Limits
+	for _, file_path := range paths {
+		config, err := loadConfigFile(file_path)
+		if err != nil {
+			return nil, err
+		}
+		reminder_list = append(reminder_list, config.reminders...)
+		for name, calendar := range config.calendars {
+			if existing, ok := calendars[name]; ok {
+				return nil, fmt.Errorf("calendar \"%s\" is defined in both %s and %s", name,
+					existing.Source, calendar.Source)
+			}
+			calendars[name] = calendar
+		}
+		for address, recipient := range config.recipients {
+			if existing, ok := recipients[address]; ok {
+				return nil, fmt.Errorf("recipient %s is defined in both %s and %s", address,
+					existing.Source, recipient.Source)
+			}
+			recipients[address] = recipient
+		}
+		if config.limits != nil {
+			if limits != nil {
+				return nil, fmt.Errorf("limits are defined in both %s and %s", limits.Source, file_path)
+			}
+			limits = config.limits
+		}
+	}
+	if err := checkDuplicateIDs(reminder_list); err != nil {
+		return nil, err
+	}
+	if err := resolveCalendars(reminder_list, calendars); err != nil {
+		return nil, err
+	}
+	return &Config{Reminders: reminder_list, Recipients: recipients, Limits: limits}, nil
+}
+
+// Returns an error naming the files involved if two reminders share an ID.
+func checkDuplicateIDs(reminder_list []ReminderV2) error {
+	sources := map[string]string{}
+	for _, r := range reminder_list {
+		if source, ok := sources[r.ID]; ok {
+			return fmt.Errorf("reminder id \"%s\" is defined in both %s and %s", r.ID, source, r.Source)
+		}
+		sources[r.ID] = r.Source
+	}
+	return nil
+}
+
+// Looks up the calendars that each reminder, and each of its triggers,
+// excludes by name.
+func resolveCalendars(reminder_list []ReminderV2, calendars map[string]*Calendar) error {
+	lookup := func(names []string) ([]*Calendar, error) {
+		found := make([]*Calendar, 0, len(names))
+		for _, name := range names {
+			calendar, ok := calendars[name]
+			if !ok {
+				return nil, fmt.Errorf("calendar \"%s\" is not defined", name)
+			}
+			found = append(found, calendar)
+		}
+		return found, nil
+	}
+	for i := range reminder_list {
+		r := &reminder_list[i]
+		found, err := lookup(r.Exclude)
+		if err != nil {
+			return fmt.Errorf("reminder %s (from %s): %w", r.ID, r.Source, err)
+		}
+		r.Calendars = found
+		err = walkTriggers(r.Triggers, func(trigger Trigger) error {
+			et, ok := trigger.(*ExcludedTrigger)
+			if !ok {
+				return nil
+			}
+			found, err := lookup(et.CalendarNames)
+			et.Calendars = found
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reminder %s (from %s): %w", r.ID, r.Source, err)
+		}
+	}
+	return nil
+}
+
+// Reads the reminders config file at path. The format of the file is picked
+// by its extension. Each returned reminder has its Source set to path.
+// Reminders without an ID are given one made from the file name and a digest
+// of their contents, for example "text-me-when.json#3f2a9c01", so that it stays
+// the same when other reminders are added or moved, and GeneratedID is set on
+// them. Reminders may only
+// exclude calendars that are defined in the same file; use Load to merge
+// several files.
+func LoadFile(path string) ([]ReminderV2, error) {
+	config, err := loadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveCalendars(config.reminders, config.calendars); err != nil {
+		return nil, err
+	}
+	return config.reminders, nil
+}
+
+// configFile holds the contents of a single config file, before the
+// calendars that its reminders exclude have been looked up.
+type configFile struct {
+	reminders  []ReminderV2
+	digests    []string
+	calendars  map[string]*Calendar
+	recipients map[string]*Recipient
+	limits     *Limits
+}
+
+// Reads and parses the config file at path without looking up calendars.
+func loadConfigFile(path string) (*configFile, error) {
+	format, err := FormatForPath(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	config, err := parseConfigFile(data, format, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	seen := map[string]int{}
+	for i := range config.reminders {
+		config.reminders[i].Source = path
+		if config.reminders[i].ID == "" {
+			id := filepath.Base(path) + "#" + config.digests[i]
+			// identical reminders are told apart by their order
+			seen[id]++
+			if seen[id] > 1 {
+				id = fmt.Sprintf("%s-%d", id, seen[id])
+			}
+			config.reminders[i].ID = id
+			config.reminders[i].GeneratedID = true
+			config.reminders[i].bindID()
+		}
+	}
+	for _, calendar := range config.calendars {
+		calendar.Source = path
+	}
+	for _, recipient := range config.recipients {
+		recipient.Source = path
+	}
+	if config.limits != nil {
+		config.limits.Source = path
+	}
+	return config, nil
+}
+
+// Parses a reminders config in the given format ("json", "yaml" or "toml").
+// Reminders of every version are upgraded to ReminderV2. The top level of the
+// config is either a list of reminders, or a map whose "reminders" key holds
+// that list, whose optional "calendars" key maps calendar names to Calendars,
+// whose optional "recipients" key maps phone numbers to Recipients, and whose
+// optional "limits" key holds the Limits. TOML configs must use the latter, for example as a [[reminders]]
+// array of tables. Relative "ics_file" paths are relative to the current
+// directory.
+func ParseConfig(data []byte, format string) ([]ReminderV2, error) {
+	config, err := parseConfigFile(data, format, ".")
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveCalendars(config.reminders, config.calendars); err != nil {
+		return nil, err
+	}
+	return config.reminders, nil
+}
+
+// Does the work of ParseConfig without looking up calendars. base_dir is the
+// directory that relative "ics_file" paths are relative to.
+func parseConfigFile(data []byte, format string, base_dir string) (*configFile, error) {
+	raw, err := decodeFormat(data, format)
+	if err != nil {
+		return nil, err
+	}
+	interface_list, err := reminderList(raw)
+	if err != nil {
+		return nil, err
+	}
+	config := &configFile{
+		reminders:  make([]ReminderV2, 0, len(interface_list)),
+		digests:    make([]string, 0, len(interface_list)),
+		calendars:  map[string]*Calendar{},
+		recipients: map[string]*Recipient{},
+	}
+	for i, item := range interface_list {
+		obj_map, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("reminder %d: failed to parse reminder into a map", i)
+		}
+		r, err := parseReminder(obj_map)
+		if err != nil {
+			return nil, fmt.Errorf("reminder %d: %w", i, err)
+		}
+		digest, err := contentDigest(obj_map)
+		if err != nil {
+			return nil, fmt.Errorf("reminder %d: %w", i, err)
+		}
+		config.reminders = append(config.reminders, *r)
+		config.digests = append(config.digests, digest)
+	}
+
+	obj, _ := raw.(map[string]interface{})
+	if raw_calendars, ok := obj["calendars"]; ok {
+		calendar_map, ok := raw_calendars.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failed to parse value of key \"calendars\" into a map")
+		}
+		for name, i := range calendar_map {
+			calendar, err := parseCalendar(name, i, base_dir)
+			if err != nil {
+				return nil, fmt.Errorf("calendar %s: %w", name, err)
+			}
+			config.calendars[name] = calendar
+		}
+	}
+	if raw_recipients, ok := obj["recipients"]; ok {
+		recipient_map, ok := raw_recipients.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failed to parse value of key \"recipients\" into a map")
+		}
+		for address, i := range recipient_map {
+			recipient, err := parseRecipient(address, i)
+			if err != nil {
+				return nil, fmt.Errorf("recipient %s: %w", address, err)
+			}
+			config.recipients[address] = recipient
+		}
+	}
+	if raw_limits, ok := obj["limits"]; ok {
+		limits, err := parseLimits(raw_limits)
+		if err != nil {
+			return nil, fmt.Errorf("limits: %w", err)
+		}
+		config.limits = limits
+	}
+	return config, nil
+}
+
+// Returns a short digest of a decoded reminder, which changes only when the
+// reminder itself does.
+func contentDigest(obj_map map[string]interface{}) (string, error) {
+	data, err := encodeFormat(obj_map, "json")
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:4]), nil
+}
+
+// Finds the list of reminders in a decoded config. See ParseConfig for the
+// layouts that are accepted.
+func reminderList(raw interface{}) ([]interface{}, error) {
+	if obj, ok := raw.(map[string]interface{}); ok {
+		for key := range obj {
+			if key != "reminders" && key != "calendars" && key != "recipients" && key != "limits" {
+				return nil, fmt.Errorf("the key \"%s\" is not a valid top-level key", key)
+			}
+		}
+		raw = obj["reminders"]
+	}
+	if raw == nil {
+		return []interface{}{}, nil
+	}
+	interface_list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse reminders into a list")
+	}
+	return interface_list, nil
+}
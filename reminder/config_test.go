@@ -0,0 +1,242 @@
+package reminder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testJSONConfig = `[
+  {
+    "version": "v1",
+    "message": "hello",
+    "triggers": [
+      {
+        "trigger_type": "cron",
+        "minute": "0",
+        "hour": "9",
+        "day_of_month": "*",
+        "month": "*",
+        "day_of_week": "1,2,3,4,5"
+      }
+    ]
+  }
+]`
+
+const testYAMLConfig = `
+# weekday mornings
+- version: v1
+  message: hello
+  triggers:
+    - trigger_type: cron
+      minute: 0
+      hour: 9
+      day_of_month: "*"
+      month: "*"
+      day_of_week: "1,2,3,4,5"
+`
+
+const testTOMLConfig = `
+# weekday mornings
+[[reminders]]
+version = "v1"
+message = "hello"
+
+  [[reminders.triggers]]
+  trigger_type = "cron"
+  minute = 0
+  hour = 9
+  day_of_month = "*"
+  month = "*"
+  day_of_week = "1,2,3,4,5"
+`
+
+// Tests that each config format decodes to the same reminders.
+func TestParseConfigFormats(t *testing.T) {
+	configs := map[string]string{
+		"json": testJSONConfig,
+		"yaml": testYAMLConfig,
+		"toml": testTOMLConfig,
+	}
+	for format, config := range configs {
+		reminder_list, err := ParseConfig([]byte(config), format)
+		if err != nil {
+			t.Errorf("format %s: got unexpected error: %s", format, err)
+			continue
+		}
+		if len(reminder_list) != 1 {
+			t.Errorf("format %s: got %d reminders (1 expected)", format, len(reminder_list))
+			continue
+		}
+		r := reminder_list[0]
+		if r.Version != "v2" || r.Message != "hello" || len(r.Triggers) != 1 {
+			t.Errorf("format %s: got unexpected reminder %+v", format, r)
+			continue
+		}
+		ct, ok := r.Triggers[0].(*CronTrigger)
+		if !ok {
+			t.Errorf("format %s: trigger is not a *CronTrigger", format)
+			continue
+		}
+		if ct.Minute != "0" || ct.Hour != "9" || ct.DayOfWeek != "1,2,3,4,5" {
+			t.Errorf("format %s: got unexpected trigger %+v", format, ct)
+		}
+	}
+}
+
+// Tests configs that should fail to parse.
+func TestParseConfigAbnormal(t *testing.T) {
+	test_cases := []struct {
+		Format string
+		Config string
+	}{
+		{Format: "yaml", Config: "- version: v1\n  message: 1.5\n"},
+		{Format: "yaml", Config: "- version: v1\n  triggers:\n    - trigger_type: cron\n      minute: 1.5\n"},
+		{Format: "toml", Config: "[[other]]\nversion = \"v1\"\n"},
+		{Format: "json", Config: `{"reminders": "nope"}`},
+		{Format: "ini", Config: ""},
+	}
+	for _, tc := range test_cases {
+		_, err := ParseConfig([]byte(tc.Config), tc.Format)
+		if err == nil {
+			t.Errorf("no error when there should have been with %s config %q", tc.Format, tc.Config)
+		}
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	test_cases := map[string]string{
+		"/etc/text-me-when.json": "json",
+		"reminders.yaml":         "yaml",
+		"reminders.YML":          "yaml",
+		"reminders.toml":         "toml",
+	}
+	for path, expected := range test_cases {
+		format, err := FormatForPath(path)
+		if err != nil || format != expected {
+			t.Errorf("got format %q, error %v for %s (%q expected)", format, err, path, expected)
+		}
+	}
+	if _, err := FormatForPath("reminders.txt"); err == nil {
+		t.Error("no error for path with unknown extension")
+	}
+}
+
+// Writes files into a temporary directory and returns its path.
+func writeConfigDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "text-me-when-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"a.json":       testJSONConfig,
+		"b.yaml":       testYAMLConfig,
+		"c.toml":       testTOMLConfig,
+		"README.txt":   "not a config",
+		".hidden.json": "not json",
+	})
+	defer os.RemoveAll(dir)
+
+	reminder_list, err := Load(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if len(reminder_list) != 3 {
+		t.Fatalf("got %d reminders (3 expected)", len(reminder_list))
+	}
+	expected_sources := []string{"a.json", "b.yaml", "c.toml"}
+	for i, r := range reminder_list {
+		if r.Source != filepath.Join(dir, expected_sources[i]) {
+			t.Errorf("got source %s for reminder %d (%s expected)", r.Source, i, expected_sources[i])
+		}
+	}
+}
+
+func TestLoadDirectoryDuplicateIDs(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"a.yaml": "- version: v1\n  id: standup\n  message: a\n",
+		"b.yaml": "- version: v1\n  id: standup\n  message: b\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := Load(dir)
+	if err == nil {
+		t.Fatal("no error for duplicate reminder ids")
+	}
+	if !strings.Contains(err.Error(), "a.yaml") || !strings.Contains(err.Error(), "b.yaml") {
+		t.Errorf("error does not name both files: %s", err)
+	}
+}
+
+func TestParseConfigOptionalFields(t *testing.T) {
+	config := `
+- version: v1
+  id: standup
+  name: Daily standup
+  tags: [work, team]
+  enabled: false
+  message: Standup in 5 minutes.
+- version: v1
+  message: no optional fields
+`
+	reminder_list, err := ParseConfig([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if r.ID != "standup" || r.Name != "Daily standup" || r.Enabled || len(r.Tags) != 2 {
+		t.Errorf("got unexpected reminder %+v", r)
+	}
+	if !r.HasAnyTag([]string{"home", "team"}) || r.HasAnyTag([]string{"home"}) || !r.HasAnyTag(nil) {
+		t.Errorf("HasAnyTag gave unexpected results for tags %v", r.Tags)
+	}
+	if !reminder_list[1].Enabled {
+		t.Error("reminder without \"enabled\" key is not enabled")
+	}
+}
+
+func TestLoadFileAssignsIDs(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"reminders.yaml": "- version: v1\n  message: a\n- version: v1\n  id: b\n  message: b\n",
+	})
+	defer os.RemoveAll(dir)
+
+	reminder_list, err := LoadFile(filepath.Join(dir, "reminders.yaml"))
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	id := reminder_list[0].ID
+	if !strings.HasPrefix(id, "reminders.yaml#") || !reminder_list[0].GeneratedID || reminder_list[1].ID != "b" ||
+		reminder_list[1].GeneratedID {
+		t.Errorf("got ids %s and %s (reminders.yaml#... and b expected)", id, reminder_list[1].ID)
+	}
+
+	// the generated ID doesn't change when other reminders are added or moved,
+	// and identical reminders are told apart
+	path := filepath.Join(dir, "reminders.yaml")
+	config := "- version: v1\n  message: c\n- version: v1\n  id: b\n  message: b\n" +
+		"- version: v1\n  message: a\n- version: v1\n  message: a\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+	reminder_list, err = LoadFile(path)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if reminder_list[2].ID != id || reminder_list[3].ID != id+"-2" || reminder_list[0].ID == id {
+		t.Errorf("got ids %s, %s and %s after reordering (%s expected for a)", reminder_list[0].ID,
+			reminder_list[2].ID, reminder_list[3].ID, id)
+	}
+}
@@ -6,14 +6,18 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
-	"encoding/json"
 )
 
 // bounds gives the minimum and maximum acceptable values for each cron field.
 // These bounds are inclusive. For example, both 0 and 59 are acceptable values
 // for the "minute" field.
 var bounds = map[string]map[string]uint{
+	"second": map[string]uint{
+		"lower": 0,
+		"upper": 59,
+	},
 	"minute": map[string]uint{
 		"lower": 0,
 		"upper": 59,
@@ -36,6 +40,13 @@ var bounds = map[string]map[string]uint{
 	},
 }
 
+// These match the comma format ("4,5,23") and star-slash format ("*/2") of
+// cron fields.
+var (
+	commaFormatRegexp = regexp.MustCompile(`^[0-9]{1,3}(,[0-9]{1,3})*$`)
+	slashFormatRegexp = regexp.MustCompile(`^\*/[0-9]{1,2}$`)
+)
+
 // CronTrigger is a type of Trigger that mimics the behaviour of cron.
 // For the uninitiated, each field corresponds to a granularity of time:
 // minutes, hours, days of the month, months, and days of the week.
@@ -53,8 +64,13 @@ var bounds = map[string]map[string]uint{
 //
 // "x,y,z": the field matches on exactly x, y and z. You may include any number
 // of values.
+//
+// There is also an optional Second field, for reminders that must be sent at a
+// precise second. If it is empty, the CronTrigger matches every second of the
+// minutes that it matches, as cron does.
 type CronTrigger struct {
 	triggerType string
+	Second      string
 	Minute      string
 	Hour        string
 	DayOfMonth  string
@@ -62,14 +78,42 @@ type CronTrigger struct {
 	DayOfWeek   string
 }
 
+func init() {
+	RegisterTriggerType("cron", func() Trigger { return &CronTrigger{} })
+}
+
 // Returns the type of the Trigger.
 func (ct *CronTrigger) TriggerType() string {
 	return ct.triggerType
 }
 
+// Returns an English description of when the CronTrigger runs, for example
+// "every 2 minutes on day 3 of every month".
+func (ct *CronTrigger) Describe() string {
+	description := describeCronTime(ct.Minute, ct.Hour)
+	if ct.Second != "" {
+		description = describeCronSeconds(ct.Second, ct.Minute, ct.Hour, description)
+	}
+	days := describeCronDays(ct.DayOfMonth, ct.Month, ct.DayOfWeek)
+	if days != "" {
+		description = description + " " + days
+	}
+	return description
+}
+
 // Given a time as a time.Time object, tells the caller whether the CronTrigger
 // should run at this time.
 func (ct *CronTrigger) ShouldRun(current_time time.Time) bool {
+	if ct.Second != "" && !matchCronFields(uint(current_time.Second()), ct.Second,
+		bounds["second"]["lower"], bounds["second"]["upper"]) {
+		return false
+	}
+	return ct.matchesMinute(current_time)
+}
+
+// Tells the caller whether every field of the CronTrigger except Second
+// matches current_time.
+func (ct *CronTrigger) matchesMinute(current_time time.Time) bool {
 	minute := matchCronFields(uint(current_time.Minute()), ct.Minute,
 		bounds["minute"]["lower"], bounds["minute"]["upper"])
 	hour := matchCronFields(uint(current_time.Hour()), ct.Hour,
@@ -87,23 +131,32 @@ func (ct *CronTrigger) ShouldRun(current_time time.Time) bool {
 	return minute && hour && month && day_of_month && day_of_week
 }
 
+// Tells the caller whether the CronTrigger has a Second field, and so must be
+// checked every second rather than every minute.
+func (ct *CronTrigger) UsesSeconds() bool {
+	return ct.Second != ""
+}
+
 // Parses a []byte containing JSON into a CronTrigger.
 func (ct *CronTrigger) UnmarshalJSON(data []byte) error {
 	if string(data) == "null" { return nil }
-	obj := map[string]string{}
-	err := json.Unmarshal(data, &obj)
+	raw, err := decodeFormat(data, "json")
 	if err != nil {
 		return fmt.Errorf("problem unmarshalling json: %w", err)
 	}
-	return ct.mapToCronTrigger(obj)
+	obj, ok := raw.(map[string]interface{})
+	if ! ok {
+		return fmt.Errorf("problem unmarshalling json: trigger is not an object")
+	}
+	return ct.ParseTriggerFromInterfaceMap(obj)
 }
 
-// Parses a map[string]interface{} into a CronTrigger. This is used when unmarshalling
-// (from JSON) structs that include a CronTrigger under a field.
+// Parses a map[string]interface{} into a CronTrigger. This is used when decoding
+// structs that include a CronTrigger under a field, from any config format.
 func (ct *CronTrigger) ParseTriggerFromInterfaceMap(raw_obj_map map[string]interface{}) error {
 	obj_map := map[string]string{}
 	for key, i := range raw_obj_map {
-		value, ok := i.(string)
+		value, ok := stringValue(i)
 		if ! ok {
 			return fmt.Errorf("the value of key \"%s\" could not be converted to string", key)
 		}
@@ -122,6 +175,10 @@ func (ct *CronTrigger) mapToCronTrigger(obj map[string]string) error {
 				return fmt.Errorf("trigger type \"value\" is not valid (must be \"cron\")")
 			}
 			ct.triggerType = value
+		case "second":
+			_, err := parseCronField(value, bounds["second"]["lower"], bounds["second"]["upper"])
+			if err != nil { return generateError(key, value) }
+			ct.Second = value
 		case "minute":
 			_, err := parseCronField(value, bounds["minute"]["lower"], bounds["minute"]["upper"])
 			if err != nil { return generateError(key, value) }
@@ -155,21 +212,46 @@ func generateError(key, value string) error {
 	return fmt.Errorf("pattern \"%s\" is invalid for key \"%s\"", value, key)
 }
 
+// cronFieldKey identifies a parsed cron field in cronFieldCache.
+type cronFieldKey struct {
+	pattern     string
+	lower_bound uint
+	upper_bound uint
+}
+
+// cronFieldCache holds the values that cron field patterns stand for, as
+// bitmasks with bit n set if the pattern matches n. Parsing a pattern is slow
+// compared to matching it, and the same few patterns are matched over and over
+// (once per minute when looking ahead for the next run), so results are kept.
+var (
+	cronFieldCacheMutex sync.RWMutex
+	cronFieldCache      = map[cronFieldKey]uint64{}
+)
+
 // Checks whether a cron field with a given value matches a field pattern, as stored by
 // the CronTrigger object. lower_bound and upper_bound are the bounds (inclusive) of
 // the field. Errors in parseCronField are ignored since any problems here should be dealt
 // with upon CronTrigger creation.
 func matchCronFields(field_value uint, field_pattern string, lower_bound, upper_bound uint) bool {
-	numbers, err := parseCronField(field_pattern, lower_bound, upper_bound)
-	if err != nil {
-		return false
-	}
-	for _, number := range numbers {
-		if number == field_value {
-			return true
+	key := cronFieldKey{pattern: field_pattern, lower_bound: lower_bound, upper_bound: upper_bound}
+	cronFieldCacheMutex.RLock()
+	mask, ok := cronFieldCache[key]
+	cronFieldCacheMutex.RUnlock()
+	if !ok {
+		numbers, err := parseCronField(field_pattern, lower_bound, upper_bound)
+		if err != nil {
+			return false
+		}
+		for _, number := range numbers {
+			if number < 64 {
+				mask = mask | (1 << number)
+			}
 		}
+		cronFieldCacheMutex.Lock()
+		cronFieldCache[key] = mask
+		cronFieldCacheMutex.Unlock()
 	}
-	return false
+	return field_value < 64 && mask&(1<<field_value) != 0
 }
 
 // Creates a new CronTrigger object from arguments that correspond to cron fields.
@@ -211,11 +293,7 @@ func parseCronField(field_pattern string, lower_bound uint, upper_bound uint) ([
 	}
 
 	// check if we're working with comma format ("4,5,23") and act accordingly
-	matched_comma_format, err := regexp.MatchString(`^[0-9]{1,3}(,[0-9]{1,3})*$`, field_pattern)
-	if err != nil {
-		msg := fmt.Sprintf("there was a problem running comma regex on %s", field_pattern)
-		return nil, errors.New(msg)
-	}
+	matched_comma_format := commaFormatRegexp.MatchString(field_pattern)
 	if matched_comma_format {
 		string_numbers := strings.Split(field_pattern, ",")
 		numbers := make([]uint, 0, len(string_numbers))
@@ -231,11 +309,7 @@ func parseCronField(field_pattern string, lower_bound uint, upper_bound uint) ([
 	}
 
 	// check if we're working with star-slash format ("*/2") and act accordingly
-	matched_slash_format, err := regexp.MatchString(`^\*/[0-9]{1,2}$`, field_pattern)
-	if err != nil {
-		msg := fmt.Sprintf("there was a problem running slash regex on %s", field_pattern)
-		return nil, errors.New(msg)
-	}
+	matched_slash_format := slashFormatRegexp.MatchString(field_pattern)
 	if matched_slash_format {
 		split_field := strings.Split(field_pattern, "/")
 		if len(split_field) != 2 {
@@ -283,3 +283,65 @@ func TestShouldRunDOWAndDOM(t *testing.T) {
 		}
 	}
 }
+
+func TestDescribe(t *testing.T) {
+	test_cases := map[string][]string{
+		"every minute":                                     []string{"*", "*", "*", "*", "*"},
+		"every 2 minutes on day 3 of every month":          []string{"*/2", "*", "3", "*", "*"},
+		"at 09:00 on day 1 of January and August":          []string{"0", "9", "1", "1,8", "*"},
+		"at 09:00, 09:30, 17:00 and 17:30 on Monday and Friday":[]string{"0,30", "9,17", "*", "*", "1,5"},
+		"at minute 15 past every hour":                     []string{"15", "*", "*", "*", "*"},
+		"at minute 0 past every 2 hours":                   []string{"0", "*/2", "*", "*", "*"},
+		"every 15 minutes during hours 9 and 10":           []string{"*/15", "9,10", "*", "*", "*"},
+		"every minute during hour 7 every day in December": []string{"*", "7", "*", "12", "*"},
+		"at 07:00 on day 13 or on Friday":                  []string{"0", "7", "13", "*", "5"},
+		"at 07:00 on every 2nd day of every month":         []string{"0", "7", "*/2", "*", "*"},
+	}
+	for expected, args := range test_cases {
+		ct := getCronTrigger(t, args[0], args[1], args[2], args[3], args[4])
+		description := ct.Describe()
+		if description != expected {
+			t.Errorf("got description \"%s\" for args %v (\"%s\" expected)", description, args, expected)
+		}
+	}
+}
+
+func TestShouldRunSeconds(t *testing.T) {
+	ct := getCronTrigger(t, "*", "9", "*", "*", "*")
+	ct.Second = "0,30"
+	test_cases := map[time.Time]bool{
+		time.Date(2021, time.March, 1, 9, 15, 0, 0, time.UTC):  true,
+		time.Date(2021, time.March, 1, 9, 15, 30, 0, time.UTC): true,
+		time.Date(2021, time.March, 1, 9, 15, 31, 0, time.UTC): false,
+		time.Date(2021, time.March, 1, 10, 15, 30, 0, time.UTC): false,
+	}
+	for test_time, expected := range test_cases {
+		if ct.ShouldRun(test_time) != expected {
+			t.Errorf("ShouldRun returned %t at %s (%t expected)", !expected, test_time, expected)
+		}
+	}
+
+	// without a second field, every second of a matching minute matches
+	ct.Second = ""
+	if !ct.ShouldRun(time.Date(2021, time.March, 1, 9, 15, 31, 0, time.UTC)) {
+		t.Error("minute-only trigger did not match at 09:15:31")
+	}
+}
+
+func TestDescribeSeconds(t *testing.T) {
+	test_cases := map[string][]string{
+		"every 10 seconds":                     []string{"*/10", "*", "*"},
+		"every second during hour 9":           []string{"*", "*", "9"},
+		"at second 30 of every minute":         []string{"30", "*", "*"},
+		"at seconds 0 and 30, at 09:15":        []string{"0,30", "15", "9"},
+		"every 5 seconds, at minute 0 past every hour": []string{"*/5", "0", "*"},
+	}
+	for expected, args := range test_cases {
+		ct := getCronTrigger(t, args[1], args[2], "*", "*", "*")
+		ct.Second = args[0]
+		description := ct.Describe()
+		if description != expected {
+			t.Errorf("got description \"%s\" for args %v (\"%s\" expected)", description, args, expected)
+		}
+	}
+}
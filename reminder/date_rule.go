@@ -0,0 +1,176 @@
+package reminder
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateRuleRegexp matches date rules; see ParseDateRule.
+var dateRuleRegexp = regexp.MustCompile(
+	`^(?:(easter)|(?:the\s+)?([a-z0-9]+)\s+([a-z]+)\s+(?:of|in)\s+([a-z]+))(?:\s*([+-])\s*([0-9]+)d)?$`)
+
+// nthWords maps the words that may start an nth weekday rule to n. -1 means
+// the last one in the month.
+var nthWords = map[string]int{
+	"first": 1, "1st": 1,
+	"second": 2, "2nd": 2,
+	"third": 3, "3rd": 3,
+	"fourth": 4, "4th": 4,
+	"fifth": 5, "5th": 5,
+	"last": -1,
+}
+
+// A DateRule gives one date in each year that cannot be written as a fixed
+// month and day, such as Easter or the 4th Thursday of November, optionally
+// moved by a number of days. Rules are written as text; see ParseDateRule.
+type DateRule struct {
+	// Easter is true for Easter Sunday, in the Gregorian calendar. If it is
+	// false, the rule is the Nth Weekday of Month, where N is -1 for the last
+	// one in the month.
+	Easter  bool
+	N       int
+	Weekday time.Weekday
+	Month   time.Month
+	// Offset is a number of days added to the date.
+	Offset int
+
+	text string
+}
+
+// Parses a date rule. A rule is one of:
+//
+// "easter": Easter Sunday.
+//
+// "<nth> <weekday> of <month>": for example "4th thursday of november" or
+// "second sunday in may". nth is 1st to 5th, first to fifth, or last.
+//
+// Either may be followed by an offset in days, as in "easter -2d" for Good
+// Friday or "4th thursday of november +1d". Rules are not case sensitive.
+func ParseDateRule(value string) (*DateRule, error) {
+	text := strings.Join(strings.Fields(strings.ToLower(value)), " ")
+	match := dateRuleRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return nil, fmt.Errorf("\"%s\" is not a date rule like \"easter -2d\" or \"4th thursday of november\"", value)
+	}
+	rule := &DateRule{text: text}
+	if match[1] != "" {
+		rule.Easter = true
+	} else {
+		n, ok := nthWords[match[2]]
+		if !ok {
+			return nil, fmt.Errorf("\"%s\" in date rule \"%s\" is not 1st to 5th or last", match[2], value)
+		}
+		weekday, err := parseWeekday(match[3])
+		if err != nil {
+			return nil, err
+		}
+		month, err := parseMonth(match[4])
+		if err != nil {
+			return nil, err
+		}
+		rule.N, rule.Weekday, rule.Month = n, weekday, month
+	}
+	if match[6] != "" {
+		offset, err := strconv.Atoi(match[6])
+		if err != nil || offset > 365 {
+			return nil, fmt.Errorf("the offset of date rule \"%s\" must be within 365 days", value)
+		}
+		if match[5] == "-" {
+			offset = -offset
+		}
+		rule.Offset = offset
+	}
+	return rule, nil
+}
+
+// Returns the date that rule gives for year, at midnight UTC. The offset may
+// move it into the year before or after. The bool is false if there is no
+// such date in year, as happens with the 5th Monday of some months.
+func (rule *DateRule) Date(year int) (time.Time, bool) {
+	var date time.Time
+	switch {
+	case rule.Easter:
+		date = easter(year)
+	case rule.N < 0:
+		last := time.Date(year, rule.Month+1, 0, 0, 0, 0, 0, time.UTC)
+		date = last.AddDate(0, 0, -((int(last.Weekday()) - int(rule.Weekday) + 7) % 7))
+	default:
+		first := time.Date(year, rule.Month, 1, 0, 0, 0, 0, time.UTC)
+		date = first.AddDate(0, 0, (int(rule.Weekday)-int(first.Weekday())+7)%7+7*(rule.N-1))
+		if date.Month() != rule.Month {
+			return time.Time{}, false
+		}
+	}
+	return date.AddDate(0, 0, rule.Offset), true
+}
+
+// Tells the caller whether rule gives day, which must be at midnight UTC.
+func (rule *DateRule) On(day time.Time) bool {
+	for year := day.Year() - 1; year <= day.Year()+1; year++ {
+		if date, ok := rule.Date(year); ok && date.Equal(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the rule as it was written, normalized to lower case.
+func (rule *DateRule) String() string {
+	return rule.text
+}
+
+// Describes the rule in English, for example "2 days before Easter" or
+// "the last Monday of May".
+func (rule *DateRule) Describe() string {
+	base := "Easter"
+	if !rule.Easter {
+		nth := "last"
+		if rule.N > 0 {
+			nth = ordinal(uint(rule.N))
+		}
+		base = fmt.Sprintf("the %s %s of %s", nth, rule.Weekday, rule.Month)
+	}
+	switch {
+	case rule.Offset < 0:
+		return fmt.Sprintf("%s before %s", CountOf(-rule.Offset, "day"), base)
+	case rule.Offset > 0:
+		return fmt.Sprintf("%s after %s", CountOf(rule.Offset, "day"), base)
+	default:
+		return base
+	}
+}
+
+// Returns the date of Easter Sunday in year in the Gregorian calendar, using
+// the anonymous Gregorian algorithm (Meeus/Jones/Butcher).
+func easter(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// Parses the English name of a month or its abbreviation ("November", "nov").
+func parseMonth(value string) (time.Month, error) {
+	lower := strings.ToLower(value)
+	for month := time.January; month <= time.December; month++ {
+		name := strings.ToLower(month.String())
+		if lower == name || lower == name[:3] {
+			return month, nil
+		}
+	}
+	return 0, fmt.Errorf("\"%s\" is not a month", value)
+}
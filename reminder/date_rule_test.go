@@ -0,0 +1,160 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateRule(t *testing.T) {
+	test_cases := []struct {
+		rule     string
+		year     int
+		expected string
+	}{
+		{"easter", 2000, "2000-04-23"},
+		{"easter", 2019, "2019-04-21"},
+		{"easter", 2021, "2021-04-04"},
+		{"easter", 2024, "2024-03-31"},
+		{"easter", 2038, "2038-04-25"},
+		{"Easter -2d", 2021, "2021-04-02"},
+		{"easter - 21d", 2021, "2021-03-14"},
+		{"4th Thursday of November", 2021, "2021-11-25"},
+		{"fourth thu of nov", 2022, "2022-11-24"},
+		{"the 4th thursday of november +1d", 2021, "2021-11-26"},
+		{"second sunday in may", 2021, "2021-05-09"},
+		{"1st monday of september", 2021, "2021-09-06"},
+		{"last monday of may", 2021, "2021-05-31"},
+		{"last monday of may", 2022, "2022-05-30"},
+		{"last sunday of december", 2021, "2021-12-26"},
+		// the offset moves the date into the year before
+		{"1st sunday of january -7d", 2021, "2020-12-27"},
+		// there is no 5th Monday of February in 2021
+		{"5th monday of february", 2021, ""},
+	}
+	for _, test_case := range test_cases {
+		rule, err := ParseDateRule(test_case.rule)
+		if err != nil {
+			t.Errorf("got unexpected error for rule \"%s\": %s", test_case.rule, err)
+			continue
+		}
+		date, ok := rule.Date(test_case.year)
+		got := ""
+		if ok {
+			got = date.Format("2006-01-02")
+		}
+		if got != test_case.expected {
+			t.Errorf("rule \"%s\" in %d gave \"%s\" (\"%s\" expected)", test_case.rule, test_case.year, got,
+				test_case.expected)
+		}
+		if ok && !rule.On(date) {
+			t.Errorf("rule \"%s\" is not on %s", test_case.rule, got)
+		}
+	}
+}
+
+func TestDateRuleAbnormal(t *testing.T) {
+	test_cases := []string{
+		"",
+		"christmas",
+		"6th monday of may",
+		"4th thursday of novembre",
+		"4th thirsday of november",
+		"4th thursday",
+		"easter +2w",
+		"easter +400d",
+	}
+	for _, test_case := range test_cases {
+		if _, err := ParseDateRule(test_case); err == nil {
+			t.Errorf("no error when there should have been with rule \"%s\"", test_case)
+		}
+	}
+}
+
+func TestDateRuleTrigger(t *testing.T) {
+	config := `
+- version: v2
+  message: Thanksgiving dinner
+  timezone: America/New_York
+  triggers:
+    - trigger_type: date_rule
+      rule: 4th thursday of november
+      time: "17:00"
+    - trigger_type: date_rule
+      rule: easter -2d
+      time: "09:00"
+`
+	reminder_list, err := ParseConfig([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+
+	new_york, _ := time.LoadLocation("America/New_York")
+	next_run, ok := r.NextRun(time.Date(2021, time.June, 1, 0, 0, 0, 0, new_york))
+	expected := time.Date(2021, time.November, 25, 17, 0, 0, 0, new_york)
+	if !ok || !next_run.Equal(expected) {
+		t.Errorf("got next run %s (%s expected)", next_run, expected)
+	}
+	if !r.ShouldRun(time.Date(2022, time.April, 15, 9, 0, 0, 0, new_york)) {
+		t.Error("did not run on Good Friday 2022")
+	}
+
+	description := "on the 4th Thursday of November at 17:00; or 2 days before Easter at 09:00"
+	if r.Describe() != description {
+		t.Errorf("got description \"%s\" (\"%s\" expected)", r.Describe(), description)
+	}
+
+	abnormal := []string{
+		`{"trigger_type": "date_rule", "rule": "easter"}`,
+		`{"trigger_type": "date_rule", "time": "09:00"}`,
+		`{"trigger_type": "date_rule", "rule": "christmas", "time": "09:00"}`,
+		`{"trigger_type": "date_rule", "rule": "easter", "time": "09:00", "offset": "1d"}`,
+	}
+	for _, trigger := range abnormal {
+		config := `[{"version": "v2", "triggers": [` + trigger + `]}]`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with trigger %s", trigger)
+		}
+	}
+}
+
+func TestDateRuleCalendar(t *testing.T) {
+	config := `{
+		"calendars": {"bank_holidays": {"rules": ["easter -2d", "easter +1d", "last monday of may"]}},
+		"reminders": [{"version": "v2", "exclude": ["bank_holidays"],
+			"triggers": [{"trigger_type": "weekly", "weekday": "monday", "time": "08:00"}]}]
+	}`
+	reminder_list, err := ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	decision := r.Check(time.Date(2021, time.April, 5, 8, 0, 0, 0, time.Local))
+	if !decision.Skipped || decision.Reason != "calendar \"bank_holidays\": 1 day after Easter" {
+		t.Errorf("got decision %+v on Easter Monday (skipped expected)", decision)
+	}
+	if !r.ShouldRun(time.Date(2021, time.April, 12, 8, 0, 0, 0, time.Local)) {
+		t.Error("did not run on the Monday after Easter Monday")
+	}
+}
+
+func TestDateRuleEvent(t *testing.T) {
+	config := `[{"version": "v2", "message": "Mother's Day in {days_remaining} days",
+		"event": {"date": "2nd sunday of may", "offsets": ["-3d"]}}]`
+	reminder_list, err := ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	run_time := time.Date(2021, time.May, 6, 9, 0, 0, 0, time.Local)
+	if !r.ShouldRun(run_time) {
+		t.Errorf("did not run at %s", run_time)
+	}
+	if message := r.RenderMessage(run_time); message != "Mother's Day in 3 days" {
+		t.Errorf("got message \"%s\" (\"Mother's Day in 3 days\" expected)", message)
+	}
+	next_run, ok := r.NextRun(run_time)
+	if !ok || !next_run.Equal(time.Date(2022, time.May, 5, 9, 0, 0, 0, time.Local)) {
+		t.Errorf("got next run %s (2022-05-05 09:00 expected)", next_run)
+	}
+}
@@ -0,0 +1,84 @@
+package reminder
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateRuleTrigger is a type of Trigger that runs once a year at a time of day
+// on a date that is given by a DateRule, for movable dates like Easter or
+// Thanksgiving that cron cannot express. Its config keys are:
+//
+// "rule": the date rule, for example "easter -2d" or "4th thursday of
+// november". See ParseDateRule.
+//
+// "time": the time of day, as "HH:MM" on a 24-hour clock.
+type DateRuleTrigger struct {
+	Rule   *DateRule
+	Hour   int
+	Minute int
+}
+
+func init() {
+	RegisterTriggerType("date_rule", func() Trigger { return &DateRuleTrigger{} })
+}
+
+// Returns the type of the Trigger.
+func (dt *DateRuleTrigger) TriggerType() string {
+	return "date_rule"
+}
+
+// Given a time as a time.Time object, tells the caller whether the
+// DateRuleTrigger should run at this time.
+func (dt *DateRuleTrigger) ShouldRun(current_time time.Time) bool {
+	if current_time.Hour() != dt.Hour || current_time.Minute() != dt.Minute {
+		return false
+	}
+	return dt.Rule.On(civilDate(current_time))
+}
+
+// Returns an English description of when the DateRuleTrigger runs, for example
+// "on the 4th Thursday of November at 09:00".
+func (dt *DateRuleTrigger) Describe() string {
+	description := dt.Rule.Describe()
+	if dt.Rule.Offset == 0 {
+		description = "on " + description
+	}
+	return fmt.Sprintf("%s at %02d:%02d", description, dt.Hour, dt.Minute)
+}
+
+// Parses a map[string]interface{} into a DateRuleTrigger.
+func (dt *DateRuleTrigger) ParseTriggerFromInterfaceMap(obj_map map[string]interface{}) error {
+	has_time := false
+	for key, i := range obj_map {
+		value, ok := stringValue(i)
+		if !ok {
+			return fmt.Errorf("the value of key \"%s\" could not be converted to string", key)
+		}
+		switch key {
+		case "trigger_type":
+			if value != "date_rule" {
+				return fmt.Errorf("trigger type \"%s\" is not valid (must be \"date_rule\")", value)
+			}
+		case "rule":
+			rule, err := ParseDateRule(value)
+			if err != nil {
+				return err
+			}
+			dt.Rule = rule
+		case "time":
+			hour, minute, err := parseTimeOfDay(value)
+			if err != nil {
+				return err
+			}
+			dt.Hour, dt.Minute = hour, minute
+			has_time = true
+		default:
+			return fmt.Errorf("the key \"%s\" is not a valid key", key)
+		}
+	}
+	if dt.Rule == nil || !has_time {
+		return fmt.Errorf("date_rule triggers must have a rule and a time")
+	}
+	return nil
+}
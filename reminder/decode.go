@@ -0,0 +1,194 @@
+package reminder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// The decoding layer turns a config file in any supported format into the
+// same generic tree of values: maps are map[string]interface{}, lists are
+// []interface{}, and everything else is a scalar. ReminderV1 and the Triggers
+// are parsed from this tree, so they do not need to know which format the
+// config was written in.
+
+// Decodes raw config data in the given format ("json", "yaml" or "toml")
+// into a generic tree of values.
+func decodeFormat(data []byte, format string) (interface{}, error) {
+	var raw interface{}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %w", err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("yaml.Unmarshal: %w", err)
+		}
+	case "toml":
+		obj := map[string]interface{}{}
+		if err := toml.Unmarshal(data, &obj); err != nil {
+			return nil, fmt.Errorf("toml.Unmarshal: %w", err)
+		}
+		raw = obj
+	default:
+		return nil, fmt.Errorf("config format \"%s\" is not supported", format)
+	}
+	return normalize(raw)
+}
+
+// Encodes a generic tree of values in the given format. It is the inverse of
+// decodeFormat, except that comments and key order are not preserved.
+func encodeFormat(value interface{}, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("json.MarshalIndent: %w", err)
+		}
+		return append(data, '\n'), nil
+	case "yaml":
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("yaml.Marshal: %w", err)
+		}
+		return data, nil
+	case "toml":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("toml configs must have a table at the top level")
+		}
+		buf := &bytes.Buffer{}
+		if err := toml.NewEncoder(buf).Encode(tomlTables(obj)); err != nil {
+			return nil, fmt.Errorf("toml.Encode: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("config format \"%s\" is not supported", format)
+	}
+}
+
+// Converts lists of maps in a generic tree into []map[string]interface{}, which
+// the TOML encoder needs in order to write them as arrays of tables.
+func tomlTables(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(typed))
+		for key, i := range typed {
+			obj[key] = tomlTables(i)
+		}
+		return obj
+	case []interface{}:
+		tables := make([]map[string]interface{}, 0, len(typed))
+		for _, i := range typed {
+			table, ok := i.(map[string]interface{})
+			if !ok {
+				return typed
+			}
+			tables = append(tables, tomlTables(table).(map[string]interface{}))
+		}
+		return tables
+	default:
+		return value
+	}
+}
+
+// Converts the values produced by the various decoders into the generic tree
+// described above. YAML produces map[interface{}]interface{} and TOML
+// produces []map[string]interface{} for arrays of tables; both are converted.
+func normalize(value interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(typed))
+		for key, i := range typed {
+			normalized, err := normalize(i)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = normalized
+		}
+		return obj, nil
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(typed))
+		for raw_key, i := range typed {
+			key, ok := raw_key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %v is not a string", raw_key)
+			}
+			normalized, err := normalize(i)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = normalized
+		}
+		return obj, nil
+	case []interface{}:
+		list := make([]interface{}, 0, len(typed))
+		for _, i := range typed {
+			normalized, err := normalize(i)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, normalized)
+		}
+		return list, nil
+	case []map[string]interface{}:
+		list := make([]interface{}, 0, len(typed))
+		for _, i := range typed {
+			normalized, err := normalize(i)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, normalized)
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
+// Converts a scalar from the generic tree into a string. Whole numbers are
+// accepted too, since YAML and TOML users will naturally write `minute: 0`
+// rather than `minute: "0"`.
+func stringValue(i interface{}) (string, bool) {
+	switch value := i.(type) {
+	case string:
+		return value, true
+	case int:
+		return strconv.Itoa(value), true
+	case int64:
+		return strconv.FormatInt(value, 10), true
+	case uint64:
+		return strconv.FormatUint(value, 10), true
+	case float64:
+		if value != math.Trunc(value) {
+			return "", false
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// Converts a list from the generic tree into a list of non-empty strings.
+// key is the config key the list was found under, for error messages.
+func stringList(key string, i interface{}) ([]string, error) {
+	interface_list, ok := i.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value of key \"%s\" into a list", key)
+	}
+	values := make([]string, 0, len(interface_list))
+	for _, item := range interface_list {
+		value, ok := stringValue(item)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("failed to parse an item of key \"%s\" into non-empty string", key)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
@@ -0,0 +1,237 @@
+package reminder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Describes the minute and hour fields of a CronTrigger, for example
+// "every 15 minutes during hours 9 and 17" or "at 09:00 and 17:30".
+func describeCronTime(minute, hour string) string {
+	hours := describeCronHours(hour)
+	if minute == "*" {
+		return joinNonEmpty("every minute", hours)
+	}
+	if step, ok := cronStep(minute); ok {
+		return joinNonEmpty("every "+pluralize(step, "minute"), hours)
+	}
+
+	minutes := cronValues(minute, "minute")
+	if hour != "*" {
+		if _, ok := cronStep(hour); !ok {
+			hour_values := cronValues(hour, "hour")
+			if len(minutes)*len(hour_values) <= 6 {
+				times := make([]string, 0, len(minutes)*len(hour_values))
+				for _, h := range hour_values {
+					for _, m := range minutes {
+						times = append(times, fmt.Sprintf("%02d:%02d", h, m))
+					}
+				}
+				return "at " + joinEnglish(times, "and")
+			}
+		}
+	}
+	minute_word := "minute"
+	if len(minutes) > 1 {
+		minute_word = "minutes"
+	}
+	at_minutes := fmt.Sprintf("at %s %s past", minute_word, joinEnglish(uintsToStrings(minutes), "and"))
+	if hour == "*" {
+		return at_minutes + " every hour"
+	}
+	if step, ok := cronStep(hour); ok {
+		return at_minutes + " every " + pluralize(step, "hour")
+	}
+	hour_values := cronValues(hour, "hour")
+	hour_word := "hour"
+	if len(hour_values) > 1 {
+		hour_word = "hours"
+	}
+	return fmt.Sprintf("%s %s %s", at_minutes, hour_word, joinEnglish(uintsToStrings(hour_values), "and"))
+}
+
+// Adds the second field of a CronTrigger to time_description, the description
+// of its minute and hour fields, for example "every 10 seconds during hour 9"
+// or "at second 30, at 09:00".
+func describeCronSeconds(second, minute, hour, time_description string) string {
+	var seconds string
+	if second == "*" {
+		seconds = "every second"
+	} else if step, ok := cronStep(second); ok {
+		seconds = fmt.Sprintf("every %d seconds", step)
+		if step == 1 {
+			seconds = "every second"
+		}
+	} else {
+		values := cronValues(second, "second")
+		second_word := "second"
+		if len(values) > 1 {
+			second_word = "seconds"
+		}
+		seconds = fmt.Sprintf("at %s %s", second_word, joinEnglish(uintsToStrings(values), "and"))
+		if minute == "*" {
+			seconds = seconds + " of every minute"
+		}
+	}
+	if minute == "*" {
+		return joinNonEmpty(seconds, describeCronHours(hour))
+	}
+	return seconds + ", " + time_description
+}
+
+// Describes the hour field of a CronTrigger when it qualifies a minute
+// description. Returns "" for "*".
+func describeCronHours(hour string) string {
+	if hour == "*" {
+		return ""
+	}
+	if step, ok := cronStep(hour); ok {
+		return "of every " + pluralize(step, "hour")
+	}
+	values := cronValues(hour, "hour")
+	if len(values) == 1 {
+		return fmt.Sprintf("during hour %d", values[0])
+	}
+	return "during hours " + joinEnglish(uintsToStrings(values), "and")
+}
+
+// Describes the day_of_month, month and day_of_week fields of a CronTrigger,
+// for example "on day 3 of every month" or "on Monday and Friday in January".
+// Returns "" when the fields match every day.
+func describeCronDays(day_of_month, month, day_of_week string) string {
+	months := ""
+	if month != "*" {
+		names := make([]string, 0)
+		for _, value := range cronValues(month, "month") {
+			names = append(names, time.Month(value).String())
+		}
+		months = joinEnglish(names, "and")
+	}
+
+	days := ""
+	if step, ok := cronStep(day_of_month); ok {
+		days = "every " + ordinal(step) + " day"
+	} else if day_of_month != "*" {
+		values := cronValues(day_of_month, "day_of_month")
+		days = "day " + joinEnglish(uintsToStrings(values), "and")
+	}
+
+	weekdays := ""
+	if day_of_week != "*" {
+		names := make([]string, 0)
+		for _, value := range cronValues(day_of_week, "day_of_week") {
+			names = append(names, time.Weekday(value).String())
+		}
+		weekdays = joinEnglish(names, "and")
+	}
+
+	switch {
+	case days == "" && weekdays == "":
+		if months == "" {
+			return ""
+		}
+		return "every day in " + months
+	case weekdays == "":
+		if months == "" {
+			return "on " + days + " of every month"
+		}
+		return "on " + days + " of " + months
+	case days == "":
+		return joinNonEmpty("on "+weekdays, prefixNonEmpty("in ", months))
+	default:
+		return joinNonEmpty("on "+days+" or on "+weekdays, prefixNonEmpty("in ", months))
+	}
+}
+
+// If pattern is in star-slash format ("*/x"), returns x and true.
+func cronStep(pattern string) (uint, bool) {
+	if !strings.HasPrefix(pattern, "*/") {
+		return 0, false
+	}
+	var step uint
+	_, err := fmt.Sscanf(pattern, "*/%d", &step)
+	if err != nil {
+		return 0, false
+	}
+	return step, true
+}
+
+// Returns the values that a cron pattern stands for in the named field.
+// Errors are ignored since patterns are validated when a CronTrigger is created.
+func cronValues(pattern, field_name string) []uint {
+	values, _ := parseCronField(pattern, bounds[field_name]["lower"], bounds[field_name]["upper"])
+	return values
+}
+
+// Joins a list of words into an English list, for example "a, b and c".
+func joinEnglish(words []string, conjunction string) string {
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " " + conjunction + " " + words[len(words)-1]
+}
+
+// Joins the non-empty strings passed to it with spaces.
+func joinNonEmpty(parts ...string) string {
+	non_empty := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			non_empty = append(non_empty, part)
+		}
+	}
+	return strings.Join(non_empty, " ")
+}
+
+// Returns prefix + value, or "" if value is "".
+func prefixNonEmpty(prefix, value string) string {
+	if value == "" {
+		return ""
+	}
+	return prefix + value
+}
+
+// Returns "minute" for 1 and "n minutes" otherwise.
+func pluralize(n uint, unit string) string {
+	if n == 1 {
+		return unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// Returns n followed by unit, made plural if n is not 1, for example
+// "1 minute" or "3 reminders".
+func CountOf(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return pluralize(uint(n), unit)
+}
+
+// Returns the English ordinal of n, for example "2nd" or "11th".
+func ordinal(n uint) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+func uintsToStrings(values []uint) []string {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		strs = append(strs, fmt.Sprintf("%d", value))
+	}
+	return strs
+}
@@ -0,0 +1,258 @@
+package reminder
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventOffsetRegexp matches event offsets like "-7d", "+1d" or "-1d@18:00".
+var eventOffsetRegexp = regexp.MustCompile(`^([+-]?[0-9]+)d(?:@(.+))?$`)
+
+// An Event is a date that a reminder counts down to, such as a birthday or a
+// deadline. It is given under a reminder's "event" key, whose keys are:
+//
+// "date": either a full date ("2021-09-30") for a one-off event, a month and
+// day ("03-14") for an event that happens every year, or a date rule such as
+// "2nd sunday of may" (see ParseDateRule) for a yearly event whose date moves.
+// A yearly event on February 29 falls on February 28 in other years.
+//
+// "time": the time of day ("HH:MM") for offsets that do not give their own.
+// Defaults to "09:00".
+//
+// "offsets": a list of days relative to the event on which the reminder is
+// sent, such as "-7d" for a week before, optionally followed by a time, as in
+// "-1d@18:00". "0d" is the day of the event.
+//
+// Each offset becomes an EventTrigger in the reminder's Triggers. The message
+// of a reminder with an Event may contain "{days_remaining}", which is
+// replaced by the number of days until the event, and "{event_date}".
+type Event struct {
+	Date    time.Time
+	Yearly  bool
+	Rule    *DateRule
+	Offsets []EventOffset
+}
+
+// An EventOffset is a number of days before (negative) or after (positive)
+// an Event, and the time of day on that day.
+type EventOffset struct {
+	Days   int
+	Hour   int
+	Minute int
+}
+
+// Returns the date of the Event in year, at midnight UTC. The bool is false
+// if the Event does not happen in year.
+func (e *Event) occurrence(year int) (time.Time, bool) {
+	if e.Rule != nil {
+		return e.Rule.Date(year)
+	}
+	if !e.Yearly {
+		return e.Date, e.Date.Year() == year
+	}
+	date := time.Date(year, e.Date.Month(), e.Date.Day(), 0, 0, 0, 0, time.UTC)
+	if date.Month() != e.Date.Month() {
+		// February 29 in a year that is not a leap year
+		date = time.Date(year, e.Date.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+	}
+	return date, true
+}
+
+// Tells the caller whether the Event happens on day, which must be at
+// midnight UTC.
+func (e *Event) On(day time.Time) bool {
+	if e.Rule != nil {
+		return e.Rule.On(day)
+	}
+	date, ok := e.occurrence(day.Year())
+	return ok && date.Equal(day)
+}
+
+// Returns the first date on or after day, which must be at midnight UTC, on
+// which the Event happens. The bool is false if it never happens again.
+func (e *Event) Next(day time.Time) (time.Time, bool) {
+	// a date rule's offset can move its date into the year before
+	for year := day.Year() - 1; year <= day.Year()+1; year++ {
+		date, ok := e.occurrence(year)
+		if ok && !date.Before(day) {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Describes the date of the Event, for example "March 14 each year".
+func (e *Event) describe() string {
+	if e.Rule != nil {
+		return e.Rule.Describe()
+	}
+	if e.Yearly {
+		return fmt.Sprintf("%s %d each year", e.Date.Month(), e.Date.Day())
+	}
+	return e.Date.Format("2006-01-02")
+}
+
+// Replaces the "{days_remaining}" and "{event_date}" placeholders in message.
+// If one of triggers is an EventTrigger for e that runs at current_time, the
+// event that it counts to is used, so that an offset of "+1d" gives -1 days
+// remaining. Otherwise the next occurrence of e on or after the day of
+// current_time is used. If e will not happen again, message is returned
+// unchanged.
+func (e *Event) render(message string, triggers []Trigger, current_time time.Time) string {
+	today := civilDate(current_time)
+	date, ok := e.Next(today)
+	walkTriggers(triggers, func(trigger Trigger) error {
+		if et, is_event := trigger.(*EventTrigger); is_event && et.Event == e && et.ShouldRun(current_time) {
+			date, ok = today.AddDate(0, 0, -et.Offset.Days), true
+		}
+		return nil
+	})
+	if !ok {
+		return message
+	}
+	days := int(date.Sub(today).Hours() / 24)
+	return strings.NewReplacer(
+		"{days_remaining}", strconv.Itoa(days),
+		"{event_date}", date.Format("2006-01-02"),
+	).Replace(message)
+}
+
+// EventTrigger is a type of Trigger that runs at a time of day on a day that
+// is a number of days before or after an Event. EventTriggers are made from
+// the "offsets" of a reminder's "event" key rather than listed under
+// "triggers".
+type EventTrigger struct {
+	Event  *Event
+	Offset EventOffset
+}
+
+// Returns the type of the Trigger.
+func (et *EventTrigger) TriggerType() string {
+	return "event"
+}
+
+// Given a time as a time.Time object, tells the caller whether the
+// EventTrigger should run at this time.
+func (et *EventTrigger) ShouldRun(current_time time.Time) bool {
+	if current_time.Hour() != et.Offset.Hour || current_time.Minute() != et.Offset.Minute {
+		return false
+	}
+	return et.Event.On(civilDate(current_time).AddDate(0, 0, -et.Offset.Days))
+}
+
+// Returns an English description of when the EventTrigger runs, for example
+// "7 days before March 14 each year at 09:00".
+func (et *EventTrigger) Describe() string {
+	at := fmt.Sprintf("at %02d:%02d", et.Offset.Hour, et.Offset.Minute)
+	switch {
+	case et.Offset.Days < 0:
+		return fmt.Sprintf("%s before %s %s", CountOf(-et.Offset.Days, "day"), et.Event.describe(), at)
+	case et.Offset.Days > 0:
+		return fmt.Sprintf("%s after %s %s", CountOf(et.Offset.Days, "day"), et.Event.describe(), at)
+	default:
+		return fmt.Sprintf("on %s %s", et.Event.describe(), at)
+	}
+}
+
+// EventTriggers are created from a reminder's "event" key rather than from a
+// trigger_type, so they cannot be parsed directly.
+func (et *EventTrigger) ParseTriggerFromInterfaceMap(obj_map map[string]interface{}) error {
+	return fmt.Errorf("EventTrigger cannot be parsed directly")
+}
+
+// Returns an EventTrigger for each of the Event's offsets.
+func (e *Event) Triggers() []Trigger {
+	triggers := make([]Trigger, 0, len(e.Offsets))
+	for _, offset := range e.Offsets {
+		triggers = append(triggers, &EventTrigger{Event: e, Offset: offset})
+	}
+	return triggers
+}
+
+// Parses the value of a reminder's "event" key into an Event.
+func parseEvent(i interface{}) (*Event, error) {
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value of key \"event\" into a map")
+	}
+	e := &Event{}
+	hour, minute := 9, 0
+	raw_offsets := []string{}
+	for key, value := range obj_map {
+		switch key {
+		case "date":
+			str_value, ok := stringValue(value)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"date\" into string")
+			}
+			if date, err := time.Parse("2006-01-02", str_value); err == nil {
+				e.Date = date
+			} else if date, err := time.Parse("01-02", str_value); err == nil {
+				// a leap year, so that February 29 is kept
+				e.Date = time.Date(2000, date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+				e.Yearly = true
+			} else if rule, err := ParseDateRule(str_value); err == nil {
+				e.Rule = rule
+				e.Yearly = true
+			} else {
+				return nil, fmt.Errorf("event date \"%s\" is not a date (YYYY-MM-DD), a month and day (MM-DD) "+
+					"or a date rule", str_value)
+			}
+		case "time":
+			str_value, ok := stringValue(value)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"time\" into string")
+			}
+			var err error
+			hour, minute, err = parseTimeOfDay(str_value)
+			if err != nil {
+				return nil, err
+			}
+		case "offsets":
+			var err error
+			raw_offsets, err = stringList(key, value)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("the key \"%s\" is not a valid event key", key)
+		}
+	}
+	if e.Date.IsZero() && e.Rule == nil {
+		return nil, fmt.Errorf("events must have a date")
+	}
+	if len(raw_offsets) == 0 {
+		return nil, fmt.Errorf("events must have at least one offset")
+	}
+	for _, raw_offset := range raw_offsets {
+		offset, err := parseEventOffset(raw_offset, hour, minute)
+		if err != nil {
+			return nil, err
+		}
+		e.Offsets = append(e.Offsets, offset)
+	}
+	return e, nil
+}
+
+// Parses an event offset like "-1d@18:00". Offsets without a time use hour
+// and minute.
+func parseEventOffset(value string, hour, minute int) (EventOffset, error) {
+	match := eventOffsetRegexp.FindStringSubmatch(value)
+	if match == nil {
+		return EventOffset{}, fmt.Errorf("event offset \"%s\" is not like \"-7d\" or \"-1d@18:00\"", value)
+	}
+	days, err := strconv.Atoi(match[1])
+	if err != nil || days < -365 || days > 365 {
+		return EventOffset{}, fmt.Errorf("event offset \"%s\" must be within 365 days of the event", value)
+	}
+	if match[2] != "" {
+		hour, minute, err = parseTimeOfDay(match[2])
+		if err != nil {
+			return EventOffset{}, err
+		}
+	}
+	return EventOffset{Days: days, Hour: hour, Minute: minute}, nil
+}
@@ -0,0 +1,131 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+const testEventConfig = `
+- version: v2
+  id: birthday
+  message: "{days_remaining} days until Sam's birthday on {event_date}"
+  timezone: Europe/Paris
+  event:
+    date: "01-02"
+    offsets: ["-7d", "-1d@18:00", "0d", "+1d@10:00"]
+`
+
+func TestEvent(t *testing.T) {
+	reminder_list, err := ParseConfig([]byte(testEventConfig), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if len(r.Triggers) != 4 {
+		t.Fatalf("got %d triggers (4 expected)", len(r.Triggers))
+	}
+
+	paris, _ := time.LoadLocation("Europe/Paris")
+	test_cases := map[time.Time]bool{
+		// a week before is in the previous year
+		time.Date(2020, time.December, 26, 9, 0, 0, 0, paris): true,
+		time.Date(2021, time.January, 1, 18, 0, 0, 0, paris):  true,
+		time.Date(2021, time.January, 1, 9, 0, 0, 0, paris):   false,
+		time.Date(2021, time.January, 2, 9, 0, 0, 0, paris):   true,
+		time.Date(2021, time.January, 3, 10, 0, 0, 0, paris):  true,
+		time.Date(2021, time.January, 3, 9, 0, 0, 0, paris):   false,
+		time.Date(2021, time.January, 4, 9, 0, 0, 0, paris):   false,
+		time.Date(2021, time.December, 26, 9, 0, 0, 0, paris): true,
+	}
+	for test_time, expected := range test_cases {
+		if r.ShouldRun(test_time) != expected {
+			t.Errorf("ShouldRun returned %t at %s (%t expected)", !expected, test_time, expected)
+		}
+	}
+
+	messages := map[time.Time]string{
+		time.Date(2020, time.December, 26, 9, 0, 0, 0, paris): "7 days until Sam's birthday on 2021-01-02",
+		time.Date(2021, time.January, 1, 18, 0, 0, 0, paris):  "1 days until Sam's birthday on 2021-01-02",
+		time.Date(2021, time.January, 2, 9, 0, 0, 0, paris):   "0 days until Sam's birthday on 2021-01-02",
+		// the day after counts back to the event that just happened
+		time.Date(2021, time.January, 3, 10, 0, 0, 0, paris): "-1 days until Sam's birthday on 2021-01-02",
+		// the time zone of the reminder is used to find the day
+		time.Date(2021, time.January, 1, 23, 30, 0, 0, time.UTC): "0 days until Sam's birthday on 2021-01-02",
+	}
+	for test_time, expected := range messages {
+		if message := r.RenderMessage(test_time); message != expected {
+			t.Errorf("got message \"%s\" at %s (\"%s\" expected)", message, test_time, expected)
+		}
+	}
+
+	expected := "7 days before January 2 each year at 09:00; or 1 day before January 2 each year at 18:00; " +
+		"or on January 2 each year at 09:00; or 1 day after January 2 each year at 10:00"
+	if r.Describe() != expected {
+		t.Errorf("got description \"%s\" (\"%s\" expected)", r.Describe(), expected)
+	}
+}
+
+func TestEventOneOff(t *testing.T) {
+	config := `[{"version": "v2", "message": "taxes due in {days_remaining} days",
+		"event": {"date": "2021-04-30", "time": "08:15", "offsets": ["-3d"]},
+		"triggers": [{"trigger_type": "weekly", "weekday": "monday", "time": "08:00"}]}]`
+	reminder_list, err := ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if len(r.Triggers) != 2 {
+		t.Fatalf("got %d triggers (2 expected)", len(r.Triggers))
+	}
+	if !r.ShouldRun(time.Date(2021, time.April, 27, 8, 15, 0, 0, time.Local)) {
+		t.Error("did not run three days before the event")
+	}
+	if r.ShouldRun(time.Date(2022, time.April, 27, 8, 15, 0, 0, time.Local)) {
+		t.Error("ran three days before the event a year later")
+	}
+
+	// other triggers count down to the next occurrence
+	monday := time.Date(2021, time.April, 19, 8, 0, 0, 0, time.Local)
+	if message := r.RenderMessage(monday); message != "taxes due in 11 days" {
+		t.Errorf("got message \"%s\" (\"taxes due in 11 days\" expected)", message)
+	}
+	// once the event has passed there is nothing to count down to
+	later := time.Date(2021, time.May, 3, 8, 0, 0, 0, time.Local)
+	if message := r.RenderMessage(later); message != r.Message {
+		t.Errorf("got message \"%s\" (\"%s\" expected)", message, r.Message)
+	}
+}
+
+func TestEventLeapDay(t *testing.T) {
+	e := &Event{Date: time.Date(2000, time.February, 29, 0, 0, 0, 0, time.UTC), Yearly: true}
+	if !e.On(time.Date(2021, time.February, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Error("February 29 event did not happen on February 28 2021")
+	}
+	if e.On(time.Date(2024, time.February, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Error("February 29 event happened on February 28 2024")
+	}
+	if !e.On(time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Error("February 29 event did not happen on February 29 2024")
+	}
+}
+
+func TestEventAbnormal(t *testing.T) {
+	test_cases := []string{
+		`{"offsets": ["-1d"]}`,
+		`{"date": "03-14"}`,
+		`{"date": "03-14", "offsets": []}`,
+		`{"date": "14/03", "offsets": ["-1d"]}`,
+		`{"date": "03-14", "offsets": ["-1w"]}`,
+		`{"date": "03-14", "offsets": ["-1d@25:00"]}`,
+		`{"date": "03-14", "offsets": ["-400d"]}`,
+		`{"date": "03-14", "time": "noon", "offsets": ["-1d"]}`,
+		`{"date": "03-14", "offsets": ["-1d"], "yearly": true}`,
+		`"03-14"`,
+	}
+	for _, event := range test_cases {
+		config := `[{"version": "v2", "event": ` + event + `}]`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with event %s", event)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package reminder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The things that can happen to a message that is sent when the budget has
+// run out.
+const (
+	BudgetDrop      = "drop"
+	BudgetSummarize = "summarize"
+)
+
+// Limits caps the number of messages that are sent, so that a mistake in a
+// config can't send thousands of them. They are given under the top-level
+// "limits" key of a config, which only one config file may have:
+//
+// "rate" and "burst": a rate limit on all messages. See RateLimit.
+//
+// "daily_budget" and "monthly_budget": the most messages that are sent in a
+// day or a calendar month, in the local time zone. Zero means no budget.
+//
+// "budget_action": what happens to messages once a budget has run out:
+// "drop" (the default) throws them away, and "summarize" counts them, so that
+// each recipient can be sent a single summary of what they missed once there
+// is budget again.
+type Limits struct {
+	Rate          *RateLimit
+	DailyBudget   int
+	MonthlyBudget int
+	BudgetAction  string
+	Source        string
+}
+
+// A RateLimit is a token bucket: Burst messages may be sent at once, and
+// after that Count messages every Period. In a config it is given as a "rate"
+// like "10/h" or "3/15m", with an optional "burst" that defaults to the count.
+type RateLimit struct {
+	Count  int
+	Period time.Duration
+	Burst  int
+}
+
+// Returns an English description of l, for example "at most 10 messages per
+// hour; at most 100 messages a day (then dropped)".
+func (l *Limits) Describe() string {
+	parts := make([]string, 0, 3)
+	if l.Rate != nil {
+		parts = append(parts, l.Rate.Describe())
+	}
+	budgets := make([]string, 0, 2)
+	if l.DailyBudget > 0 {
+		budgets = append(budgets, CountOf(l.DailyBudget, "message")+" a day")
+	}
+	if l.MonthlyBudget > 0 {
+		budgets = append(budgets, CountOf(l.MonthlyBudget, "message")+" a month")
+	}
+	if len(budgets) > 0 {
+		action := "dropped"
+		if l.BudgetAction == BudgetSummarize {
+			action = "summarized"
+		}
+		parts = append(parts, fmt.Sprintf("at most %s (then %s)", joinEnglish(budgets, "and"), action))
+	}
+	if len(parts) == 0 {
+		return "no limits"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Returns an English description of rl, for example "at most 10 messages per
+// hour, in bursts of up to 3".
+func (rl *RateLimit) Describe() string {
+	description := fmt.Sprintf("at most %s per %s", CountOf(rl.Count, "message"), describePeriod(rl.Period))
+	if rl.Burst != rl.Count {
+		description = description + fmt.Sprintf(", in bursts of up to %d", rl.Burst)
+	}
+	return description
+}
+
+// Returns an English description of a rate limit's period, for example
+// "hour" or "15 minutes".
+func describePeriod(period time.Duration) string {
+	switch period {
+	case time.Second:
+		return "second"
+	case time.Minute:
+		return "minute"
+	case time.Hour:
+		return "hour"
+	case 24 * time.Hour:
+		return "day"
+	}
+	return describeDuration(period)
+}
+
+// Parses the value of a config's "limits" key.
+func parseLimits(i interface{}) (*Limits, error) {
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value of key \"limits\" into a map")
+	}
+	l := &Limits{BudgetAction: BudgetDrop}
+	rate, err := parseRateKeys(obj_map)
+	if err != nil {
+		return nil, err
+	}
+	l.Rate = rate
+	for key, value := range obj_map {
+		switch key {
+		case "rate", "burst":
+			// parsed by parseRateKeys
+		case "daily_budget", "monthly_budget":
+			budget, err := positiveInt(key, value)
+			if err != nil {
+				return nil, err
+			}
+			if key == "daily_budget" {
+				l.DailyBudget = budget
+			} else {
+				l.MonthlyBudget = budget
+			}
+		case "budget_action":
+			action, ok := value.(string)
+			if !ok || (action != BudgetDrop && action != BudgetSummarize) {
+				return nil, fmt.Errorf("budget_action must be \"%s\" or \"%s\"", BudgetDrop, BudgetSummarize)
+			}
+			l.BudgetAction = action
+		default:
+			return nil, fmt.Errorf("the key \"%s\" is not a valid limits key", key)
+		}
+	}
+	return l, nil
+}
+
+// Parses the "rate" and "burst" keys of obj_map into a RateLimit. If there is
+// no "rate" key, nil is returned.
+func parseRateKeys(obj_map map[string]interface{}) (*RateLimit, error) {
+	raw_rate, has_rate := obj_map["rate"]
+	raw_burst, has_burst := obj_map["burst"]
+	if !has_rate {
+		if has_burst {
+			return nil, fmt.Errorf("burst needs a rate")
+		}
+		return nil, nil
+	}
+	value, ok := raw_rate.(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value of key \"rate\" into string")
+	}
+	rate, err := parseRateLimit(value)
+	if err != nil {
+		return nil, err
+	}
+	if has_burst {
+		burst, err := positiveInt("burst", raw_burst)
+		if err != nil {
+			return nil, err
+		}
+		rate.Burst = burst
+	}
+	return rate, nil
+}
+
+// Parses a rate like "10/h", "100/d" or "3/15m" into a RateLimit whose Burst
+// is its Count.
+func parseRateLimit(value string) (*RateLimit, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rate \"%s\" is not a count and a period like \"10/h\"", value)
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("rate \"%s\" does not start with a positive whole number", value)
+	}
+	period_value := parts[1]
+	if period_value != "" && strings.IndexAny(period_value[:1], "0123456789") == -1 {
+		period_value = "1" + period_value
+	}
+	period, err := parseLongDuration(period_value)
+	if err != nil || period <= 0 {
+		return nil, fmt.Errorf("rate \"%s\" does not end with a period like \"h\" or \"15m\"", value)
+	}
+	return &RateLimit{Count: count, Period: period, Burst: count}, nil
+}
+
+// Parses value, the value of key, as a positive whole number.
+func positiveInt(key string, value interface{}) (int, error) {
+	str_value, ok := stringValue(value)
+	if !ok {
+		return 0, fmt.Errorf("failed to parse value of key \"%s\" into a whole number", key)
+	}
+	number, err := strconv.Atoi(str_value)
+	if err != nil || number < 1 {
+		return 0, fmt.Errorf("%s must be a positive whole number", key)
+	}
+	return number, nil
+}
@@ -0,0 +1,87 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	test_cases := []struct {
+		value       string
+		count       int
+		period      time.Duration
+		description string
+	}{
+		{"10/h", 10, time.Hour, "at most 10 messages per hour"},
+		{"1/m", 1, time.Minute, "at most 1 message per minute"},
+		{"3/15m", 3, 15 * time.Minute, "at most 3 messages per 15 minutes"},
+		{"100/d", 100, 24 * time.Hour, "at most 100 messages per day"},
+	}
+	for _, test_case := range test_cases {
+		rate, err := parseRateLimit(test_case.value)
+		if err != nil {
+			t.Errorf("got unexpected error for rate \"%s\": %s", test_case.value, err)
+			continue
+		}
+		if rate.Count != test_case.count || rate.Period != test_case.period || rate.Burst != test_case.count {
+			t.Errorf("rate \"%s\" parsed to %v", test_case.value, rate)
+		}
+		if rate.Describe() != test_case.description {
+			t.Errorf("got description \"%s\" (\"%s\" expected)", rate.Describe(), test_case.description)
+		}
+	}
+
+	for _, value := range []string{"10", "0/h", "-1/h", "ten/h", "10/", "10/fortnight", "10/0m"} {
+		if _, err := parseRateLimit(value); err == nil {
+			t.Errorf("no error when there should have been with rate \"%s\"", value)
+		}
+	}
+}
+
+func TestLoadLimits(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"a.json": `{"limits": {"rate": "10/h", "burst": 3, "daily_budget": 100, "monthly_budget": 1000,
+			"budget_action": "summarize"}}`,
+		"b.yaml": "recipients:\n  \"+15555550123\":\n    rate: 5/h\n",
+	})
+	loaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	expected := "at most 10 messages per hour, in bursts of up to 3; at most 100 messages a day and " +
+		"1000 messages a month (then summarized)"
+	if loaded.Limits == nil || loaded.Limits.Describe() != expected {
+		t.Errorf("got limits %v (\"%s\" expected)", loaded.Limits, expected)
+	}
+	recipient := loaded.Recipients["+15555550123"]
+	if recipient == nil || recipient.Rate == nil || recipient.Rate.Count != 5 || recipient.Rate.Burst != 5 {
+		t.Errorf("got recipient %v", recipient)
+	}
+
+	dir = writeConfigDir(t, map[string]string{
+		"a.json": `{"limits": {"daily_budget": 10}}`,
+		"b.json": `{"limits": {"monthly_budget": 100}}`,
+	})
+	if _, err := LoadConfig(dir); err == nil {
+		t.Error("no error for limits defined in two files")
+	}
+}
+
+func TestLimitsAbnormal(t *testing.T) {
+	test_cases := []string{
+		`"10/h"`,
+		`{"rate": 10}`,
+		`{"rate": "10/h", "burst": 0}`,
+		`{"burst": 3}`,
+		`{"daily_budget": -1}`,
+		`{"monthly_budget": "lots"}`,
+		`{"daily_budget": 10, "budget_action": "queue"}`,
+		`{"weekly_budget": 10}`,
+	}
+	for _, limits := range test_cases {
+		config := `{"reminders": [], "limits": ` + limits + `}`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with limits %s", limits)
+		}
+	}
+}
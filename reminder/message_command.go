@@ -0,0 +1,218 @@
+package reminder
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMessageCommandTimeout is how long a MessageCommand may run for if it
+// does not give a timeout.
+const DefaultMessageCommandTimeout = 10 * time.Second
+
+// DefaultMessageCommandMaxLength is the number of characters that a
+// MessageCommand's output is cut to if it does not give a max_length.
+const DefaultMessageCommandMaxLength = 320
+
+// DefaultMessageCommandEnv is the environment variables that are passed to a
+// MessageCommand if it does not give an env.
+var DefaultMessageCommandEnv = []string{"PATH", "HOME"}
+
+// OutputPlaceholder is replaced in a reminder's message with the output of
+// its MessageCommand.
+const OutputPlaceholder = "{output}"
+
+// maxCommandOutput is the most bytes of a MessageCommand's output that are
+// read. Anything after it is ignored.
+const maxCommandOutput = 64 * 1024
+
+// A MessageCommand is a command whose output becomes a reminder's message,
+// or fills in the "{output}" placeholder in it. It is given under a reminder's
+// "message_command" key:
+//
+// "command": the command to run, either as a list of arguments or as a string
+// that is run with /bin/sh -c. Its standard output, with leading and trailing
+// white space trimmed, is the output. Its standard error is discarded.
+//
+// "timeout": how long the command may run for, such as "5s". Defaults to 10
+// seconds, and may be at most MaxCommandTimeout.
+//
+// "env": the names of the environment variables that are passed on to the
+// command. No others are. Defaults to PATH and HOME.
+//
+// "max_length": the number of characters that the output is cut to. Defaults
+// to 320.
+//
+// "fallback": the text that is used in place of the output if the command
+// fails, times out or has no output. If it is empty, the reminder is not sent
+// when that happens.
+type MessageCommand struct {
+	Command   []string
+	Timeout   time.Duration
+	Env       []string
+	MaxLength int
+	Fallback  string
+}
+
+// Runs the command and returns its output, trimmed and cut to m.MaxLength
+// characters. An error is returned if the command could not be run, timed out,
+// exited with a status other than 0, or had no output.
+func (m *MessageCommand) Output() (string, error) {
+	out_file, err := ioutil.TempFile("", "text-me-when-output")
+	if err != nil {
+		return "", fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(out_file.Name())
+	defer out_file.Close()
+
+	// the output goes to a file rather than a pipe, so that the command's
+	// children can't keep it from being killed at its timeout
+	err = runWithTimeout(m.Command, m.timeout(), m.environment(), out_file)
+	if err != nil {
+		return "", fmt.Errorf("command %s failed: %w", quoteCommand(m.Command), err)
+	}
+	if _, err := out_file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read output of command %s: %w", quoteCommand(m.Command), err)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(out_file, maxCommandOutput))
+	if err != nil {
+		return "", fmt.Errorf("failed to read output of command %s: %w", quoteCommand(m.Command), err)
+	}
+	output := strings.TrimSpace(strings.ToValidUTF8(string(data), ""))
+	if output == "" {
+		return "", fmt.Errorf("command %s had no output", quoteCommand(m.Command))
+	}
+	return truncateRunes(output, m.maxLength()), nil
+}
+
+func (m *MessageCommand) timeout() time.Duration {
+	if m.Timeout == 0 {
+		return DefaultMessageCommandTimeout
+	}
+	return m.Timeout
+}
+
+func (m *MessageCommand) maxLength() int {
+	if m.MaxLength == 0 {
+		return DefaultMessageCommandMaxLength
+	}
+	return m.MaxLength
+}
+
+// Returns the command's environment: the variables named in m.Env, with the
+// values that they have in text-me-when's own environment. Variables that are
+// not set are left out.
+func (m *MessageCommand) environment() []string {
+	names := m.Env
+	if names == nil {
+		names = DefaultMessageCommandEnv
+	}
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// Returns an English description of the MessageCommand, for example
+// "output of \"df -h /\" (fallback \"disk usage unknown\")".
+func (m *MessageCommand) Describe() string {
+	description := "output of " + quoteCommand(m.Command)
+	if m.Fallback != "" {
+		description = description + fmt.Sprintf(" (fallback %q)", m.Fallback)
+	}
+	return description
+}
+
+// Returns message with the output of m filled in: the output replaces the
+// "{output}" placeholder, or is the whole message if message is empty.
+func fillOutput(message string, output string) string {
+	if message == "" {
+		return output
+	}
+	return strings.Replace(message, OutputPlaceholder, output, -1)
+}
+
+// Returns s cut to at most n characters.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// Parses the value of a reminder's "message_command" key into a
+// MessageCommand.
+func parseMessageCommand(i interface{}) (*MessageCommand, error) {
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value of key \"message_command\" into a map")
+	}
+	m := &MessageCommand{}
+	for key, value := range obj_map {
+		switch key {
+		case "command":
+			command, err := parseCommand(key, value)
+			if err != nil {
+				return nil, err
+			}
+			m.Command = command
+		case "timeout":
+			timeout, err := parseTimeout(value)
+			if err != nil {
+				return nil, err
+			}
+			m.Timeout = timeout
+		case "env":
+			env, err := stringList(key, value)
+			if err != nil {
+				return nil, err
+			}
+			for _, name := range env {
+				if name == "" || strings.Contains(name, "=") {
+					return nil, fmt.Errorf("\"%s\" is not the name of an environment variable", name)
+				}
+			}
+			m.Env = env
+		case "max_length":
+			str_value, ok := stringValue(value)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"max_length\" into a whole number")
+			}
+			max_length, err := strconv.Atoi(str_value)
+			if err != nil || max_length < 1 {
+				return nil, fmt.Errorf("max_length must be a positive whole number")
+			}
+			m.MaxLength = max_length
+		case "fallback":
+			fallback, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"fallback\" into string")
+			}
+			m.Fallback = fallback
+		default:
+			return nil, fmt.Errorf("the key \"%s\" is not a valid message_command key", key)
+		}
+	}
+	if m.Command == nil {
+		return nil, fmt.Errorf("a message_command must have a \"command\"")
+	}
+	return m, nil
+}
+
+// Checks that a reminder's message can take the output of its MessageCommand:
+// it must either be empty or have the "{output}" placeholder in it.
+func checkMessageCommand(message string, m *MessageCommand) error {
+	if m != nil && message != "" && !strings.Contains(message, OutputPlaceholder) {
+		return fmt.Errorf("the message must be empty or contain %s when there is a message_command",
+			OutputPlaceholder)
+	}
+	return nil
+}
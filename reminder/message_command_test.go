@@ -0,0 +1,111 @@
+package reminder
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestMessageCommand(t *testing.T, message string, message_command string) *ReminderV2 {
+	t.Helper()
+	r := parseTestReminder(t, message, "message_command", message_command)
+	if r.MessageCommand == nil {
+		t.Fatalf("message_command %s was not kept when upgrading to v2", message_command)
+	}
+	return r
+}
+
+func TestBuildMessage(t *testing.T) {
+	os.Setenv("TEXT_ME_WHEN_TEST_VALUE", "secret")
+	defer os.Unsetenv("TEXT_ME_WHEN_TEST_VALUE")
+
+	test_cases := []struct {
+		message         string
+		message_command string
+		expected        string
+		fails           bool
+	}{
+		{"", `{"command": "echo '  3 TODOs  '"}`, "3 TODOs", false},
+		{"Disk: {output}", `{"command": ["echo", "42%"]}`, "Disk: 42%", false},
+		{"{output} and {output}", `{"command": "echo hi"}`, "hi and hi", false},
+		{"", `{"command": "printf 'ünïcödé'", "max_length": 3}`, "ünï", false},
+		{"", `{"command": "echo \"[$TEXT_ME_WHEN_TEST_VALUE]\""}`, "[]", false},
+		{"", `{"command": "echo \"[$TEXT_ME_WHEN_TEST_VALUE]\"", "env": ["TEXT_ME_WHEN_TEST_VALUE"]}`,
+			"[secret]", false},
+		{"", `{"command": "echo \"[$HOME]\"", "env": []}`, "[]", false},
+		{"Disk: {output}", `{"command": "exit 1", "fallback": "unknown"}`, "Disk: unknown", true},
+		{"Disk: {output}", `{"command": "exit 1"}`, "", true},
+		{"Disk: {output}", `{"command": "true", "fallback": "unknown"}`, "Disk: unknown", true},
+		{"Disk: {output}", `{"command": ["no-such-command-exists"], "fallback": "unknown"}`, "Disk: unknown", true},
+	}
+	for _, test_case := range test_cases {
+		r := parseTestMessageCommand(t, test_case.message, test_case.message_command)
+		message, err := r.BuildMessage(time.Now())
+		if message != test_case.expected {
+			t.Errorf("message_command %s gave \"%s\" (\"%s\" expected)", test_case.message_command, message,
+				test_case.expected)
+		}
+		if (err != nil) != test_case.fails {
+			t.Errorf("message_command %s gave error %v", test_case.message_command, err)
+		}
+	}
+}
+
+func TestBuildMessageTimeout(t *testing.T) {
+	r := parseTestMessageCommand(t, "", `{"command": "sleep 5; echo late", "timeout": "100ms", "fallback": "on time"}`)
+	start := time.Now()
+	message, err := r.BuildMessage(start)
+	if message != "on time" || err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("got message \"%s\" and error %v", message, err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("command was not killed at its timeout")
+	}
+}
+
+func TestBuildMessageEvent(t *testing.T) {
+	config := `[{"version": "v2", "message": "{days_remaining} days, {output}",
+		"message_command": {"command": "echo '{days_remaining}'"},
+		"event": {"date": "2021-03-10", "offsets": ["-2d@09:00"]}}]`
+	reminder_list, err := ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	current_time := time.Date(2021, time.March, 8, 9, 0, 0, 0, time.Local)
+	message, err := reminder_list[0].BuildMessage(current_time)
+	// placeholders in the output of the command are not filled in
+	if err != nil || message != "2 days, {days_remaining}" {
+		t.Errorf("got message \"%s\" and error %v", message, err)
+	}
+}
+
+func TestMessageCommandAbnormal(t *testing.T) {
+	test_cases := []struct {
+		message         string
+		message_command string
+	}{
+		{"Static message", `{"command": "true"}`},
+		{"", `{}`},
+		{"", `"echo hi"`},
+		{"", `{"command": ""}`},
+		{"", `{"command": []}`},
+		{"", `{"command": "true", "timeout": "3d"}`},
+		{"", `{"command": "true", "timeout": "-1s"}`},
+		{"", `{"command": "true", "timeout": "1m"}`},
+		{"", `{"command": "true", "max_length": 0}`},
+		{"", `{"command": "true", "env": ["A=B"]}`},
+		{"", `{"command": "true", "fallback": 3}`},
+		{"", `{"command": "true", "output": "x"}`},
+	}
+	for _, test_case := range test_cases {
+		for _, version := range []string{"v1", "v2"} {
+			config := `[{"version": "` + version + `", "message": "` + test_case.message +
+				`", "message_command": ` + test_case.message_command + `, "triggers": []}]`
+			if _, err := ParseConfig([]byte(config), "json"); err == nil {
+				t.Errorf("no error when there should have been with %s message_command %s", version,
+					test_case.message_command)
+			}
+		}
+	}
+}
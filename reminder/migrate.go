@@ -0,0 +1,70 @@
+package reminder
+
+import (
+	"fmt"
+)
+
+// Rewrites a reminders config in the given format so that every reminder uses
+// the latest schema version (v2). Returns the new config and the number of
+// reminders that were migrated. If no reminders needed migrating, data is
+// returned unchanged. Since the config is decoded and encoded again, comments
+// and key order are not preserved in migrated configs.
+func MigrateConfig(data []byte, format string) ([]byte, int, error) {
+	raw, err := decodeFormat(data, format)
+	if err != nil {
+		return nil, 0, err
+	}
+	interface_list, err := reminderList(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	migrated := 0
+	for i, item := range interface_list {
+		obj_map, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, 0, fmt.Errorf("reminder %d: failed to parse reminder into a map", i)
+		}
+		changed, err := migrateReminder(obj_map)
+		if err != nil {
+			return nil, 0, fmt.Errorf("reminder %d: %w", i, err)
+		}
+		if changed {
+			migrated = migrated + 1
+		}
+	}
+	if migrated == 0 {
+		return data, 0, nil
+	}
+
+	if _, ok := raw.(map[string]interface{}); !ok && format == "toml" {
+		raw = map[string]interface{}{"reminders": interface_list}
+	}
+	new_data, err := encodeFormat(raw, format)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := ParseConfig(new_data, format); err != nil {
+		return nil, 0, fmt.Errorf("migrated config is invalid: %w", err)
+	}
+	return new_data, migrated, nil
+}
+
+// Migrates a single decoded reminder to v2 in place, and tells the caller
+// whether it changed. Every v1 key means the same thing in v2, so only the
+// version changes.
+func migrateReminder(obj_map map[string]interface{}) (bool, error) {
+	version, ok := stringValue(obj_map["version"])
+	if !ok {
+		return false, fmt.Errorf("failed to parse value of key \"version\" into string")
+	}
+	switch version {
+	case "v1":
+		obj_map["version"] = "v2"
+		return true, nil
+	case "v2":
+		return false, nil
+	default:
+		return false, fmt.Errorf("reminder version \"%s\" is not supported", version)
+	}
+}
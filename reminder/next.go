@@ -0,0 +1,96 @@
+package reminder
+
+import (
+	"time"
+)
+
+// NextRunHorizon is how far ahead NextRun and Occurrences look for times when
+// a reminder is sent.
+const NextRunHorizon = 366 * 24 * time.Hour
+
+// MaxSkippedOccurrences is the most skipped Occurrences that Occurrences and
+// OccurrencesUntil return. A reminder that runs every minute or second during
+// a long exclusion would otherwise be skipped tens of thousands of times.
+const MaxSkippedOccurrences = 100
+
+// An Occurrence is a time at which a reminder is sent, or would have been
+// sent if it had not been skipped.
+type Occurrence struct {
+	Time    time.Time
+	Skipped bool
+	Reason  string
+}
+
+// Returns the times after after, and no more than NextRunHorizon after it,
+// at which r is sent, up to limit of them. Occurrences that are skipped
+// because of a Calendar are included, up to MaxSkippedOccurrences of them,
+// but do not count towards limit. Times are checked once a minute, on the minute, or once a second if r
+// uses seconds.
+func (r *ReminderV2) Occurrences(after time.Time, limit int) []Occurrence {
+	return r.OccurrencesUntil(after, after.Add(NextRunHorizon), limit)
+}
+
+// Like Occurrences, but returns the times after after and no later than end.
+func (r *ReminderV2) OccurrencesUntil(after time.Time, end time.Time, limit int) []Occurrence {
+	occurrences := make([]Occurrence, 0)
+	fired := 0
+	skipped := 0
+	precise := r.UsesSeconds()
+	for minute := after.Truncate(time.Minute); !minute.After(end); minute = minute.Add(time.Minute) {
+		seconds := 1
+		if precise && r.mayRunWithin(minute) {
+			seconds = 60
+		}
+		for second := 0; second < seconds; second++ {
+			current_time := minute.Add(time.Duration(second) * time.Second)
+			if !current_time.After(after) || current_time.After(end) {
+				continue
+			}
+			decision := r.Check(current_time)
+			if decision.Skipped && skipped < MaxSkippedOccurrences {
+				occurrences = append(occurrences, Occurrence{Time: current_time, Skipped: true, Reason: decision.Reason})
+				skipped = skipped + 1
+			}
+			if decision.Fire {
+				occurrences = append(occurrences, Occurrence{Time: current_time})
+				fired = fired + 1
+				if fired >= limit {
+					return occurrences
+				}
+			}
+		}
+	}
+	return occurrences
+}
+
+// Tells the caller whether any of r's Triggers that use seconds might run
+// during the minute that starts at minute. Checking every second of a year is
+// slow, so the seconds of a minute are only checked if this is true. It is
+// exact for CronTriggers and errs on the side of true for other Triggers.
+func (r *ReminderV2) mayRunWithin(minute time.Time) bool {
+	local_time := minute.In(r.location())
+	for _, trigger := range r.Triggers {
+		if !triggerUsesSeconds(trigger) {
+			continue
+		}
+		if et, ok := trigger.(*ExcludedTrigger); ok {
+			trigger = et.Trigger
+		}
+		ct, ok := trigger.(*CronTrigger)
+		if !ok || ct.matchesMinute(local_time) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the first time after after at which r is sent. If r is not sent
+// within NextRunHorizon, the returned bool is false.
+func (r *ReminderV2) NextRun(after time.Time) (time.Time, bool) {
+	for _, occurrence := range r.Occurrences(after, 1) {
+		if !occurrence.Skipped {
+			return occurrence.Time, true
+		}
+	}
+	return time.Time{}, false
+}
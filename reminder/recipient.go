@@ -0,0 +1,271 @@
+package reminder
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The things that can happen to a message that is sent during a recipient's
+// quiet hours.
+const (
+	QuietDrop  = "drop"
+	QuietDefer = "defer"
+)
+
+// maxQuietWindows is the most quiet hours windows that QuietUntil follows
+// when they run into each other.
+const maxQuietWindows = 16
+
+// A Recipient holds the delivery settings of a single phone number or SNS
+// topic. Recipients are given under the top-level "recipients" key of a
+// config, which maps phone numbers and topic ARNs to their settings:
+//
+// "timezone": the IANA name of the recipient's time zone, which quiet hours
+// are in. If empty, the local time zone is used.
+//
+// "quiet_hours": a list of windows, each with a "from" and "to" time (HH:MM)
+// and optional "weekdays", during which messages are not sent to the
+// recipient. A window whose to time is not after its from time runs past
+// midnight, and one whose from and to times are equal lasts a whole day. The
+// weekdays are those that a window starts on; by default it starts on every
+// day.
+//
+// "quiet_action": what happens to a message that is sent during quiet hours:
+// "defer" (the default) holds it until the quiet hours end, and "drop"
+// throws it away. Reminders that are marked as urgent are sent anyway.
+//
+// "rate" and "burst": a rate limit on the messages that are sent to the
+// recipient. See RateLimit. Messages over the limit are dropped.
+type Recipient struct {
+	Address     string
+	Timezone    string
+	Location    *time.Location
+	QuietHours  []QuietHours
+	QuietAction string
+	Rate        *RateLimit
+	Source      string
+}
+
+// QuietHours is a single window of a Recipient's quiet hours. From and To are
+// minutes after midnight.
+type QuietHours struct {
+	From     int
+	To       int
+	Weekdays []time.Weekday
+}
+
+// Tells the caller whether current_time is during r's quiet hours and, if it
+// is, when they end. Windows that run into each other are followed to the end
+// of the last one.
+func (r *Recipient) QuietUntil(current_time time.Time) (time.Time, bool) {
+	until := current_time
+	quiet := false
+	for i := 0; i < maxQuietWindows; i++ {
+		end, ok := r.windowEnd(until)
+		if !ok {
+			break
+		}
+		until, quiet = end, true
+	}
+	return until, quiet
+}
+
+// Returns the latest end of the quiet hours windows that current_time is in.
+func (r *Recipient) windowEnd(current_time time.Time) (time.Time, bool) {
+	local_time := current_time.In(r.location())
+	year, month, day := local_time.Date()
+	var latest time.Time
+	found := false
+	for _, window := range r.QuietHours {
+		// a window that contains local_time started today or yesterday
+		for days_ago := 0; days_ago <= 1; days_ago++ {
+			start_day := time.Date(year, month, day-days_ago, 0, 0, 0, 0, r.location())
+			if !window.startsOn(start_day.Weekday()) {
+				continue
+			}
+			start, end := window.span(start_day)
+			if !local_time.Before(start) && local_time.Before(end) && end.After(latest) {
+				latest, found = end, true
+			}
+		}
+	}
+	return latest, found
+}
+
+func (r *Recipient) location() *time.Location {
+	if r.Location == nil {
+		return time.Local
+	}
+	return r.Location
+}
+
+// Returns an English description of r's quiet hours and rate limit, for
+// example "quiet from 22:00 to 07:00 every day (messages deferred)".
+func (r *Recipient) Describe() string {
+	description := "no quiet hours"
+	if len(r.QuietHours) > 0 {
+		windows := make([]string, 0, len(r.QuietHours))
+		for _, window := range r.QuietHours {
+			windows = append(windows, window.Describe())
+		}
+		action := "deferred"
+		if r.QuietAction == QuietDrop {
+			action = "dropped"
+		}
+		description = fmt.Sprintf("quiet %s (messages %s)", joinEnglish(windows, "and"), action)
+	}
+	if r.Rate != nil {
+		description = description + "; " + r.Rate.Describe()
+	}
+	return description
+}
+
+// Tells the caller whether the window starts on weekday.
+func (q *QuietHours) startsOn(weekday time.Weekday) bool {
+	if len(q.Weekdays) == 0 {
+		return true
+	}
+	for _, own_weekday := range q.Weekdays {
+		if own_weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the start and end of the window that starts on day, which must be
+// at midnight.
+func (q *QuietHours) span(day time.Time) (time.Time, time.Time) {
+	year, month, date := day.Date()
+	start := time.Date(year, month, date, 0, q.From, 0, 0, day.Location())
+	end_date := date
+	if q.To <= q.From {
+		end_date = date + 1
+	}
+	end := time.Date(year, month, end_date, 0, q.To, 0, 0, day.Location())
+	return start, end
+}
+
+// Returns an English description of the window, for example "from 22:00 to
+// 07:00 on Saturday and Sunday".
+func (q *QuietHours) Describe() string {
+	var description string
+	if q.From == q.To && q.From == 0 {
+		description = "all day"
+	} else if q.From == q.To {
+		description = fmt.Sprintf("for a day from %02d:%02d", q.From/60, q.From%60)
+	} else {
+		description = fmt.Sprintf("from %02d:%02d to %02d:%02d", q.From/60, q.From%60, q.To/60, q.To%60)
+	}
+	if len(q.Weekdays) == 0 || len(q.Weekdays) == 7 {
+		return description + " every day"
+	}
+	names := make([]string, 0, len(q.Weekdays))
+	for _, weekday := range q.Weekdays {
+		names = append(names, weekday.String())
+	}
+	return description + " on " + joinEnglish(names, "and")
+}
+
+// Parses a single recipient, as decoded from any config format.
+func parseRecipient(address string, i interface{}) (*Recipient, error) {
+	if err := CheckRecipient(address); err != nil {
+		return nil, err
+	}
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse recipient into a map")
+	}
+	r := &Recipient{Address: address, QuietAction: QuietDefer}
+	rate, err := parseRateKeys(obj_map)
+	if err != nil {
+		return nil, err
+	}
+	r.Rate = rate
+	for key, value := range obj_map {
+		switch key {
+		case "rate", "burst":
+			// parsed by parseRateKeys
+		case "timezone":
+			timezone, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"timezone\" into string")
+			}
+			r.Timezone = timezone
+		case "quiet_hours":
+			interface_list, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"quiet_hours\" into a list")
+			}
+			for _, item := range interface_list {
+				window, err := parseQuietHours(item)
+				if err != nil {
+					return nil, fmt.Errorf("quiet_hours: %w", err)
+				}
+				r.QuietHours = append(r.QuietHours, window)
+			}
+		case "quiet_action":
+			action, ok := value.(string)
+			if !ok || (action != QuietDrop && action != QuietDefer) {
+				return nil, fmt.Errorf("quiet_action must be \"%s\" or \"%s\"", QuietDefer, QuietDrop)
+			}
+			r.QuietAction = action
+		default:
+			return nil, fmt.Errorf("the key \"%s\" is not a valid recipient key", key)
+		}
+	}
+	location, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone \"%s\": %w", r.Timezone, err)
+	}
+	r.Location = location
+	return r, nil
+}
+
+// Parses a single window of a recipient's "quiet_hours" list.
+func parseQuietHours(i interface{}) (QuietHours, error) {
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return QuietHours{}, fmt.Errorf("failed to parse window into a map")
+	}
+	window := QuietHours{}
+	has_from, has_to := false, false
+	for key, value := range obj_map {
+		switch key {
+		case "from", "to":
+			str_value, ok := stringValue(value)
+			if !ok {
+				return QuietHours{}, fmt.Errorf("failed to parse value of key \"%s\" into string", key)
+			}
+			hour, minute, err := parseTimeOfDay(str_value)
+			if err != nil {
+				return QuietHours{}, err
+			}
+			if key == "from" {
+				window.From, has_from = hour*60+minute, true
+			} else {
+				window.To, has_to = hour*60+minute, true
+			}
+		case "weekdays":
+			values, err := stringList(key, value)
+			if err != nil {
+				return QuietHours{}, err
+			}
+			for _, value := range values {
+				weekday, err := parseWeekday(value)
+				if err != nil {
+					return QuietHours{}, err
+				}
+				window.Weekdays = append(window.Weekdays, weekday)
+			}
+			sort.Slice(window.Weekdays, func(a, b int) bool { return window.Weekdays[a] < window.Weekdays[b] })
+		default:
+			return QuietHours{}, fmt.Errorf("the key \"%s\" is not a valid quiet_hours key", key)
+		}
+	}
+	if !has_from || !has_to {
+		return QuietHours{}, fmt.Errorf("quiet hours must have a from and a to time")
+	}
+	return window, nil
+}
@@ -0,0 +1,127 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietUntil(t *testing.T) {
+	config := `{"recipients": {"+15555550123": {
+		"timezone": "America/Vancouver",
+		"quiet_hours": [
+			{"from": "22:00", "to": "07:00"},
+			{"from": "07:00", "to": "08:00", "weekdays": ["saturday"]},
+			{"from": "12:00", "to": "12:00", "weekdays": ["sunday"]}
+		]}}}`
+	dir := writeConfigDir(t, map[string]string{"a.json": config})
+	loaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	recipient, ok := loaded.Recipients["+15555550123"]
+	if !ok {
+		t.Fatalf("recipient was not loaded")
+	}
+	location, _ := time.LoadLocation("America/Vancouver")
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2021, month, day, hour, minute, 0, 0, location)
+	}
+
+	test_cases := []struct {
+		current_time time.Time
+		quiet        bool
+		until        time.Time
+	}{
+		// Wednesday 3 March 2021
+		{at(time.March, 3, 21, 59), false, time.Time{}},
+		{at(time.March, 3, 22, 0), true, at(time.March, 4, 7, 0)},
+		{at(time.March, 4, 3, 30), true, at(time.March, 4, 7, 0)},
+		{at(time.March, 4, 7, 0), false, time.Time{}},
+		// the Saturday window runs on from the end of Friday night's
+		{at(time.March, 6, 1, 0), true, at(time.March, 6, 8, 0)},
+		{at(time.March, 6, 7, 30), true, at(time.March, 6, 8, 0)},
+		// a whole day from noon on Sunday covers Sunday night's window
+		{at(time.March, 7, 11, 59), false, time.Time{}},
+		{at(time.March, 7, 12, 0), true, at(time.March, 8, 12, 0)},
+		{at(time.March, 7, 23, 0), true, at(time.March, 8, 12, 0)},
+		// quiet hours are in the recipient's time zone
+		{time.Date(2021, time.March, 3, 12, 0, 0, 0, time.UTC), true, at(time.March, 3, 7, 0)},
+		// the clocks go forward at 02:00 on 14 March 2021
+		{at(time.March, 14, 1, 0), true, at(time.March, 14, 7, 0)},
+	}
+	for _, test_case := range test_cases {
+		until, quiet := recipient.QuietUntil(test_case.current_time)
+		if quiet != test_case.quiet || (quiet && !until.Equal(test_case.until)) {
+			t.Errorf("at %s got %t until %s (%t until %s expected)", test_case.current_time, quiet, until,
+				test_case.quiet, test_case.until)
+		}
+	}
+
+	expected := "quiet from 22:00 to 07:00 every day, from 07:00 to 08:00 on Saturday and for a day " +
+		"from 12:00 on Sunday (messages deferred)"
+	if recipient.Describe() != expected {
+		t.Errorf("got description \"%s\" (\"%s\" expected)", recipient.Describe(), expected)
+	}
+}
+
+func TestRecipientsInSeveralFiles(t *testing.T) {
+	dir := writeConfigDir(t, map[string]string{
+		"a.json": `{"recipients": {"+15555550123": {"quiet_action": "drop"}}}`,
+		"b.yaml": "recipients:\n  \"+15555550124\":\n    quiet_hours:\n      - {from: \"23:00\", to: \"06:00\"}\n",
+	})
+	loaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if len(loaded.Recipients) != 2 || loaded.Recipients["+15555550123"].QuietAction != QuietDrop ||
+		loaded.Recipients["+15555550124"].QuietAction != QuietDefer {
+		t.Errorf("got recipients %v", loaded.Recipients)
+	}
+
+	dir = writeConfigDir(t, map[string]string{
+		"a.json": `{"recipients": {"+15555550123": {}}}`,
+		"b.json": `{"recipients": {"+15555550123": {}}}`,
+	})
+	if _, err := LoadConfig(dir); err == nil {
+		t.Error("no error for recipient defined in two files")
+	}
+}
+
+func TestRecipientAbnormal(t *testing.T) {
+	test_cases := []string{
+		`{"5555550123": {}}`,
+		`{"+15555550123": "quiet"}`,
+		`{"+15555550123": {"timezone": "Mars/Olympus_Mons"}}`,
+		`{"+15555550123": {"quiet_action": "delay"}}`,
+		`{"+15555550123": {"quiet_hours": {"from": "22:00", "to": "07:00"}}}`,
+		`{"+15555550123": {"quiet_hours": [{"from": "22:00"}]}}`,
+		`{"+15555550123": {"quiet_hours": [{"from": "25:00", "to": "07:00"}]}}`,
+		`{"+15555550123": {"quiet_hours": [{"from": "22:00", "to": "07:00", "weekdays": ["someday"]}]}}`,
+		`{"+15555550123": {"quiet_hours": [{"from": "22:00", "to": "07:00", "days": ["monday"]}]}}`,
+		`{"+15555550123": {"dnd": true}}`,
+		`["+15555550123"]`,
+	}
+	for _, recipients := range test_cases {
+		config := `{"reminders": [], "recipients": ` + recipients + `}`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with recipients %s", recipients)
+		}
+	}
+}
+
+func TestParseUrgent(t *testing.T) {
+	for _, version := range []string{"v1", "v2"} {
+		config := `[{"version": "` + version + `", "message": "m", "urgent": true, "triggers": []}]`
+		reminder_list, err := ParseConfig([]byte(config), "json")
+		if err != nil {
+			t.Fatalf("got unexpected error: %s", err)
+		}
+		if !reminder_list[0].Urgent {
+			t.Errorf("%s reminder is not urgent", version)
+		}
+		config = `[{"version": "` + version + `", "message": "m", "urgent": "yes", "triggers": []}]`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error for %s reminder with urgent \"yes\"", version)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package reminder
+
+import (
+	"sort"
+	"sync"
+)
+
+// A TriggerFactory returns a new, empty Trigger of a particular type. The
+// loader fills it in by calling its ParseTriggerFromInterfaceMap method with
+// the trigger's config, including the "trigger_type" key.
+type TriggerFactory func() Trigger
+
+var (
+	triggerTypesMutex sync.RWMutex
+	triggerTypes      = map[string]TriggerFactory{}
+)
+
+// Makes a type of Trigger available to the config loader under name, which
+// is matched against the "trigger_type" key of each trigger. The built-in
+// trigger types are registered this way too. Programs that embed the reminder
+// package can use it to add their own Triggers; it should be called before any
+// config is loaded, typically from an init function. If RegisterTriggerType is
+// called twice with the same name or if factory is nil, it panics.
+func RegisterTriggerType(name string, factory TriggerFactory) {
+	triggerTypesMutex.Lock()
+	defer triggerTypesMutex.Unlock()
+	if factory == nil {
+		panic("reminder: RegisterTriggerType factory is nil")
+	}
+	if _, ok := triggerTypes[name]; ok {
+		panic("reminder: RegisterTriggerType called twice for trigger type " + name)
+	}
+	triggerTypes[name] = factory
+}
+
+// Returns the names of the registered trigger types in sorted order.
+func TriggerTypes() []string {
+	triggerTypesMutex.RLock()
+	defer triggerTypesMutex.RUnlock()
+	names := make([]string, 0, len(triggerTypes))
+	for name := range triggerTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the factory registered for the trigger type name.
+func lookupTriggerType(name string) (TriggerFactory, bool) {
+	triggerTypesMutex.RLock()
+	defer triggerTypesMutex.RUnlock()
+	factory, ok := triggerTypes[name]
+	return factory, ok
+}
+
+// A ReminderIDBinder is a Trigger that needs to know the ID of the reminder it
+// belongs to, for example to seed a random number generator so that it makes
+// the same choices every time the config is loaded. Once a reminder's ID is
+// known, BindReminderID is called on each of its Triggers that implements
+// ReminderIDBinder, including Triggers nested in other Triggers.
+type ReminderIDBinder interface {
+	BindReminderID(id string)
+}
+
+// Tells each of r's Triggers that implements ReminderIDBinder the ID of r.
+func (r *ReminderV2) bindID() {
+	walkTriggers(r.Triggers, func(trigger Trigger) error {
+		if binder, ok := trigger.(ReminderIDBinder); ok {
+			binder.BindReminderID(r.ID)
+		}
+		return nil
+	})
+}
+
+// Tells the caller whether anything is kept by r's ID from one load of the
+// config to the next: the number of times it has been sent, for its MaxCount,
+// or the choices of a Trigger that implements ReminderIDBinder. Such reminders
+// should be given an explicit ID, since a generated one changes whenever the
+// reminder is edited.
+func (r *ReminderV2) UsesID() bool {
+	uses_id := r.MaxCount > 0
+	walkTriggers(r.Triggers, func(trigger Trigger) error {
+		if _, ok := trigger.(ReminderIDBinder); ok {
+			uses_id = true
+		}
+		return nil
+	})
+	return uses_id
+}
+
+// A SecondsTrigger is a Trigger that may run at any second of a minute, rather
+// than for the whole of each minute that it matches. Reminders with such a
+// Trigger are checked every second; see ReminderV2.UsesSeconds. Triggers that
+// do not implement SecondsTrigger only run at the first second of a minute
+// when they are checked every second.
+type SecondsTrigger interface {
+	UsesSeconds() bool
+}
+
+// Tells the caller whether trigger implements SecondsTrigger and uses seconds.
+func triggerUsesSeconds(trigger Trigger) bool {
+	st, ok := trigger.(SecondsTrigger)
+	return ok && st.UsesSeconds()
+}
@@ -0,0 +1,68 @@
+package reminder
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testTrigger is a custom Trigger that runs on a single weekday.
+type testTrigger struct {
+	weekday time.Weekday
+}
+
+func (tt *testTrigger) TriggerType() string {
+	return "test_weekday"
+}
+
+func (tt *testTrigger) Describe() string {
+	return "on " + tt.weekday.String()
+}
+
+func (tt *testTrigger) ShouldRun(current_time time.Time) bool {
+	return current_time.Weekday() == tt.weekday
+}
+
+func (tt *testTrigger) ParseTriggerFromInterfaceMap(obj_map map[string]interface{}) error {
+	value, ok := stringValue(obj_map["weekday"])
+	if !ok {
+		return fmt.Errorf("missing key \"weekday\"")
+	}
+	_, err := fmt.Sscanf(value, "%d", &tt.weekday)
+	return err
+}
+
+func init() {
+	RegisterTriggerType("test_weekday", func() Trigger { return &testTrigger{} })
+}
+
+func TestCustomTriggerType(t *testing.T) {
+	config := `[{"version": "v2", "message": "hi", "triggers": [{"trigger_type": "test_weekday", "weekday": 3}]}]`
+	reminder_list, err := ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if r.Describe() != "on Wednesday" {
+		t.Errorf("got description \"%s\" (\"on Wednesday\" expected)", r.Describe())
+	}
+	if !r.ShouldRun(time.Date(2021, time.January, 6, 12, 0, 0, 0, time.Local)) {
+		t.Error("custom trigger did not run on a Wednesday")
+	}
+}
+
+func TestUnknownTriggerType(t *testing.T) {
+	config := `[{"version": "v2", "message": "hi", "triggers": [{"trigger_type": "nope"}]}]`
+	if _, err := ParseConfig([]byte(config), "json"); err == nil {
+		t.Error("no error for unknown trigger type")
+	}
+}
+
+func TestRegisterTriggerTypeTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering trigger type \"cron\" twice did not panic")
+		}
+	}()
+	RegisterTriggerType("cron", func() Trigger { return &CronTrigger{} })
+}
@@ -3,7 +3,7 @@ package reminder
 import (
 	"time"
 	"fmt"
-	"encoding/json"
+	"strings"
 )
 
 // The ShouldRun interface is implemented on types that contain data
@@ -25,15 +25,54 @@ type Reminder interface {
 // Reminder that specifies when the message in the Reminder should be sent.
 type Trigger interface {
 	TriggerType() string
+	Describe() string
 	ParseTriggerFromInterfaceMap(map[string]interface{}) error
 	ShouldRun
 }
 
-// This is version 1 of the Reminder.
+// This is version 1 of the Reminder. ID, Name, Tags and Enabled are optional.
+// IDs must be unique across all loaded config files; reminders that are not
+// given one in the config are assigned one by the loader. Enabled defaults to
+// true. NotBefore, NotAfter and MaxCount are optional too, and mean the same
+// as in ReminderV2; dates are taken in the local time zone. Condition is
+// optional; if it is set, the reminder is only sent when it holds. MessageCommand
+// is optional too; if it is set, its output becomes or fills in Message, as in
+// ReminderV2. Urgent reminders are sent even during their recipients' quiet
+// hours. SMS is optional, and limits the segments that the message takes, as
+// in ReminderV2. Source is the path
+// of the file the reminder was loaded from; it is not part of the config itself.
 type ReminderV1 struct {
-	Version  string
-	Message  string
-	Triggers []Trigger
+	Version        string
+	ID             string
+	Name           string
+	Tags           []string
+	Enabled        bool
+	NotBefore      time.Time
+	NotAfter       time.Time
+	MaxCount       int
+	Condition      *Condition
+	Urgent         bool
+	Message        string
+	MessageCommand *MessageCommand
+	SMS            *SMS
+	Triggers       []Trigger
+	Source         string
+}
+
+// Tells the caller whether r has at least one of tags. Every reminder
+// matches an empty list of tags.
+func (r *ReminderV1) HasAnyTag(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, own_tag := range r.Tags {
+			if tag == own_tag {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Determines whether r.Message should be sent.
@@ -46,19 +85,40 @@ func (r *ReminderV1) ShouldRun(current_time time.Time) bool {
 	return false
 }
 
+// Returns an English description of when r.Message is sent, made by
+// joining the descriptions of its Triggers.
+func (r *ReminderV1) Describe() string {
+	descriptions := make([]string, 0, len(r.Triggers))
+	for _, trigger := range r.Triggers {
+		descriptions = append(descriptions, trigger.Describe())
+	}
+	if len(descriptions) == 0 {
+		return "never"
+	}
+	return strings.Join(descriptions, "; or ")
+}
+
 // Unmarshals a []byte of data into a ReminderV1.
 func (r *ReminderV1) UnmarshalJSON(data []byte) error {
 	if string(data) == "null" { return nil }
-	obj := map[string]interface{}{}
-	err := json.Unmarshal(data, &obj)
+	raw, err := decodeFormat(data, "json")
 	if err != nil {
-		fmt.Println(obj)
 		return fmt.Errorf("inital unmarshal failed: %w", err)
 	}
+	obj, ok := raw.(map[string]interface{})
+	if ! ok {
+		return fmt.Errorf("failed to parse reminder into a map[string]interface{}")
+	}
+	return r.parseFromMap(obj)
+}
+
+// Parses a reminder, as decoded from any config format, into a ReminderV1.
+func (r *ReminderV1) parseFromMap(obj map[string]interface{}) error {
+	r.Enabled = true
 	for key, i := range obj {
 		switch key {
 		case "version":
-			value, ok := i.(string)
+			value, ok := stringValue(i)
 			if ! ok {
 				return fmt.Errorf("failed to parse value of key \"version\" into string")
 			}
@@ -67,6 +127,67 @@ func (r *ReminderV1) UnmarshalJSON(data []byte) error {
 			}
 			r.Version = value
 
+		case "id":
+			value, ok := stringValue(i)
+			if ! ok || value == "" {
+				return fmt.Errorf("failed to parse value of key \"id\" into non-empty string")
+			}
+			r.ID = value
+
+		case "name":
+			value, ok := i.(string)
+			if ! ok {
+				return fmt.Errorf("failed to parse value of key \"name\" into string")
+			}
+			r.Name = value
+
+		case "tags":
+			tags, err := stringList(key, i)
+			if err != nil {
+				return err
+			}
+			r.Tags = tags
+
+		case "enabled", "urgent":
+			value, ok := i.(bool)
+			if ! ok {
+				return fmt.Errorf("failed to parse value of key \"%s\" into bool", key)
+			}
+			if key == "enabled" {
+				r.Enabled = value
+			} else {
+				r.Urgent = value
+			}
+
+		case "not_before", "not_after":
+			value, ok := stringValue(i)
+			if ! ok {
+				return fmt.Errorf("failed to parse value of key \"%s\" into string", key)
+			}
+			date, err := parseDate(value, time.Local, key == "not_after")
+			if err != nil {
+				return fmt.Errorf("key \"%s\": %w", key, err)
+			}
+			if key == "not_before" {
+				r.NotBefore = date
+			} else {
+				r.NotAfter = date
+			}
+
+		case "max_count":
+			value, err := maxCountValue(i)
+			if err != nil {
+				return err
+			}
+			r.MaxCount = value
+
+		case "condition":
+			condition, err := parseCondition(i)
+			if err != nil {
+				return fmt.Errorf("key \"condition\": %w", err)
+			}
+			r.Condition = condition
+
 		case "message":
 			value, ok := i.(string)
 			if ! ok {
@@ -75,50 +196,119 @@ func (r *ReminderV1) UnmarshalJSON(data []byte) error {
 			}
 			r.Message = value
 
-		case "triggers":
-			interface_list, ok := i.([]interface{})
-			if ! ok {
-				msg := "failed to parse value of key \"triggers\" into []interface{}"
-				return fmt.Errorf(msg)
+		case "message_command":
+			message_command, err := parseMessageCommand(i)
+			if err != nil {
+				return fmt.Errorf("key \"message_command\": %w", err)
 			}
-			r.Triggers = make([]Trigger, 0)
-			for _, i := range interface_list {
-				obj_map, ok := i.(map[string]interface{})
-				if ! ok {
-					msg := "failed to parse a trigger into a map[string]interface{}"
-					return fmt.Errorf(msg)
-				}
-				trigger, err := parseTriggerFromInterface(obj_map)
-				if err != nil {
-					return fmt.Errorf("parseTriggerFromInterface: %w", err)
-				}
-				r.Triggers = append(r.Triggers, trigger)
+			r.MessageCommand = message_command
+
+		case "sms":
+			sms_settings, err := parseSMS(i)
+			if err != nil {
+				return fmt.Errorf("key \"sms\": %w", err)
+			}
+			r.SMS = sms_settings
+
+		case "triggers":
+			triggers, err := parseTriggerList(i)
+			if err != nil {
+				return err
 			}
+			r.Triggers = triggers
 
 		default:
 			return fmt.Errorf("ReminderV1.UnmarshalJSON: key %s is invalid", key)
 		}
 	}
-	return nil
+	if !r.NotBefore.IsZero() && !r.NotAfter.IsZero() && r.NotAfter.Before(r.NotBefore) {
+		return fmt.Errorf("not_after is before not_before")
+	}
+	return checkMessageCommand(r.Message, r.MessageCommand)
+}
+
+// Parses the value of a "triggers" key into a list of Triggers.
+func parseTriggerList(i interface{}) ([]Trigger, error) {
+	interface_list, ok := i.([]interface{})
+	if ! ok {
+		msg := "failed to parse value of key \"triggers\" into []interface{}"
+		return nil, fmt.Errorf(msg)
+	}
+	triggers := make([]Trigger, 0)
+	for _, i := range interface_list {
+		obj_map, ok := i.(map[string]interface{})
+		if ! ok {
+			msg := "failed to parse a trigger into a map[string]interface{}"
+			return nil, fmt.Errorf(msg)
+		}
+		trigger, err := parseTriggerFromInterface(obj_map)
+		if err != nil {
+			return nil, fmt.Errorf("parseTriggerFromInterface: %w", err)
+		}
+		triggers = append(triggers, trigger)
+	}
+	return triggers, nil
 }
 
-// Determines the Trigger type, calls the appropriate code to parse the Trigger
-// part of the JSON into that type of Trigger, and then casts the resulting object
-// into the Trigger type.
+// Determines the Trigger type, creates a Trigger of that type with the factory
+// registered for it, and calls the Trigger's ParseTriggerFromInterfaceMap to
+// parse the rest of the trigger's config into it. A trigger of any type may
+// have an "exclude" key listing calendars; it is removed before the rest is
+// parsed, and the resulting Trigger is wrapped in an ExcludedTrigger.
 func parseTriggerFromInterface(obj_map map[string]interface{}) (Trigger, error) {
 	trigger_type, ok := obj_map["trigger_type"].(string)
 	if ! ok {
 		return nil, fmt.Errorf("could not convert value of \"trigger_type\" key to string")
 	}
-	switch trigger_type {
-	case "cron":
-		ct := &CronTrigger{}
-		err := ct.ParseTriggerFromInterfaceMap(obj_map)
+	factory, ok := lookupTriggerType(trigger_type)
+	if ! ok {
+		return nil, fmt.Errorf("trigger type %s is not a valid trigger type (must be one of %s)",
+			trigger_type, strings.Join(TriggerTypes(), ", "))
+	}
+
+	raw_exclude, has_exclude := obj_map["exclude"]
+	if has_exclude {
+		trigger_map := make(map[string]interface{}, len(obj_map))
+		for key, value := range obj_map {
+			if key != "exclude" {
+				trigger_map[key] = value
+			}
+		}
+		obj_map = trigger_map
+	}
+
+	trigger := factory()
+	err := trigger.ParseTriggerFromInterfaceMap(obj_map)
+	if err != nil {
+		return nil, fmt.Errorf("%s trigger: %w", trigger_type, err)
+	}
+	if has_exclude {
+		calendar_names, err := stringList("exclude", raw_exclude)
 		if err != nil {
-			return nil, fmt.Errorf("CronTrigger.ParseTriggerFromInterfaceMap: %w", err)
+			return nil, fmt.Errorf("%s trigger: %w", trigger_type, err)
 		}
-		return Trigger(ct), nil
-	default:
-		return nil, fmt.Errorf("trigger type %s is not a valid trigger type", trigger_type)
+		return &ExcludedTrigger{Trigger: trigger, CalendarNames: calendar_names}, nil
 	}
+	return trigger, nil
+}
+
+// Calls fn on each of triggers and, recursively, on the Triggers that they
+// contain. Stops at and returns the first error that fn returns.
+func walkTriggers(triggers []Trigger, fn func(Trigger) error) error {
+	for _, trigger := range triggers {
+		if err := fn(trigger); err != nil {
+			return err
+		}
+		switch typed := trigger.(type) {
+		case *CompositeTrigger:
+			if err := walkTriggers(typed.Triggers, fn); err != nil {
+				return err
+			}
+		case *ExcludedTrigger:
+			if err := walkTriggers([]Trigger{typed.Trigger}, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
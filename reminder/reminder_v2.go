@@ -0,0 +1,527 @@
+package reminder
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// phoneNumberRegexp matches phone numbers in E.164 format.
+var phoneNumberRegexp = regexp.MustCompile(`^\+[0-9]{11,15}$`)
+
+// channels is the set of channels that a ReminderV2 may be sent through.
+var channels = map[string]bool{
+	"sms": true,
+}
+
+// Tells the caller whether phone_number is in E.164 format.
+func IsPhoneNumber(phone_number string) bool {
+	return phoneNumberRegexp.MatchString(phone_number)
+}
+
+// This is version 2 of the Reminder. It has all of the fields of ReminderV1,
+// plus:
+//
+// Recipients: the E.164 phone numbers and SNS topic ARNs that the message is
+// sent to. If empty, the message is sent to the recipient given on the command
+// line.
+//
+// Timezone: the IANA name of the time zone that Triggers are evaluated in,
+// for example "America/Vancouver". If empty, the local time zone is used.
+//
+// NotBefore and NotAfter: the reminder is only sent between these times.
+// Either may be zero, meaning the reminder has no start or end. In the config
+// they are given as dates ("2021-03-01") or RFC 3339 times; dates are taken in
+// the reminder's time zone, and a NotAfter date includes that whole day.
+//
+// MaxCount: if not zero, the reminder is sent at most this many times. The
+// number of times it has been sent is kept by the caller, since it has to
+// survive restarts.
+//
+// Condition: a check that must hold for the message to be sent, such as a
+// command that must succeed. It is made by the caller when the Triggers say
+// that the message should be sent, since it can be slow. May be nil.
+//
+// Urgent: if true, the message is sent even during its recipients' quiet
+// hours. See Recipient.
+//
+// MessageCommand: a command whose output is the message, if Message is empty,
+// or replaces the "{output}" placeholder in Message. It is run by the caller
+// through BuildMessage when the message is about to be sent. May be nil.
+//
+// SMS: limits the number of SMS segments that the message takes. May be nil,
+// meaning no limit. See FitMessage.
+//
+// Channels: the channels that the message is sent through. Defaults to
+// ["sms"], which is currently the only channel.
+//
+// Event: a date, such as a birthday, that the reminder counts down to. Its
+// offsets are added to Triggers as EventTriggers, and RenderMessage fills in
+// the days remaining until it. May be nil.
+//
+// Exclude: the names of Calendars on whose days the reminder is not sent.
+// The Calendars themselves are looked up once all config files are loaded.
+//
+// GeneratedID: true if the config did not give an ID, and LoadFile made one
+// from the reminder's contents. See UsesID.
+type ReminderV2 struct {
+	Version        string
+	ID             string
+	Name           string
+	Tags           []string
+	Enabled        bool
+	Message        string
+	Recipients     []string
+	Timezone       string
+	Location       *time.Location
+	NotBefore      time.Time
+	NotAfter       time.Time
+	MaxCount       int
+	Condition      *Condition
+	Urgent         bool
+	MessageCommand *MessageCommand
+	SMS            *SMS
+	Channels       []string
+	Event          *Event
+	Exclude        []string
+	Calendars      []*Calendar
+	Triggers       []Trigger
+	Source         string
+	GeneratedID    bool
+}
+
+// A Decision says whether a reminder is sent at a particular time. If it is,
+// Trigger is the trigger that fired. If the reminder would have been sent but
+// was suppressed, Skipped is true and Reason says why.
+type Decision struct {
+	Fire    bool
+	Trigger Trigger
+	Skipped bool
+	Reason  string
+}
+
+// Converts a ReminderV1 into the equivalent ReminderV2.
+func (r *ReminderV1) Upgrade() *ReminderV2 {
+	return &ReminderV2{
+		Version:        "v2",
+		ID:             r.ID,
+		Name:           r.Name,
+		Tags:           r.Tags,
+		Enabled:        r.Enabled,
+		Message:        r.Message,
+		Location:       time.Local,
+		NotBefore:      r.NotBefore,
+		NotAfter:       r.NotAfter,
+		MaxCount:       r.MaxCount,
+		Condition:      r.Condition,
+		Urgent:         r.Urgent,
+		MessageCommand: r.MessageCommand,
+		SMS:            r.SMS,
+		Channels:       []string{"sms"},
+		Triggers:       r.Triggers,
+		Source:         r.Source,
+	}
+}
+
+// Tells the caller whether current_time is between r.NotBefore and r.NotAfter.
+func (r *ReminderV2) Active(current_time time.Time) bool {
+	if !r.NotBefore.IsZero() && current_time.Before(r.NotBefore) {
+		return false
+	}
+	if !r.NotAfter.IsZero() && current_time.After(r.NotAfter) {
+		return false
+	}
+	return true
+}
+
+// Tells the caller whether r will never be sent again after current_time,
+// either because r.NotAfter has passed or because r has already been sent
+// r.MaxCount times. count is the number of times r has been sent. If r has
+// expired, the reason is returned as well.
+func (r *ReminderV2) Expired(current_time time.Time, count int) (bool, string) {
+	if !r.NotAfter.IsZero() && current_time.After(r.NotAfter) {
+		return true, fmt.Sprintf("not_after %s has passed", r.NotAfter.Format(time.RFC3339))
+	}
+	if r.MaxCount > 0 && count >= r.MaxCount {
+		return true, fmt.Sprintf("it has been sent max_count (%d) times", r.MaxCount)
+	}
+	return false, ""
+}
+
+// Determines whether r.Message should be sent.
+func (r *ReminderV2) ShouldRun(current_time time.Time) bool {
+	return r.Check(current_time).Fire
+}
+
+// Tells the caller whether any of r's Triggers uses seconds, in which case r
+// must be checked every second rather than every minute.
+func (r *ReminderV2) UsesSeconds() bool {
+	for _, trigger := range r.Triggers {
+		if triggerUsesSeconds(trigger) {
+			return true
+		}
+	}
+	return false
+}
+
+// Determines whether r.Message should be sent, and if it would have been sent
+// but a Calendar excludes current_time, why it was skipped. The Triggers and
+// Calendars are evaluated in the reminder's time zone. If r uses seconds, it is
+// expected to be checked every second, so its Triggers that do not use seconds
+// only run at the first second of each minute that they match.
+func (r *ReminderV2) Check(current_time time.Time) Decision {
+	if !r.Active(current_time) {
+		return Decision{}
+	}
+	local_time := current_time.In(r.location())
+	precise := r.UsesSeconds()
+	decision := Decision{}
+	for _, trigger := range r.Triggers {
+		if precise && local_time.Second() != 0 && !triggerUsesSeconds(trigger) {
+			continue
+		}
+		if trigger.ShouldRun(local_time) {
+			decision = Decision{Fire: true, Trigger: trigger}
+			break
+		}
+		if et, ok := trigger.(*ExcludedTrigger); ok && !decision.Skipped {
+			if skipped, reason := et.Skipped(local_time); skipped {
+				decision = Decision{Skipped: true, Reason: reason}
+			}
+		}
+	}
+	if decision.Fire {
+		if skipped, reason := matchCalendars(r.Calendars, local_time); skipped {
+			return Decision{Skipped: true, Reason: reason}
+		}
+	}
+	return decision
+}
+
+// Returns the message to send at current_time. If r has an Event, the
+// "{days_remaining}" and "{event_date}" placeholders are filled in; see Event.
+func (r *ReminderV2) RenderMessage(current_time time.Time) string {
+	if r.Event == nil {
+		return r.Message
+	}
+	return r.Event.render(r.Message, r.Triggers, current_time.In(r.location()))
+}
+
+// Returns the message to send at current_time, like RenderMessage, but if r
+// has a MessageCommand it is run first and its output is filled in. If the
+// command fails, its Fallback is used in place of the output and the failure
+// is returned as well, so that the caller can log it. If it fails and there is
+// no Fallback, the returned message is empty and the reminder should not be
+// sent.
+func (r *ReminderV2) BuildMessage(current_time time.Time) (string, error) {
+	message := r.RenderMessage(current_time)
+	if r.MessageCommand == nil {
+		return message, nil
+	}
+	output, err := r.MessageCommand.Output()
+	if err != nil {
+		if r.MessageCommand.Fallback == "" {
+			return "", err
+		}
+		return fillOutput(message, r.MessageCommand.Fallback), err
+	}
+	return fillOutput(message, output), nil
+}
+
+// Returns the recipients of r, or default_recipients if r has none.
+func (r *ReminderV2) RecipientsOr(default_recipients []string) []string {
+	if len(r.Recipients) == 0 {
+		return default_recipients
+	}
+	return r.Recipients
+}
+
+// Returns an English description of when r.Message is sent, made by
+// joining the descriptions of its Triggers.
+func (r *ReminderV2) Describe() string {
+	descriptions := make([]string, 0, len(r.Triggers))
+	for _, trigger := range r.Triggers {
+		descriptions = append(descriptions, trigger.Describe())
+	}
+	if len(descriptions) == 0 {
+		return "never"
+	}
+	description := strings.Join(descriptions, "; or ")
+	if len(r.Exclude) > 0 {
+		description = description + "; " + describeExclusions(r.Exclude)
+	}
+	return description
+}
+
+// Tells the caller whether r has at least one of tags. Every reminder
+// matches an empty list of tags.
+func (r *ReminderV2) HasAnyTag(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, tag := range tags {
+		for _, own_tag := range r.Tags {
+			if tag == own_tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unmarshals a []byte of data into a ReminderV2. Both v1 and v2 reminders
+// are accepted; v1 reminders are upgraded.
+func (r *ReminderV2) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	raw, err := decodeFormat(data, "json")
+	if err != nil {
+		return fmt.Errorf("inital unmarshal failed: %w", err)
+	}
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("failed to parse reminder into a map[string]interface{}")
+	}
+	parsed, err := parseReminder(obj)
+	if err != nil {
+		return err
+	}
+	*r = *parsed
+	return nil
+}
+
+func (r *ReminderV2) location() *time.Location {
+	if r.Location == nil {
+		return time.Local
+	}
+	return r.Location
+}
+
+// Parses a reminder of any version, as decoded from any config format,
+// into a ReminderV2. The version is given by the "version" key.
+func parseReminder(obj map[string]interface{}) (*ReminderV2, error) {
+	version, ok := stringValue(obj["version"])
+	if !ok {
+		return nil, fmt.Errorf("failed to parse value of key \"version\" into string")
+	}
+	switch version {
+	case "v1":
+		r := &ReminderV1{}
+		if err := r.parseFromMap(obj); err != nil {
+			return nil, err
+		}
+		upgraded := r.Upgrade()
+		upgraded.bindID()
+		return upgraded, nil
+	case "v2":
+		r := &ReminderV2{}
+		if err := r.parseFromMap(obj); err != nil {
+			return nil, err
+		}
+		r.bindID()
+		return r, nil
+	default:
+		return nil, fmt.Errorf("reminder version \"%s\" is not supported", version)
+	}
+}
+
+// Parses a v2 reminder, as decoded from any config format, into a ReminderV2.
+func (r *ReminderV2) parseFromMap(obj map[string]interface{}) error {
+	r.Enabled = true
+	r.Channels = []string{"sms"}
+	raw_dates := map[string]string{}
+	for key, i := range obj {
+		switch key {
+		case "version":
+			value, ok := stringValue(i)
+			if !ok || value != "v2" {
+				return fmt.Errorf("expected value \"v2\" for key \"version\"")
+			}
+			r.Version = value
+
+		case "id":
+			value, ok := stringValue(i)
+			if !ok || value == "" {
+				return fmt.Errorf("failed to parse value of key \"id\" into non-empty string")
+			}
+			r.ID = value
+
+		case "name", "message", "timezone":
+			value, ok := i.(string)
+			if !ok {
+				return fmt.Errorf("failed to parse value of key \"%s\" into string", key)
+			}
+			switch key {
+			case "name":
+				r.Name = value
+			case "message":
+				r.Message = value
+			case "timezone":
+				r.Timezone = value
+			}
+
+		case "tags":
+			tags, err := stringList(key, i)
+			if err != nil {
+				return err
+			}
+			r.Tags = tags
+
+		case "enabled", "urgent":
+			value, ok := i.(bool)
+			if !ok {
+				return fmt.Errorf("failed to parse value of key \"%s\" into bool", key)
+			}
+			if key == "enabled" {
+				r.Enabled = value
+			} else {
+				r.Urgent = value
+			}
+
+		case "recipients":
+			recipients, err := stringList(key, i)
+			if err != nil {
+				return err
+			}
+			for _, recipient := range recipients {
+				if err := CheckRecipient(recipient); err != nil {
+					return fmt.Errorf("recipient %w", err)
+				}
+			}
+			r.Recipients = recipients
+
+		case "not_before", "not_after":
+			value, ok := stringValue(i)
+			if !ok {
+				return fmt.Errorf("failed to parse value of key \"%s\" into string", key)
+			}
+			raw_dates[key] = value
+
+		case "max_count":
+			value, err := maxCountValue(i)
+			if err != nil {
+				return err
+			}
+			r.MaxCount = value
+
+		case "condition":
+			condition, err := parseCondition(i)
+			if err != nil {
+				return fmt.Errorf("key \"condition\": %w", err)
+			}
+			r.Condition = condition
+
+		case "message_command":
+			message_command, err := parseMessageCommand(i)
+			if err != nil {
+				return fmt.Errorf("key \"message_command\": %w", err)
+			}
+			r.MessageCommand = message_command
+
+		case "sms":
+			sms_settings, err := parseSMS(i)
+			if err != nil {
+				return fmt.Errorf("key \"sms\": %w", err)
+			}
+			r.SMS = sms_settings
+
+		case "channels":
+			channel_list, err := stringList(key, i)
+			if err != nil {
+				return err
+			}
+			for _, channel := range channel_list {
+				if !channels[channel] {
+					return fmt.Errorf("channel \"%s\" is not a valid channel", channel)
+				}
+			}
+			r.Channels = channel_list
+
+		case "exclude":
+			calendar_names, err := stringList(key, i)
+			if err != nil {
+				return err
+			}
+			r.Exclude = calendar_names
+
+		case "event":
+			event, err := parseEvent(i)
+			if err != nil {
+				return fmt.Errorf("key \"event\": %w", err)
+			}
+			r.Event = event
+
+		case "triggers":
+			triggers, err := parseTriggerList(i)
+			if err != nil {
+				return err
+			}
+			r.Triggers = append(r.Triggers, triggers...)
+
+		default:
+			return fmt.Errorf("ReminderV2: key %s is invalid", key)
+		}
+	}
+	if r.Event != nil {
+		r.Triggers = append(r.Triggers, r.Event.Triggers()...)
+	}
+	if err := checkMessageCommand(r.Message, r.MessageCommand); err != nil {
+		return err
+	}
+
+	// dates are parsed last since they depend on the time zone
+	location, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return fmt.Errorf("failed to load timezone \"%s\": %w", r.Timezone, err)
+	}
+	r.Location = location
+	if value, ok := raw_dates["not_before"]; ok {
+		r.NotBefore, err = parseDate(value, location, false)
+		if err != nil {
+			return fmt.Errorf("key \"not_before\": %w", err)
+		}
+	}
+	if value, ok := raw_dates["not_after"]; ok {
+		r.NotAfter, err = parseDate(value, location, true)
+		if err != nil {
+			return fmt.Errorf("key \"not_after\": %w", err)
+		}
+	}
+	if !r.NotBefore.IsZero() && !r.NotAfter.IsZero() && r.NotAfter.Before(r.NotBefore) {
+		return fmt.Errorf("not_after is before not_before")
+	}
+	return nil
+}
+
+// Parses the value of a "max_count" key, which must be a positive whole number.
+func maxCountValue(i interface{}) (int, error) {
+	value, ok := stringValue(i)
+	if !ok {
+		return 0, fmt.Errorf("failed to parse value of key \"max_count\" into a whole number")
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("max_count must be a positive whole number")
+	}
+	return count, nil
+}
+
+// Parses a date ("2021-03-01") in location, or an RFC 3339 time. If end_of_day
+// is true, a date is taken to mean the last instant of that day.
+func parseDate(value string, location *time.Location, end_of_day bool) (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", value, location)
+	if err == nil {
+		if end_of_day {
+			return date.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return date, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("\"%s\" is neither a date (YYYY-MM-DD) nor an RFC 3339 time", value)
+	}
+	return parsed, nil
+}
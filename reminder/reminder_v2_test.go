@@ -0,0 +1,194 @@
+package reminder
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testV2Config = `
+- version: v2
+  id: pills
+  message: Take your antibiotics.
+  recipients: ["+15555550100", "+15555550101"]
+  timezone: America/Vancouver
+  not_before: "2021-03-01"
+  not_after: "2021-03-10"
+  channels: [sms]
+  triggers:
+    - trigger_type: cron
+      minute: 0
+      hour: 8
+      day_of_month: "*"
+      month: "*"
+      day_of_week: "*"
+`
+
+func TestParseConfigV2(t *testing.T) {
+	reminder_list, err := ParseConfig([]byte(testV2Config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if r.Version != "v2" || r.ID != "pills" || len(r.Recipients) != 2 || r.Timezone != "America/Vancouver" {
+		t.Errorf("got unexpected reminder %+v", r)
+	}
+
+	// 08:00 in Vancouver is 16:00 UTC during standard time
+	if !r.ShouldRun(time.Date(2021, time.March, 1, 16, 0, 0, 0, time.UTC)) {
+		t.Error("reminder did not run at 08:00 in its time zone on its first day")
+	}
+	if r.ShouldRun(time.Date(2021, time.March, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Error("reminder ran at 08:00 UTC")
+	}
+	if !r.ShouldRun(time.Date(2021, time.March, 10, 16, 0, 0, 0, time.UTC)) {
+		t.Error("reminder did not run on its last day")
+	}
+	if r.ShouldRun(time.Date(2021, time.February, 28, 16, 0, 0, 0, time.UTC)) {
+		t.Error("reminder ran before not_before")
+	}
+	if r.ShouldRun(time.Date(2021, time.March, 11, 16, 0, 0, 0, time.UTC)) {
+		t.Error("reminder ran after not_after")
+	}
+}
+
+func TestParseConfigV2Abnormal(t *testing.T) {
+	test_cases := []string{
+		"- version: v3\n  message: a\n",
+		"- version: v2\n  recipients: [\"5555550100\"]\n",
+		"- version: v2\n  timezone: Not/A_Zone\n",
+		"- version: v2\n  not_before: tomorrow\n",
+		"- version: v2\n  not_before: \"2021-03-02\"\n  not_after: \"2021-03-01\"\n",
+		"- version: v2\n  channels: [carrier_pigeon]\n",
+		"- version: v1\n  recipients: [\"+15555550100\"]\n",
+	}
+	for _, config := range test_cases {
+		_, err := ParseConfig([]byte(config), "yaml")
+		if err == nil {
+			t.Errorf("no error when there should have been with config %q", config)
+		}
+	}
+}
+
+func TestUpgradeV1(t *testing.T) {
+	reminder_list, err := ParseConfig([]byte(testJSONConfig), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if r.Version != "v2" || !r.Enabled || len(r.Channels) != 1 || r.Channels[0] != "sms" {
+		t.Errorf("got unexpected upgraded reminder %+v", r)
+	}
+	if len(r.RecipientsOr([]string{"+15555550100"})) != 1 {
+		t.Error("upgraded reminder does not use the default recipients")
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	configs := map[string]string{
+		"json": testJSONConfig,
+		"yaml": testYAMLConfig,
+		"toml": testTOMLConfig,
+	}
+	for format, config := range configs {
+		new_data, migrated, err := MigrateConfig([]byte(config), format)
+		if err != nil {
+			t.Errorf("format %s: got unexpected error: %s", format, err)
+			continue
+		}
+		if migrated != 1 {
+			t.Errorf("format %s: migrated %d reminders (1 expected)", format, migrated)
+		}
+		if !strings.Contains(string(new_data), "v2") || strings.Contains(string(new_data), "v1") {
+			t.Errorf("format %s: migrated config is still v1:\n%s", format, new_data)
+		}
+
+		// migrating again should do nothing
+		newer_data, migrated, err := MigrateConfig(new_data, format)
+		if err != nil || migrated != 0 || string(newer_data) != string(new_data) {
+			t.Errorf("format %s: migrating a v2 config changed it", format)
+		}
+	}
+}
+
+func TestCheckTrigger(t *testing.T) {
+	config := `
+- version: v2
+  message: Standup.
+  timezone: UTC
+  triggers:
+    - trigger_type: cron
+      minute: 0
+      hour: 9
+      day_of_month: "*"
+      month: "*"
+      day_of_week: "*"
+    - trigger_type: weekly
+      weekday: monday
+      time: "10:00"
+`
+	reminder_list, err := ParseConfig([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	monday := time.Date(2021, time.March, 8, 0, 0, 0, 0, time.UTC)
+	test_cases := []struct {
+		time         time.Time
+		trigger_type string
+	}{
+		{monday.Add(9 * time.Hour), "cron"},
+		{monday.Add(10 * time.Hour), "weekly"},
+		{monday.Add(11 * time.Hour), ""},
+	}
+	for _, test_case := range test_cases {
+		decision := r.Check(test_case.time)
+		if test_case.trigger_type == "" {
+			if decision.Fire || decision.Trigger != nil {
+				t.Errorf("got decision %+v at %s (no fire expected)", decision, test_case.time)
+			}
+			continue
+		}
+		if !decision.Fire || decision.Trigger == nil || decision.Trigger.TriggerType() != test_case.trigger_type {
+			t.Errorf("got decision %+v at %s (%s trigger expected)", decision, test_case.time, test_case.trigger_type)
+		}
+	}
+}
+
+func TestExpired(t *testing.T) {
+	config := `
+- version: v1
+  id: sprint
+  not_before: "2021-03-01"
+  not_after: "2021-03-14"
+  max_count: 3
+  message: Sprint review today.
+`
+	reminder_list, err := ParseConfig([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if r.MaxCount != 3 || r.NotBefore.IsZero() || r.NotAfter.IsZero() {
+		t.Fatalf("v1 fields were not upgraded: %+v", r)
+	}
+
+	during := time.Date(2021, time.March, 14, 12, 0, 0, 0, time.Local)
+	after := time.Date(2021, time.March, 15, 12, 0, 0, 0, time.Local)
+	if expired, reason := r.Expired(during, 2); expired {
+		t.Errorf("reminder expired during its dates with 2 sends: %s", reason)
+	}
+	if expired, _ := r.Expired(during, 3); !expired {
+		t.Error("reminder did not expire after max_count sends")
+	}
+	if expired, _ := r.Expired(after, 0); !expired {
+		t.Error("reminder did not expire after not_after")
+	}
+
+	for _, bad := range []string{"0", "-1", "1.5", "three"} {
+		config := "- version: v2\n  max_count: " + bad + "\n"
+		if _, err := ParseConfig([]byte(config), "yaml"); err == nil {
+			t.Errorf("no error for max_count %s", bad)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+const testSecondsConfig = `
+- version: v2
+  id: centrifuge
+  message: centrifuge done
+  timezone: UTC
+  triggers:
+    - trigger_type: cron
+      second: 30
+      minute: "*/5"
+      hour: 9
+      day_of_month: "*"
+      month: "*"
+      day_of_week: "*"
+    - trigger_type: cron
+      minute: 2
+      hour: 9
+      day_of_month: "*"
+      month: "*"
+      day_of_week: "*"
+`
+
+func TestSecondsReminder(t *testing.T) {
+	reminder_list, err := ParseConfig([]byte(testSecondsConfig), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if !r.UsesSeconds() {
+		t.Fatal("reminder with a second field does not use seconds")
+	}
+
+	test_cases := map[time.Time]bool{
+		time.Date(2021, time.March, 1, 9, 5, 30, 0, time.UTC): true,
+		time.Date(2021, time.March, 1, 9, 5, 0, 0, time.UTC):  false,
+		time.Date(2021, time.March, 1, 9, 6, 30, 0, time.UTC): false,
+		// the minute-only trigger runs once, at the start of its minute
+		time.Date(2021, time.March, 1, 9, 2, 0, 0, time.UTC):  true,
+		time.Date(2021, time.March, 1, 9, 2, 1, 0, time.UTC):  false,
+		time.Date(2021, time.March, 1, 9, 2, 30, 0, time.UTC): false,
+	}
+	for test_time, expected := range test_cases {
+		if r.ShouldRun(test_time) != expected {
+			t.Errorf("ShouldRun returned %t at %s (%t expected)", !expected, test_time, expected)
+		}
+	}
+
+	occurrences := r.Occurrences(time.Date(2021, time.March, 1, 9, 0, 30, 0, time.UTC), 3)
+	expected := []time.Time{
+		time.Date(2021, time.March, 1, 9, 2, 0, 0, time.UTC),
+		time.Date(2021, time.March, 1, 9, 5, 30, 0, time.UTC),
+		time.Date(2021, time.March, 1, 9, 10, 30, 0, time.UTC),
+	}
+	if len(occurrences) != len(expected) {
+		t.Fatalf("got %d occurrences (%d expected)", len(occurrences), len(expected))
+	}
+	for i, occurrence := range occurrences {
+		if !occurrence.Time.Equal(expected[i]) {
+			t.Errorf("got occurrence %s (%s expected)", occurrence.Time, expected[i])
+		}
+	}
+
+	// looking a day ahead skips the minutes in which nothing can run
+	next_run, ok := r.NextRun(time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC))
+	if !ok || !next_run.Equal(time.Date(2021, time.March, 2, 9, 0, 30, 0, time.UTC)) {
+		t.Errorf("got next run %s (2021-03-02 09:00:30 expected)", next_run)
+	}
+}
+
+func TestSecondsMinuteOnly(t *testing.T) {
+	// reminders without a second field keep matching the whole minute
+	reminder_list, err := ParseConfig([]byte(testYAMLConfig), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	for _, r := range reminder_list {
+		if r.UsesSeconds() {
+			t.Errorf("reminder %s uses seconds", r.ID)
+		}
+	}
+}
+
+func TestSecondsComposite(t *testing.T) {
+	config := `[{"version": "v2", "triggers": [{"trigger_type": "all", "triggers": [
+		{"trigger_type": "cron", "second": "*/15", "minute": "*", "hour": "*", "day_of_month": "*", "month": "*", "day_of_week": "*"},
+		{"trigger_type": "weekly", "weekday": "monday", "time": "09:00"}]}]}]`
+	reminder_list, err := ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+	if !r.UsesSeconds() {
+		t.Fatal("composite with a second field does not use seconds")
+	}
+	if !r.ShouldRun(time.Date(2021, time.March, 1, 9, 0, 45, 0, time.Local)) {
+		t.Error("did not run at 09:00:45 on a Monday")
+	}
+	next_run, ok := r.NextRun(time.Date(2021, time.March, 1, 9, 0, 45, 0, time.Local))
+	if !ok || !next_run.Equal(time.Date(2021, time.March, 8, 9, 0, 0, 0, time.Local)) {
+		t.Errorf("got next run %s (2021-03-08 09:00:00 expected)", next_run)
+	}
+}
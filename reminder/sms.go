@@ -0,0 +1,179 @@
+package reminder
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adamkpickering/reminder-boi/sms"
+)
+
+// The SMS types that AWS SNS accepts. Transactional messages are delivered
+// more reliably, and promotional ones more cheaply.
+const (
+	SMSTransactional = "transactional"
+	SMSPromotional   = "promotional"
+)
+
+// A sender ID is 1 to 11 letters and digits, at least one of which is a
+// letter.
+var senderIDRegexp = regexp.MustCompile(`^[A-Za-z0-9]{1,11}$`)
+
+// SMS controls how a reminder's message is sent as SMS messages. It is given
+// under a reminder's "sms" key:
+//
+// "max_segments": the most segments that the message may take, since carriers
+// bill for each one. Defaults to 1, unless the SMS only gives attributes, in
+// which case there is no limit and MaxSegments is 0.
+//
+// "overflow": what is done with a message that takes more: "truncate" (the
+// default) cuts it short, and "reject" doesn't send it. "split" instead sends
+// any message that takes more than one segment as numbered messages of one
+// segment each, at most max_segments of them, the last of which is cut short
+// if there would be more.
+//
+// "type", "sender_id" and "max_price": the SMS attributes that AWS SNS sends
+// the message with. The type is "transactional" or "promotional", the sender
+// ID is up to 11 letters and digits, and the max price is the most, in US
+// dollars, that a message may cost. Each may be left out, in which case the
+// account's default is used.
+//
+// Reminders without an SMS are sent however many segments they take, with the
+// account's default attributes.
+type SMS struct {
+	MaxSegments int
+	Overflow    string
+	Type        string
+	SenderID    string
+	MaxPrice    string
+}
+
+// Returns an English description of s, for example "at most 3 segments, split
+// into numbered messages; transactional, from MyClinic".
+func (s *SMS) Describe() string {
+	parts := make([]string, 0, 2)
+	if s.MaxSegments > 0 {
+		description := "at most " + CountOf(s.MaxSegments, "segment")
+		switch s.Overflow {
+		case sms.OverflowSplit:
+			description = description + ", split into numbered messages"
+		case sms.OverflowReject:
+			description = description + ", longer messages are not sent"
+		default:
+			description = description + ", longer messages are truncated"
+		}
+		parts = append(parts, description)
+	}
+	attributes := make([]string, 0, 3)
+	if s.Type != "" {
+		attributes = append(attributes, s.Type)
+	}
+	if s.SenderID != "" {
+		attributes = append(attributes, "from "+s.SenderID)
+	}
+	if s.MaxPrice != "" {
+		attributes = append(attributes, "at most $"+s.MaxPrice+" a message")
+	}
+	if len(attributes) > 0 {
+		parts = append(parts, strings.Join(attributes, ", "))
+	}
+	if len(parts) == 0 {
+		return "no segment limit"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Returns the SMS attributes that the message is sent with, keyed by their
+// AWS SNS names, such as "AWS.SNS.SMS.SMSType". Attributes that s doesn't set
+// are left out.
+func (s *SMS) Attributes() map[string]string {
+	attributes := map[string]string{}
+	switch s.Type {
+	case SMSTransactional:
+		attributes["AWS.SNS.SMS.SMSType"] = "Transactional"
+	case SMSPromotional:
+		attributes["AWS.SNS.SMS.SMSType"] = "Promotional"
+	}
+	if s.SenderID != "" {
+		attributes["AWS.SNS.SMS.SenderID"] = s.SenderID
+	}
+	if s.MaxPrice != "" {
+		attributes["AWS.SNS.SMS.MaxPrice"] = s.MaxPrice
+	}
+	return attributes
+}
+
+// Returns the texts of the SMS messages that message is sent as, which is
+// just message unless r has an SMS whose limit it goes over. An error is
+// returned if the message takes too many segments and can't be made to fit.
+func (r *ReminderV2) FitMessage(message string) ([]string, error) {
+	if r.SMS == nil || r.SMS.MaxSegments == 0 {
+		return []string{message}, nil
+	}
+	return sms.Fit(message, r.SMS.MaxSegments, r.SMS.Overflow)
+}
+
+// Parses the value of a reminder's "sms" key.
+func parseSMS(i interface{}) (*SMS, error) {
+	obj_map, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to parse into a map")
+	}
+	s := &SMS{MaxSegments: 1, Overflow: sms.OverflowTruncate}
+	for key, value := range obj_map {
+		switch key {
+		case "max_segments":
+			max_segments, err := positiveInt(key, value)
+			if err != nil {
+				return nil, err
+			}
+			s.MaxSegments = max_segments
+		case "overflow":
+			overflow, ok := value.(string)
+			if !ok || (overflow != sms.OverflowTruncate && overflow != sms.OverflowSplit &&
+				overflow != sms.OverflowReject) {
+				return nil, fmt.Errorf("overflow must be \"%s\", \"%s\" or \"%s\"", sms.OverflowTruncate,
+					sms.OverflowSplit, sms.OverflowReject)
+			}
+			s.Overflow = overflow
+		case "type":
+			sms_type, ok := value.(string)
+			if !ok || (sms_type != SMSTransactional && sms_type != SMSPromotional) {
+				return nil, fmt.Errorf("type must be \"%s\" or \"%s\"", SMSTransactional, SMSPromotional)
+			}
+			s.Type = sms_type
+		case "sender_id":
+			sender_id, ok := value.(string)
+			if !ok || !senderIDRegexp.MatchString(sender_id) || strings.Trim(sender_id, "0123456789") == "" {
+				return nil, fmt.Errorf("sender_id must be 1 to 11 letters and digits, with at least one letter")
+			}
+			s.SenderID = sender_id
+		case "max_price":
+			max_price, ok := stringValue(value)
+			if float_value, is_float := value.(float64); is_float {
+				max_price, ok = strconv.FormatFloat(float_value, 'f', -1, 64), true
+			}
+			if !ok {
+				return nil, fmt.Errorf("failed to parse value of key \"max_price\" into string")
+			}
+			price, err := strconv.ParseFloat(max_price, 64)
+			if err != nil || price <= 0 {
+				return nil, fmt.Errorf("max_price must be a positive number of US dollars, like 0.50")
+			}
+			s.MaxPrice = max_price
+		default:
+			return nil, fmt.Errorf("the key \"%s\" is not a valid sms key", key)
+		}
+	}
+	_, has_max_segments := obj_map["max_segments"]
+	_, has_overflow := obj_map["overflow"]
+	if !has_max_segments && !has_overflow && s.Type+s.SenderID+s.MaxPrice != "" {
+		// asking for attributes, such as transactional delivery, shouldn't shorten the message
+		s.MaxSegments = 0
+	}
+	if s.Overflow == sms.OverflowSplit && s.MaxSegments < 2 {
+		return nil, fmt.Errorf("overflow \"%s\" needs a max_segments of at least 2", sms.OverflowSplit)
+	}
+	return s, nil
+}
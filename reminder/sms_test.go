@@ -0,0 +1,115 @@
+package reminder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSMS(t *testing.T) {
+	long := strings.Repeat("Water the plants. ", 30)
+	test_cases := []struct {
+		sms         string
+		description string
+		parts       int
+		is_error    bool
+	}{
+		{`{}`, "at most 1 segment, longer messages are truncated", 1, false},
+		{`{"max_segments": 2}`, "at most 2 segments, longer messages are truncated", 1, false},
+		{`{"max_segments": 3, "overflow": "split"}`, "at most 3 segments, split into numbered messages", 3, false},
+		{`{"overflow": "reject"}`, "at most 1 segment, longer messages are not sent", 0, true},
+		{`{"type": "transactional"}`, "transactional", 1, false},
+		{`{"overflow": "truncate", "type": "transactional"}`,
+			"at most 1 segment, longer messages are truncated; transactional", 1, false},
+	}
+	for _, version := range []string{"v1", "v2"} {
+		for _, test_case := range test_cases {
+			config := `[{"version": "` + version + `", "message": "m", "sms": ` + test_case.sms + `, "triggers": []}]`
+			reminder_list, err := ParseConfig([]byte(config), "json")
+			if err != nil {
+				t.Errorf("got unexpected error for sms %s: %s", test_case.sms, err)
+				continue
+			}
+			r := reminder_list[0]
+			if r.SMS == nil || r.SMS.Describe() != test_case.description {
+				t.Errorf("sms %s parsed to %v (\"%s\" expected)", test_case.sms, r.SMS, test_case.description)
+				continue
+			}
+			parts, err := r.FitMessage(long)
+			if len(parts) != test_case.parts || (err != nil) != test_case.is_error {
+				t.Errorf("sms %s: got %d parts and error %v", test_case.sms, len(parts), err)
+			}
+		}
+	}
+
+	r := ReminderV2{}
+	if parts, err := r.FitMessage(long); err != nil || len(parts) != 1 || parts[0] != long {
+		t.Errorf("reminder without sms: got %v and error %v", parts, err)
+	}
+}
+
+func TestSMSAttributes(t *testing.T) {
+	config := `[{"version": "v2", "message": "m", "triggers": [],
+		"sms": {"type": "transactional", "sender_id": "MyClinic", "max_price": 0.5}}]`
+	reminder_list, err := ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	s := reminder_list[0].SMS
+	expected := map[string]string{
+		"AWS.SNS.SMS.SMSType":  "Transactional",
+		"AWS.SNS.SMS.SenderID": "MyClinic",
+		"AWS.SNS.SMS.MaxPrice": "0.5",
+	}
+	attributes := s.Attributes()
+	if len(attributes) != len(expected) {
+		t.Errorf("got attributes %v (%v expected)", attributes, expected)
+	}
+	for name, value := range expected {
+		if attributes[name] != value {
+			t.Errorf("got attributes %v (%v expected)", attributes, expected)
+		}
+	}
+	description := "transactional, from MyClinic, at most $0.5 a message"
+	if s.Describe() != description {
+		t.Errorf("got description \"%s\" (\"%s\" expected)", s.Describe(), description)
+	}
+	// attributes alone don't limit the segments
+	long := strings.Repeat("m", 200)
+	if parts, err := reminder_list[0].FitMessage(long); err != nil || len(parts) != 1 || parts[0] != long {
+		t.Errorf("got parts %v and error %v without a segment limit", parts, err)
+	}
+
+	config = `[{"version": "v2", "message": "m", "triggers": [], "sms": {"type": "promotional"}}]`
+	reminder_list, err = ParseConfig([]byte(config), "json")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if attributes := reminder_list[0].SMS.Attributes(); len(attributes) != 1 ||
+		attributes["AWS.SNS.SMS.SMSType"] != "Promotional" {
+		t.Errorf("got attributes %v", attributes)
+	}
+}
+
+func TestSMSAbnormal(t *testing.T) {
+	test_cases := []string{
+		`"split"`,
+		`{"max_segments": 0}`,
+		`{"max_segments": "many"}`,
+		`{"overflow": "drop"}`,
+		`{"overflow": "split"}`,
+		`{"max_segments": 1, "overflow": "split"}`,
+		`{"encoding": "gsm"}`,
+		`{"type": "urgent"}`,
+		`{"sender_id": "TooLongSenderID"}`,
+		`{"sender_id": "My Clinic"}`,
+		`{"sender_id": "12345"}`,
+		`{"max_price": 0}`,
+		`{"max_price": "cheap"}`,
+	}
+	for _, sms := range test_cases {
+		config := `[{"version": "v2", "message": "m", "sms": ` + sms + `, "triggers": []}]`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with sms %s", sms)
+		}
+	}
+}
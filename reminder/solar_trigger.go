@@ -0,0 +1,270 @@
+package reminder
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// solarZeniths gives the zenith angle of the sun's centre, in degrees, at
+// each solar event. Sunrise and sunset use 90.833 degrees to account for
+// atmospheric refraction and the size of the sun's disc.
+var solarZeniths = map[string]float64{
+	"sunrise":    90.833,
+	"sunset":     90.833,
+	"civil_dawn": 96,
+	"civil_dusk": 96,
+}
+
+// SolarTrigger is a type of Trigger that runs at a fixed offset from a solar
+// event, such as 30 minutes before sunset. Event times are computed locally
+// with the NOAA solar position equations, which are accurate to about a
+// minute away from the poles. Its config keys are:
+//
+// "latitude" and "longitude": the location, in decimal degrees. North and
+// east are positive.
+//
+// "event": one of "sunrise", "sunset", "civil_dawn" or "civil_dusk".
+//
+// "offset": an optional duration, such as "-30m" or "1h15m", added to the
+// time of the event. Defaults to 0.
+//
+// On days when the event does not happen, such as sunset during a polar
+// summer, the trigger does not run.
+type SolarTrigger struct {
+	Latitude  float64
+	Longitude float64
+	Event     string
+	Offset    time.Duration
+
+	cacheDay   time.Time
+	cacheTimes []time.Time
+}
+
+func init() {
+	RegisterTriggerType("solar", func() Trigger { return &SolarTrigger{} })
+}
+
+// Returns the type of the Trigger.
+func (st *SolarTrigger) TriggerType() string {
+	return "solar"
+}
+
+// Given a time as a time.Time object, tells the caller whether the
+// SolarTrigger should run at this time.
+func (st *SolarTrigger) ShouldRun(current_time time.Time) bool {
+	current_minute := current_time.Truncate(time.Minute)
+	for _, event_time := range st.timesAround(civilDate(current_time)) {
+		if event_time.Truncate(time.Minute).Equal(current_minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns an English description of when the SolarTrigger runs, for example
+// "30 minutes before sunset at 49.28, -123.12".
+func (st *SolarTrigger) Describe() string {
+	event := map[string]string{
+		"sunrise":    "sunrise",
+		"sunset":     "sunset",
+		"civil_dawn": "civil dawn",
+		"civil_dusk": "civil dusk",
+	}[st.Event]
+	location := fmt.Sprintf("at %s, %s", strconv.FormatFloat(st.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(st.Longitude, 'f', -1, 64))
+	switch {
+	case st.Offset < 0:
+		return fmt.Sprintf("%s before %s %s", describeDuration(-st.Offset), event, location)
+	case st.Offset > 0:
+		return fmt.Sprintf("%s after %s %s", describeDuration(st.Offset), event, location)
+	default:
+		return fmt.Sprintf("at %s %s", event, location)
+	}
+}
+
+// Parses a map[string]interface{} into a SolarTrigger.
+func (st *SolarTrigger) ParseTriggerFromInterfaceMap(obj_map map[string]interface{}) error {
+	has_latitude, has_longitude := false, false
+	for key, i := range obj_map {
+		switch key {
+		case "trigger_type":
+			if value, ok := i.(string); !ok || value != "solar" {
+				return fmt.Errorf("trigger type \"%v\" is not valid (must be \"solar\")", i)
+			}
+		case "latitude", "longitude":
+			value, ok := floatValue(i)
+			if !ok {
+				return fmt.Errorf("failed to parse value of key \"%s\" into a number", key)
+			}
+			if key == "latitude" {
+				if value < -90 || value > 90 {
+					return fmt.Errorf("latitude %g is not in range [-90, 90]", value)
+				}
+				st.Latitude, has_latitude = value, true
+			} else {
+				if value < -180 || value > 180 {
+					return fmt.Errorf("longitude %g is not in range [-180, 180]", value)
+				}
+				st.Longitude, has_longitude = value, true
+			}
+		case "event":
+			value, ok := i.(string)
+			if _, valid := solarZeniths[value]; !ok || !valid {
+				return fmt.Errorf("event \"%v\" is not one of sunrise, sunset, civil_dawn or civil_dusk", i)
+			}
+			st.Event = value
+		case "offset":
+			value, ok := i.(string)
+			if !ok {
+				return fmt.Errorf("failed to parse value of key \"offset\" into string")
+			}
+			offset, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("offset \"%s\" is not a duration like \"-30m\"", value)
+			}
+			st.Offset = offset
+		default:
+			return fmt.Errorf("the key \"%s\" is not a valid key", key)
+		}
+	}
+	if !has_latitude || !has_longitude || st.Event == "" {
+		return fmt.Errorf("solar triggers must have a latitude, a longitude and an event")
+	}
+	return nil
+}
+
+// Returns the times at which the trigger runs for the days before, on and
+// after day. The neighbouring days are included because a large offset can
+// move the time onto a different day. The result for the last day asked about
+// is kept, since ShouldRun is called for every minute of a day in turn.
+func (st *SolarTrigger) timesAround(day time.Time) []time.Time {
+	if st.cacheTimes != nil && st.cacheDay.Equal(day) {
+		return st.cacheTimes
+	}
+	times := make([]time.Time, 0, 3)
+	for _, offset_days := range []int{-1, 0, 1} {
+		event_time, ok := SolarEventTime(day.AddDate(0, 0, offset_days), st.Latitude, st.Longitude, st.Event)
+		if ok {
+			times = append(times, event_time.Add(st.Offset))
+		}
+	}
+	st.cacheDay, st.cacheTimes = day, times
+	return times
+}
+
+// Returns the time, in UTC, of a solar event ("sunrise", "sunset",
+// "civil_dawn" or "civil_dusk") on the local day that starts on the calendar
+// date of day at the given latitude and longitude. The bool is false if the
+// event does not happen on that day.
+func SolarEventTime(day time.Time, latitude, longitude float64, event string) (time.Time, bool) {
+	zenith, ok := solarZeniths[event]
+	if !ok {
+		return time.Time{}, false
+	}
+	rising := event == "sunrise" || event == "civil_dawn"
+	year, month, date := day.Date()
+	midnight := time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+
+	// Start from local solar noon, then refine the estimate of the event time
+	// using the sun's position at the previous estimate.
+	minutes := 720 - 4*longitude
+	for i := 0; i < 3; i++ {
+		estimate := midnight.Add(time.Duration(minutes * float64(time.Minute)))
+		equation_of_time, declination := sunPosition(estimate)
+		hour_angle, ok := sunHourAngle(latitude, declination, zenith)
+		if !ok {
+			return time.Time{}, false
+		}
+		solar_noon := 720 - 4*longitude - equation_of_time
+		if rising {
+			minutes = solar_noon - 4*hour_angle
+		} else {
+			minutes = solar_noon + 4*hour_angle
+		}
+	}
+	return midnight.Add(time.Duration(minutes * float64(time.Minute))).Round(time.Second), true
+}
+
+// Returns the equation of time, in minutes, and the sun's declination, in
+// degrees, at t. These are the NOAA solar calculator equations, which are
+// based on Jean Meeus' Astronomical Algorithms.
+func sunPosition(t time.Time) (float64, float64) {
+	julian_day := float64(t.Unix())/86400 + 2440587.5
+	century := (julian_day - 2451545) / 36525
+
+	mean_longitude := math.Mod(280.46646+century*(36000.76983+century*0.0003032), 360)
+	mean_anomaly := 357.52911 + century*(35999.05029-0.0001537*century)
+	eccentricity := 0.016708634 - century*(0.000042037+0.0000001267*century)
+	equation_of_center := math.Sin(radians(mean_anomaly))*(1.914602-century*(0.004817+0.000014*century)) +
+		math.Sin(radians(2*mean_anomaly))*(0.019993-0.000101*century) +
+		math.Sin(radians(3*mean_anomaly))*0.000289
+	true_longitude := mean_longitude + equation_of_center
+	omega := 125.04 - 1934.136*century
+	apparent_longitude := true_longitude - 0.00569 - 0.00478*math.Sin(radians(omega))
+	mean_obliquity := 23 + (26+(21.448-century*(46.815+century*(0.00059-century*0.001813)))/60)/60
+	obliquity := mean_obliquity + 0.00256*math.Cos(radians(omega))
+	declination := degrees(math.Asin(math.Sin(radians(obliquity)) * math.Sin(radians(apparent_longitude))))
+
+	y := math.Pow(math.Tan(radians(obliquity/2)), 2)
+	equation_of_time := 4 * degrees(y*math.Sin(2*radians(mean_longitude))-
+		2*eccentricity*math.Sin(radians(mean_anomaly))+
+		4*eccentricity*y*math.Sin(radians(mean_anomaly))*math.Cos(2*radians(mean_longitude))-
+		0.5*y*y*math.Sin(4*radians(mean_longitude))-
+		1.25*eccentricity*eccentricity*math.Sin(2*radians(mean_anomaly)))
+	return equation_of_time, declination
+}
+
+// Returns the hour angle, in degrees, at which the sun's centre is at zenith
+// degrees from straight up. The bool is false if the sun never reaches that
+// angle, as happens near the poles.
+func sunHourAngle(latitude, declination, zenith float64) (float64, bool) {
+	cos_hour_angle := math.Cos(radians(zenith))/(math.Cos(radians(latitude))*math.Cos(radians(declination))) -
+		math.Tan(radians(latitude))*math.Tan(radians(declination))
+	if cos_hour_angle < -1 || cos_hour_angle > 1 {
+		return 0, false
+	}
+	return degrees(math.Acos(cos_hour_angle)), true
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// Converts a scalar from the generic tree into a float64.
+func floatValue(i interface{}) (float64, bool) {
+	switch value := i.(type) {
+	case float64:
+		return value, true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	case string:
+		parsed, err := strconv.ParseFloat(value, 64)
+		return parsed, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// Describes a duration in English, for example "1 hour 30 minutes".
+func describeDuration(d time.Duration) string {
+	hours := int(d / time.Hour)
+	minutes := int((d % time.Hour) / time.Minute)
+	parts := make([]string, 0, 2)
+	if hours > 0 {
+		parts = append(parts, CountOf(hours, "hour"))
+	}
+	if minutes > 0 || hours == 0 {
+		parts = append(parts, CountOf(minutes, "minute"))
+	}
+	return joinNonEmpty(parts...)
+}
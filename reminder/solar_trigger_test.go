@@ -0,0 +1,151 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSolarEventTime(t *testing.T) {
+	// published almanac times (U.S. Naval Observatory), to the minute
+	test_cases := []struct {
+		latitude  float64
+		longitude float64
+		timezone  string
+		date      time.Time
+		event     string
+		expected  string
+	}{
+		{51.5074, -0.1278, "Europe/London", time.Date(2021, time.June, 21, 0, 0, 0, 0, time.UTC), "sunrise", "04:43"},
+		{51.5074, -0.1278, "Europe/London", time.Date(2021, time.June, 21, 0, 0, 0, 0, time.UTC), "sunset", "21:21"},
+		{51.5074, -0.1278, "Europe/London", time.Date(2021, time.June, 21, 0, 0, 0, 0, time.UTC), "civil_dusk", "22:09"},
+		{40.7128, -74.0060, "America/New_York", time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC), "civil_dawn", "06:46"},
+		{40.7128, -74.0060, "America/New_York", time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC), "sunrise", "07:16"},
+		{40.7128, -74.0060, "America/New_York", time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC), "sunset", "16:32"},
+		{-33.8688, 151.2093, "Australia/Sydney", time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC), "sunrise", "05:41"},
+		{-33.8688, 151.2093, "Australia/Sydney", time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC), "sunset", "20:05"},
+		{21.3069, -157.8583, "Pacific/Honolulu", time.Date(2021, time.March, 20, 0, 0, 0, 0, time.UTC), "sunrise", "06:35"},
+		{21.3069, -157.8583, "Pacific/Honolulu", time.Date(2021, time.March, 20, 0, 0, 0, 0, time.UTC), "sunset", "18:43"},
+	}
+	for _, test_case := range test_cases {
+		location, err := time.LoadLocation(test_case.timezone)
+		if err != nil {
+			t.Fatalf("failed to load time zone: %s", err)
+		}
+		event_time, ok := SolarEventTime(test_case.date, test_case.latitude, test_case.longitude, test_case.event)
+		if !ok {
+			t.Errorf("%s in %s did not happen", test_case.event, test_case.timezone)
+			continue
+		}
+		year, month, day := test_case.date.Date()
+		hour, minute, _ := parseTimeOfDay(test_case.expected)
+		expected := time.Date(year, month, day, hour, minute, 0, 0, location)
+		difference := event_time.Sub(expected)
+		if difference < -2*time.Minute || difference > 2*time.Minute {
+			t.Errorf("got %s in %s at %s (%s expected)", test_case.event, test_case.timezone,
+				event_time.In(location).Format("15:04:05"), test_case.expected)
+		}
+	}
+}
+
+func TestSolarEventTimePolar(t *testing.T) {
+	// Tromsø has midnight sun in June and polar night in December
+	midsummer := time.Date(2021, time.June, 21, 0, 0, 0, 0, time.UTC)
+	if _, ok := SolarEventTime(midsummer, 69.6492, 18.9553, "sunset"); ok {
+		t.Error("got a sunset in Tromsø at midsummer")
+	}
+	midwinter := time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC)
+	if _, ok := SolarEventTime(midwinter, 69.6492, 18.9553, "sunrise"); ok {
+		t.Error("got a sunrise in Tromsø at midwinter")
+	}
+	if _, ok := SolarEventTime(midwinter, 69.6492, 18.9553, "civil_dawn"); !ok {
+		t.Error("got no civil dawn in Tromsø at midwinter")
+	}
+}
+
+func TestSolarTrigger(t *testing.T) {
+	config := `
+- version: v2
+  message: close the chicken coop
+  timezone: America/New_York
+  triggers:
+    - trigger_type: solar
+      latitude: 40.7128
+      longitude: -74.006
+      event: sunset
+      offset: -30m
+`
+	reminder_list, err := ParseConfig([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+
+	new_york, _ := time.LoadLocation("America/New_York")
+	sunset, _ := SolarEventTime(time.Date(2021, time.December, 21, 0, 0, 0, 0, time.UTC), 40.7128, -74.006, "sunset")
+	expected := sunset.Add(-30 * time.Minute).Truncate(time.Minute)
+	next_run, ok := r.NextRun(time.Date(2021, time.December, 21, 12, 0, 0, 0, new_york))
+	if !ok || !next_run.Equal(expected) {
+		t.Errorf("got next run %s (%s expected)", next_run, expected)
+	}
+	if r.ShouldRun(expected.Add(time.Minute)) {
+		t.Error("ran a minute after the event")
+	}
+
+	description := "30 minutes before sunset at 40.7128, -74.006"
+	if r.Describe() != description {
+		t.Errorf("got description \"%s\" (\"%s\" expected)", r.Describe(), description)
+	}
+}
+
+func TestSolarTriggerDescribeOffset(t *testing.T) {
+	test_cases := []struct {
+		offset      time.Duration
+		description string
+	}{
+		{0, "at sunset at 51.5074, -0.1278"},
+		{time.Minute, "1 minute after sunset at 51.5074, -0.1278"},
+		{-time.Hour, "1 hour before sunset at 51.5074, -0.1278"},
+		{-90 * time.Minute, "1 hour 30 minutes before sunset at 51.5074, -0.1278"},
+		{2*time.Hour + time.Minute, "2 hours 1 minute after sunset at 51.5074, -0.1278"},
+	}
+	for _, test_case := range test_cases {
+		st := &SolarTrigger{Latitude: 51.5074, Longitude: -0.1278, Event: "sunset", Offset: test_case.offset}
+		if st.Describe() != test_case.description {
+			t.Errorf("got description \"%s\" (\"%s\" expected)", st.Describe(), test_case.description)
+		}
+	}
+}
+
+func TestSolarTriggerLargeOffset(t *testing.T) {
+	// an offset can move the time onto the next day
+	st := &SolarTrigger{Latitude: 51.5074, Longitude: -0.1278, Event: "sunset", Offset: 3 * time.Hour}
+	sunset, _ := SolarEventTime(time.Date(2021, time.June, 21, 0, 0, 0, 0, time.UTC), 51.5074, -0.1278, "sunset")
+	london, _ := time.LoadLocation("Europe/London")
+	run_time := sunset.Add(3 * time.Hour).In(london)
+	if run_time.Day() != 22 {
+		t.Fatalf("expected the run time %s to be on the next day", run_time)
+	}
+	if !st.ShouldRun(run_time) {
+		t.Errorf("did not run at %s", run_time)
+	}
+}
+
+func TestSolarTriggerAbnormal(t *testing.T) {
+	test_cases := []string{
+		`{"trigger_type": "solar", "longitude": 0, "event": "sunset"}`,
+		`{"trigger_type": "solar", "latitude": 0, "event": "sunset"}`,
+		`{"trigger_type": "solar", "latitude": 0, "longitude": 0}`,
+		`{"trigger_type": "solar", "latitude": 91, "longitude": 0, "event": "sunset"}`,
+		`{"trigger_type": "solar", "latitude": 0, "longitude": -181, "event": "sunset"}`,
+		`{"trigger_type": "solar", "latitude": 0, "longitude": 0, "event": "moonrise"}`,
+		`{"trigger_type": "solar", "latitude": 0, "longitude": 0, "event": "sunset", "offset": "30"}`,
+		`{"trigger_type": "solar", "latitude": "north", "longitude": 0, "event": "sunset"}`,
+		`{"trigger_type": "solar", "latitude": 0, "longitude": 0, "event": "sunset", "time": "07:00"}`,
+	}
+	for _, trigger := range test_cases {
+		config := `[{"version": "v2", "triggers": [` + trigger + `]}]`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with trigger %s", trigger)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package reminder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The AWS partitions that SNS topics may be in.
+var topicPartitions = map[string]bool{
+	"aws":        true,
+	"aws-cn":     true,
+	"aws-us-gov": true,
+}
+
+var (
+	// topicRegionRegexp matches AWS region names, such as "us-west-2".
+	topicRegionRegexp = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+	// topicAccountRegexp matches AWS account IDs.
+	topicAccountRegexp = regexp.MustCompile(`^[0-9]{12}$`)
+	// topicNameRegexp matches the names of standard SNS topics.
+	topicNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+)
+
+// A TopicArn is the ARN of an AWS SNS topic, such as
+// "arn:aws:sns:us-west-2:123456789012:reminders". A message sent to a topic
+// goes to each of its subscribers, which may be phone numbers, email
+// addresses or queues.
+type TopicArn struct {
+	Partition string
+	Region    string
+	AccountID string
+	Name      string
+}
+
+// Returns the ARN, for example "arn:aws:sns:us-west-2:123456789012:reminders".
+func (a *TopicArn) String() string {
+	return strings.Join([]string{"arn", a.Partition, "sns", a.Region, a.AccountID, a.Name}, ":")
+}
+
+// Parses the ARN of an SNS topic. The error says which part of it is wrong.
+// FIFO topics aren't supported, since SMS messages can't be sent through them.
+func ParseTopicArn(arn string) (*TopicArn, error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[0] != "arn" {
+		return nil, fmt.Errorf("SNS topic ARN %s does not have six parts like "+
+			"arn:aws:sns:us-west-2:123456789012:reminders", arn)
+	}
+	a := &TopicArn{Partition: parts[1], Region: parts[3], AccountID: parts[4], Name: parts[5]}
+	switch {
+	case !topicPartitions[a.Partition]:
+		return nil, fmt.Errorf("SNS topic ARN %s has unknown partition \"%s\"", arn, a.Partition)
+	case parts[2] != "sns":
+		return nil, fmt.Errorf("ARN %s is for the service \"%s\", not \"sns\"", arn, parts[2])
+	case !topicRegionRegexp.MatchString(a.Region):
+		return nil, fmt.Errorf("SNS topic ARN %s has invalid region \"%s\"", arn, a.Region)
+	case !topicAccountRegexp.MatchString(a.AccountID):
+		return nil, fmt.Errorf("SNS topic ARN %s has invalid account ID \"%s\"; it must be 12 digits", arn,
+			a.AccountID)
+	case strings.HasSuffix(a.Name, ".fifo"):
+		return nil, fmt.Errorf("SNS topic ARN %s is for a FIFO topic, which can't send SMS messages", arn)
+	case !topicNameRegexp.MatchString(a.Name):
+		return nil, fmt.Errorf("SNS topic ARN %s has invalid topic name \"%s\"", arn, a.Name)
+	}
+	return a, nil
+}
+
+// Tells the caller whether recipient is meant to be an SNS topic ARN rather
+// than a phone number. It may still be an invalid one; see ParseTopicArn.
+func IsTopicArn(recipient string) bool {
+	return strings.HasPrefix(recipient, "arn:")
+}
+
+// Checks that recipient is either an E.164 phone number or a valid SNS topic
+// ARN.
+func CheckRecipient(recipient string) error {
+	if IsTopicArn(recipient) {
+		_, err := ParseTopicArn(recipient)
+		return err
+	}
+	if !IsPhoneNumber(recipient) {
+		return fmt.Errorf("%s is not a valid E.164 phone number or SNS topic ARN", recipient)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package reminder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTopicArn(t *testing.T) {
+	valid := []string{
+		"arn:aws:sns:us-west-2:123456789012:reminders",
+		"arn:aws-cn:sns:cn-north-1:123456789012:team_reminders-2",
+		"arn:aws-us-gov:sns:us-gov-west-1:123456789012:r",
+	}
+	for _, arn := range valid {
+		parsed, err := ParseTopicArn(arn)
+		if err != nil {
+			t.Errorf("got unexpected error for %s: %s", arn, err)
+			continue
+		}
+		if parsed.String() != arn {
+			t.Errorf("%s parsed to %s", arn, parsed)
+		}
+		if err := CheckRecipient(arn); err != nil {
+			t.Errorf("got unexpected error checking %s: %s", arn, err)
+		}
+	}
+
+	test_cases := []struct {
+		arn   string
+		error string
+	}{
+		{"arn:aws:sns:us-west-2:reminders", "six parts"},
+		{"arn:aws:sns:us-west-2:123456789012:reminders:sub", "six parts"},
+		{"arn:azure:sns:us-west-2:123456789012:reminders", "partition"},
+		{"arn:aws:sqs:us-west-2:123456789012:reminders", "service"},
+		{"arn:aws:sns:uswest2:123456789012:reminders", "region"},
+		{"arn:aws:sns:us-west-2:12345:reminders", "account ID"},
+		{"arn:aws:sns:us-west-2:123456789012:reminders.fifo", "FIFO"},
+		{"arn:aws:sns:us-west-2:123456789012:my reminders", "topic name"},
+		{"arn:aws:sns:us-west-2:123456789012:", "topic name"},
+	}
+	for _, test_case := range test_cases {
+		_, err := ParseTopicArn(test_case.arn)
+		if err == nil || !strings.Contains(err.Error(), test_case.error) {
+			t.Errorf("got error %v for %s (one about %s expected)", err, test_case.arn, test_case.error)
+		}
+	}
+
+	if err := CheckRecipient("+15555550123"); err != nil {
+		t.Errorf("got unexpected error for a phone number: %s", err)
+	}
+	if err := CheckRecipient("reminders"); err == nil {
+		t.Error("no error for a recipient that is neither a phone number nor an ARN")
+	}
+}
+
+func TestTopicRecipients(t *testing.T) {
+	config := `{
+		"recipients": {"arn:aws:sns:us-west-2:123456789012:reminders": {"quiet_action": "drop"}},
+		"reminders": [{"version": "v2", "message": "m", "triggers": [],
+			"recipients": ["+15555550123", "arn:aws:sns:us-west-2:123456789012:reminders"]}]
+	}`
+	dir := writeConfigDir(t, map[string]string{"a.json": config})
+	loaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if len(loaded.Reminders[0].Recipients) != 2 {
+		t.Errorf("got recipients %v", loaded.Reminders[0].Recipients)
+	}
+	if recipient := loaded.Recipients["arn:aws:sns:us-west-2:123456789012:reminders"]; recipient == nil ||
+		recipient.QuietAction != QuietDrop {
+		t.Errorf("got recipient settings %v", loaded.Recipients)
+	}
+
+	config = `[{"version": "v2", "message": "m", "triggers": [],
+		"recipients": ["arn:aws:sns:us-west-2:1234:reminders"]}]`
+	_, err = ParseConfig([]byte(config), "json")
+	if err == nil || !strings.Contains(err.Error(), "account ID") {
+		t.Errorf("got error %v for a reminder with an invalid topic ARN", err)
+	}
+}
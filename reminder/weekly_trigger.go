@@ -0,0 +1,157 @@
+package reminder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WeeklyTrigger is a type of Trigger that runs at a time of day on one day
+// of the week, every Interval weeks. This covers things that cron cannot
+// express, like "bins go out every other Thursday". Its config keys are:
+//
+// "weekday": the day of the week, as a name ("thursday") or a number
+// (0 for Sunday through 6 for Saturday).
+//
+// "time": the time of day, as "HH:MM" on a 24-hour clock.
+//
+// "interval": run every this many weeks. Defaults to 1.
+//
+// "anchor": a date ("2021-01-07") in one of the weeks in which the trigger
+// runs. Other weeks are counted from it. Required if interval is more than 1.
+//
+// Weeks start on Monday, as in ISO 8601. Like all Triggers, a WeeklyTrigger
+// is evaluated in the time zone of its reminder.
+type WeeklyTrigger struct {
+	Weekday  time.Weekday
+	Hour     int
+	Minute   int
+	Interval int
+	Anchor   time.Time
+}
+
+func init() {
+	RegisterTriggerType("weekly", func() Trigger { return &WeeklyTrigger{} })
+}
+
+// Returns the type of the Trigger.
+func (wt *WeeklyTrigger) TriggerType() string {
+	return "weekly"
+}
+
+// Given a time as a time.Time object, tells the caller whether the
+// WeeklyTrigger should run at this time.
+func (wt *WeeklyTrigger) ShouldRun(current_time time.Time) bool {
+	if current_time.Weekday() != wt.Weekday || current_time.Hour() != wt.Hour ||
+		current_time.Minute() != wt.Minute {
+		return false
+	}
+	if wt.Interval <= 1 {
+		return true
+	}
+	weeks := int(weekStart(civilDate(current_time)).Sub(weekStart(wt.Anchor)).Hours()) / (24 * 7)
+	return ((weeks%wt.Interval)+wt.Interval)%wt.Interval == 0
+}
+
+// Returns an English description of when the WeeklyTrigger runs, for example
+// "every 2nd Thursday at 07:30, counting from the week of 2021-01-07".
+func (wt *WeeklyTrigger) Describe() string {
+	at := fmt.Sprintf("at %02d:%02d", wt.Hour, wt.Minute)
+	switch {
+	case wt.Interval <= 1:
+		return fmt.Sprintf("every %s %s", wt.Weekday, at)
+	case wt.Interval == 2:
+		return fmt.Sprintf("every other %s %s, counting from the week of %s", wt.Weekday, at,
+			wt.Anchor.Format("2006-01-02"))
+	default:
+		return fmt.Sprintf("every %s %s %s, counting from the week of %s", ordinal(uint(wt.Interval)),
+			wt.Weekday, at, wt.Anchor.Format("2006-01-02"))
+	}
+}
+
+// Parses a map[string]interface{} into a WeeklyTrigger.
+func (wt *WeeklyTrigger) ParseTriggerFromInterfaceMap(obj_map map[string]interface{}) error {
+	wt.Interval = 1
+	has_weekday, has_time := false, false
+	for key, i := range obj_map {
+		value, ok := stringValue(i)
+		if !ok {
+			return fmt.Errorf("the value of key \"%s\" could not be converted to string", key)
+		}
+		switch key {
+		case "trigger_type":
+			if value != "weekly" {
+				return fmt.Errorf("trigger type \"%s\" is not valid (must be \"weekly\")", value)
+			}
+		case "weekday":
+			weekday, err := parseWeekday(value)
+			if err != nil {
+				return err
+			}
+			wt.Weekday = weekday
+			has_weekday = true
+		case "time":
+			hour, minute, err := parseTimeOfDay(value)
+			if err != nil {
+				return err
+			}
+			wt.Hour, wt.Minute = hour, minute
+			has_time = true
+		case "interval":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return fmt.Errorf("interval must be a positive whole number")
+			}
+			wt.Interval = interval
+		case "anchor":
+			anchor, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return fmt.Errorf("anchor \"%s\" is not a date (YYYY-MM-DD)", value)
+			}
+			wt.Anchor = anchor
+		default:
+			return fmt.Errorf("the key \"%s\" is not a valid key", key)
+		}
+	}
+	if !has_weekday || !has_time {
+		return fmt.Errorf("weekly triggers must have a weekday and a time")
+	}
+	if wt.Interval > 1 && wt.Anchor.IsZero() {
+		return fmt.Errorf("weekly triggers with an interval must have an anchor")
+	}
+	return nil
+}
+
+// Returns the Monday on or before day, which must be at midnight UTC.
+func weekStart(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// Parses a day of the week, given as an English name or its abbreviation
+// ("Thursday", "thu") or as a number from 0 (Sunday) to 6 (Saturday).
+func parseWeekday(value string) (time.Weekday, error) {
+	if number, err := strconv.Atoi(value); err == nil {
+		if number < 0 || number > 6 {
+			return 0, fmt.Errorf("weekday %d is not in range [0, 6]", number)
+		}
+		return time.Weekday(number), nil
+	}
+	lower := strings.ToLower(value)
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := strings.ToLower(weekday.String())
+		if lower == name || lower == name[:3] {
+			return weekday, nil
+		}
+	}
+	return 0, fmt.Errorf("\"%s\" is not a day of the week", value)
+}
+
+// Parses a time of day given as "HH:MM" on a 24-hour clock.
+func parseTimeOfDay(value string) (int, int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("\"%s\" is not a time of day (HH:MM)", value)
+	}
+	return parsed.Hour(), parsed.Minute(), nil
+}
@@ -0,0 +1,90 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeeklyTrigger(t *testing.T) {
+	config := `
+- version: v2
+  message: bins
+  timezone: Europe/London
+  triggers:
+    - trigger_type: weekly
+      weekday: thursday
+      time: 07:30
+      interval: 2
+      anchor: "2021-01-07"
+`
+	reminder_list, err := ParseConfig([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	r := reminder_list[0]
+
+	london, _ := time.LoadLocation("Europe/London")
+	test_cases := map[time.Time]bool{
+		// the anchor week, and every other week from it, including across a year
+		time.Date(2021, time.January, 7, 7, 30, 0, 0, london):   true,
+		time.Date(2021, time.January, 14, 7, 30, 0, 0, london):  false,
+		time.Date(2021, time.January, 21, 7, 30, 0, 0, london):  true,
+		time.Date(2020, time.December, 24, 7, 30, 0, 0, london): true,
+		time.Date(2020, time.December, 31, 7, 30, 0, 0, london): false,
+		time.Date(2022, time.January, 6, 7, 30, 0, 0, london):   true,
+		// wrong time or day
+		time.Date(2021, time.January, 7, 7, 31, 0, 0, london): false,
+		time.Date(2021, time.January, 8, 7, 30, 0, 0, london): false,
+		// British Summer Time: 07:30 in London is 06:30 UTC
+		time.Date(2021, time.July, 8, 6, 30, 0, 0, time.UTC): true,
+	}
+	for test_time, expected := range test_cases {
+		if r.ShouldRun(test_time) != expected {
+			t.Errorf("ShouldRun returned %t at %s (%t expected)", !expected, test_time, expected)
+		}
+	}
+
+	next_run, ok := r.NextRun(time.Date(2021, time.January, 8, 0, 0, 0, 0, london))
+	if !ok || !next_run.Equal(time.Date(2021, time.January, 21, 7, 30, 0, 0, london)) {
+		t.Errorf("got next run %s (2021-01-21 07:30 expected)", next_run)
+	}
+
+	expected := "every other Thursday at 07:30, counting from the week of 2021-01-07"
+	if r.Describe() != expected {
+		t.Errorf("got description \"%s\" (\"%s\" expected)", r.Describe(), expected)
+	}
+}
+
+func TestWeeklyTriggerAnchorWeekday(t *testing.T) {
+	// the anchor does not need to fall on the trigger's weekday
+	wt := &WeeklyTrigger{Weekday: time.Monday, Hour: 9, Interval: 3,
+		Anchor: time.Date(2021, time.January, 10, 0, 0, 0, 0, time.UTC)}
+	if !wt.ShouldRun(time.Date(2021, time.January, 4, 9, 0, 0, 0, time.UTC)) {
+		t.Error("did not run on the Monday of the anchor's week")
+	}
+	if !wt.ShouldRun(time.Date(2021, time.January, 25, 9, 0, 0, 0, time.UTC)) {
+		t.Error("did not run three weeks after the anchor's week")
+	}
+	if wt.ShouldRun(time.Date(2021, time.January, 11, 9, 0, 0, 0, time.UTC)) {
+		t.Error("ran one week after the anchor's week")
+	}
+}
+
+func TestWeeklyTriggerAbnormal(t *testing.T) {
+	test_cases := []string{
+		`{"trigger_type": "weekly", "time": "07:30"}`,
+		`{"trigger_type": "weekly", "weekday": "thursday"}`,
+		`{"trigger_type": "weekly", "weekday": "thirsday", "time": "07:30"}`,
+		`{"trigger_type": "weekly", "weekday": 7, "time": "07:30"}`,
+		`{"trigger_type": "weekly", "weekday": 4, "time": "25:00"}`,
+		`{"trigger_type": "weekly", "weekday": 4, "time": "07:30", "interval": 2}`,
+		`{"trigger_type": "weekly", "weekday": 4, "time": "07:30", "interval": 0, "anchor": "2021-01-07"}`,
+		`{"trigger_type": "weekly", "weekday": 4, "time": "07:30", "day": 1}`,
+	}
+	for _, trigger := range test_cases {
+		config := `[{"version": "v2", "triggers": [` + trigger + `]}]`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with trigger %s", trigger)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package reminder
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// WindowTrigger is a type of Trigger that runs at random minutes within a
+// daily window of time, for habit prompts like "drink water" that should not
+// arrive at the same time every day. Its config keys are:
+//
+// "from" and "to": the start and end of the window, as "HH:MM" on a 24-hour
+// clock. The trigger runs at or after from and before to.
+//
+// "weekdays": the days of the week that the trigger runs on, as names
+// ("monday") or numbers (0 for Sunday through 6 for Saturday). Defaults to
+// every day.
+//
+// "count": how many times to run in each window. Defaults to 1.
+//
+// "min_spacing": a duration, such as "45m", that runs in the same window must
+// be at least this far apart. Defaults to 1 minute.
+//
+// The minutes are picked by a random number generator seeded with the ID of
+// the reminder, the date and the window, so the same config always picks the
+// same minutes. This keeps the picks stable across restarts and lets them be
+// predicted ahead of time. Reminders without an ID all share the same seed.
+type WindowTrigger struct {
+	From       int
+	To         int
+	Weekdays   []time.Weekday
+	Count      int
+	MinSpacing time.Duration
+	ReminderID string
+
+	cacheDay     time.Time
+	cacheMinutes []int
+}
+
+func init() {
+	RegisterTriggerType("window", func() Trigger { return &WindowTrigger{} })
+}
+
+// Returns the type of the Trigger.
+func (wt *WindowTrigger) TriggerType() string {
+	return "window"
+}
+
+// Seeds the WindowTrigger with the ID of its reminder.
+func (wt *WindowTrigger) BindReminderID(id string) {
+	wt.ReminderID = id
+	wt.cacheMinutes = nil
+}
+
+// Given a time as a time.Time object, tells the caller whether the
+// WindowTrigger should run at this time.
+func (wt *WindowTrigger) ShouldRun(current_time time.Time) bool {
+	minute_of_day := current_time.Hour()*60 + current_time.Minute()
+	if minute_of_day < wt.From || minute_of_day >= wt.To {
+		return false
+	}
+	for _, minute := range wt.Minutes(civilDate(current_time)) {
+		if minute == minute_of_day {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns an English description of when the WindowTrigger runs, for example
+// "3 times at random between 10:00 and 16:00, at least 1 hour apart, on
+// Monday, Wednesday and Friday".
+func (wt *WindowTrigger) Describe() string {
+	times := "once"
+	if wt.Count > 1 {
+		times = fmt.Sprintf("%d times", wt.Count)
+	}
+	description := fmt.Sprintf("%s at random between %02d:%02d and %02d:%02d", times,
+		wt.From/60, wt.From%60, wt.To/60, wt.To%60)
+	if wt.Count > 1 && wt.MinSpacing > time.Minute {
+		description = description + ", at least " + describeDuration(wt.MinSpacing) + " apart,"
+	}
+	if len(wt.Weekdays) == 0 || len(wt.Weekdays) == 7 {
+		return description + " every day"
+	}
+	names := make([]string, 0, len(wt.Weekdays))
+	for _, weekday := range wt.Weekdays {
+		names = append(names, weekday.String())
+	}
+	return description + " on " + joinEnglish(names, "and")
+}
+
+// Parses a map[string]interface{} into a WindowTrigger.
+func (wt *WindowTrigger) ParseTriggerFromInterfaceMap(obj_map map[string]interface{}) error {
+	wt.Count = 1
+	wt.MinSpacing = time.Minute
+	has_from, has_to := false, false
+	for key, i := range obj_map {
+		if key == "weekdays" {
+			values, err := stringList(key, i)
+			if err != nil {
+				return err
+			}
+			weekdays := make([]time.Weekday, 0, len(values))
+			for _, value := range values {
+				weekday, err := parseWeekday(value)
+				if err != nil {
+					return err
+				}
+				weekdays = append(weekdays, weekday)
+			}
+			sort.Slice(weekdays, func(a, b int) bool { return weekdays[a] < weekdays[b] })
+			wt.Weekdays = weekdays
+			continue
+		}
+		value, ok := stringValue(i)
+		if !ok {
+			return fmt.Errorf("the value of key \"%s\" could not be converted to string", key)
+		}
+		switch key {
+		case "trigger_type":
+			if value != "window" {
+				return fmt.Errorf("trigger type \"%s\" is not valid (must be \"window\")", value)
+			}
+		case "from", "to":
+			hour, minute, err := parseTimeOfDay(value)
+			if err != nil {
+				return err
+			}
+			if key == "from" {
+				wt.From, has_from = hour*60+minute, true
+			} else {
+				wt.To, has_to = hour*60+minute, true
+			}
+		case "count":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return fmt.Errorf("count must be a positive whole number")
+			}
+			wt.Count = count
+		case "min_spacing":
+			spacing, err := time.ParseDuration(value)
+			if err != nil || spacing < 0 {
+				return fmt.Errorf("min_spacing \"%s\" is not a duration like \"45m\"", value)
+			}
+			if spacing < time.Minute {
+				spacing = time.Minute
+			}
+			wt.MinSpacing = spacing
+		default:
+			return fmt.Errorf("the key \"%s\" is not a valid key", key)
+		}
+	}
+	if !has_from || !has_to {
+		return fmt.Errorf("window triggers must have a from and a to time")
+	}
+	if wt.To <= wt.From {
+		return fmt.Errorf("window \"to\" time must be after \"from\" time")
+	}
+	spacing := int(wt.MinSpacing / time.Minute)
+	if (wt.Count-1)*spacing >= wt.To-wt.From {
+		return fmt.Errorf("%d runs at least %s apart do not fit between %02d:%02d and %02d:%02d",
+			wt.Count, describeDuration(wt.MinSpacing), wt.From/60, wt.From%60, wt.To/60, wt.To%60)
+	}
+	return nil
+}
+
+// Returns the minutes of the day, counted from midnight and in increasing
+// order, at which the WindowTrigger runs on day, which must be at midnight
+// UTC. On days of the week that the trigger does not run on, nil is returned.
+func (wt *WindowTrigger) Minutes(day time.Time) []int {
+	if !wt.runsOn(day.Weekday()) {
+		return nil
+	}
+	if wt.cacheMinutes != nil && wt.cacheDay.Equal(day) {
+		return wt.cacheMinutes
+	}
+
+	// Picking count sorted values from a range that is shortened by the total
+	// spacing, and then spreading them back out, gives evenly distributed
+	// minutes that are always at least the spacing apart.
+	spacing := int(wt.MinSpacing / time.Minute)
+	if spacing < 1 {
+		spacing = 1
+	}
+	span := wt.To - wt.From - (wt.Count-1)*spacing
+	generator := rand.New(rand.NewSource(wt.seed(day)))
+	minutes := make([]int, 0, wt.Count)
+	for i := 0; i < wt.Count; i++ {
+		minutes = append(minutes, generator.Intn(span))
+	}
+	sort.Ints(minutes)
+	for i := range minutes {
+		minutes[i] = wt.From + minutes[i] + i*spacing
+	}
+
+	wt.cacheDay, wt.cacheMinutes = day, minutes
+	return minutes
+}
+
+// Tells the caller whether the WindowTrigger runs on weekday.
+func (wt *WindowTrigger) runsOn(weekday time.Weekday) bool {
+	if len(wt.Weekdays) == 0 {
+		return true
+	}
+	for _, allowed := range wt.Weekdays {
+		if allowed == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the random seed for day, made by hashing the reminder ID, the date
+// and the window so that different reminders and windows pick different
+// minutes.
+func (wt *WindowTrigger) seed(day time.Time) int64 {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s\x00%s\x00%d-%d-%d-%d", wt.ReminderID, day.Format("2006-01-02"),
+		wt.From, wt.To, wt.Count, wt.MinSpacing/time.Minute)
+	return int64(hash.Sum64())
+}
@@ -0,0 +1,152 @@
+package reminder
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWindowConfig = `
+- version: v2
+  id: water
+  message: drink some water
+  timezone: America/Vancouver
+  triggers:
+    - trigger_type: window
+      from: "10:00"
+      to: "16:00"
+      weekdays: [monday, tuesday, wednesday, thursday, friday]
+      count: 3
+      min_spacing: 1h
+`
+
+func windowTrigger(t *testing.T, config string) (ReminderV2, *WindowTrigger) {
+	reminder_list, err := ParseConfig([]byte(config), "yaml")
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	wt, ok := reminder_list[0].Triggers[0].(*WindowTrigger)
+	if !ok {
+		t.Fatalf("trigger is a %T (*WindowTrigger expected)", reminder_list[0].Triggers[0])
+	}
+	return reminder_list[0], wt
+}
+
+func TestWindowTrigger(t *testing.T) {
+	r, wt := windowTrigger(t, testWindowConfig)
+	if wt.ReminderID != "water" {
+		t.Fatalf("got reminder ID \"%s\" (\"water\" expected)", wt.ReminderID)
+	}
+
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for day := start; day.Before(start.AddDate(0, 0, 60)); day = day.AddDate(0, 0, 1) {
+		minutes := wt.Minutes(day)
+		if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			if len(minutes) != 0 {
+				t.Errorf("got minutes %v on %s (none expected)", minutes, day.Weekday())
+			}
+			continue
+		}
+		if len(minutes) != 3 {
+			t.Fatalf("got %d minutes on %s (3 expected)", len(minutes), day.Format("2006-01-02"))
+		}
+		for i, minute := range minutes {
+			if minute < 10*60 || minute >= 16*60 {
+				t.Errorf("minute %d on %s is outside of the window", minute, day.Format("2006-01-02"))
+			}
+			if i > 0 && minute-minutes[i-1] < 60 {
+				t.Errorf("minutes %v on %s are less than an hour apart", minutes, day.Format("2006-01-02"))
+			}
+		}
+	}
+
+	// the picks are the same every time the config is loaded
+	_, reloaded := windowTrigger(t, testWindowConfig)
+	if !equalInts(wt.Minutes(start), reloaded.Minutes(start)) {
+		t.Errorf("got minutes %v after reloading (%v expected)", reloaded.Minutes(start), wt.Minutes(start))
+	}
+
+	// next predicts the first pick of the day, in the reminder's time zone
+	vancouver, _ := time.LoadLocation("America/Vancouver")
+	first := wt.Minutes(start)[0]
+	expected := time.Date(2021, time.March, 1, first/60, first%60, 0, 0, vancouver)
+	next_run, ok := r.NextRun(time.Date(2021, time.March, 1, 0, 0, 0, 0, vancouver))
+	if !ok || !next_run.Equal(expected) {
+		t.Errorf("got next run %s (%s expected)", next_run, expected)
+	}
+	if !r.ShouldRun(expected) || r.ShouldRun(expected.Add(time.Minute)) {
+		t.Errorf("ShouldRun does not agree with Minutes at %s", expected)
+	}
+
+	description := "3 times at random between 10:00 and 16:00, at least 1 hour apart, on Monday, Tuesday, Wednesday, Thursday and Friday"
+	if r.Describe() != description {
+		t.Errorf("got description \"%s\" (\"%s\" expected)", r.Describe(), description)
+	}
+}
+
+func TestWindowTriggerSeed(t *testing.T) {
+	// different reminders pick different minutes
+	a := &WindowTrigger{From: 0, To: 24 * 60, Count: 1, MinSpacing: time.Minute, ReminderID: "a"}
+	b := &WindowTrigger{From: 0, To: 24 * 60, Count: 1, MinSpacing: time.Minute, ReminderID: "b"}
+	same := 0
+	start := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	for day := start; day.Before(start.AddDate(0, 0, 30)); day = day.AddDate(0, 0, 1) {
+		if equalInts(a.Minutes(day), b.Minutes(day)) {
+			same++
+		}
+	}
+	if same > 2 {
+		t.Errorf("reminders a and b picked the same minute on %d of 30 days", same)
+	}
+}
+
+func TestWindowTriggerFileID(t *testing.T) {
+	// reminders without an ID are seeded with the ID they are given on loading
+	dir := writeConfigDir(t, map[string]string{
+		"habits.json": `[{"version": "v2", "triggers": [{"trigger_type": "window", "from": "10:00", "to": "11:00"}]}]`,
+	})
+	defer os.RemoveAll(dir)
+	reminder_list, err := Load(dir)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	wt := reminder_list[0].Triggers[0].(*WindowTrigger)
+	if wt.ReminderID != reminder_list[0].ID || !strings.HasPrefix(wt.ReminderID, "habits.json#") {
+		t.Errorf("got reminder ID \"%s\" (\"%s\" expected)", wt.ReminderID, reminder_list[0].ID)
+	}
+	if !reminder_list[0].UsesID() {
+		t.Errorf("a reminder with a window trigger doesn't use its ID")
+	}
+}
+
+func TestWindowTriggerAbnormal(t *testing.T) {
+	test_cases := []string{
+		`{"trigger_type": "window", "from": "10:00"}`,
+		`{"trigger_type": "window", "to": "16:00"}`,
+		`{"trigger_type": "window", "from": "16:00", "to": "10:00"}`,
+		`{"trigger_type": "window", "from": "10:00", "to": "16:00", "count": 0}`,
+		`{"trigger_type": "window", "from": "10:00", "to": "16:00", "weekdays": ["someday"]}`,
+		`{"trigger_type": "window", "from": "10:00", "to": "16:00", "min_spacing": "often"}`,
+		`{"trigger_type": "window", "from": "10:00", "to": "11:00", "count": 3, "min_spacing": "30m"}`,
+		`{"trigger_type": "window", "from": "10:00", "to": "16:00", "time": "12:00"}`,
+	}
+	for _, trigger := range test_cases {
+		config := `[{"version": "v2", "triggers": [` + trigger + `]}]`
+		if _, err := ParseConfig([]byte(config), "json"); err == nil {
+			t.Errorf("no error when there should have been with trigger %s", trigger)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
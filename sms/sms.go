@@ -0,0 +1,270 @@
+// Package sms works out how text is encoded when it is sent as SMS messages,
+// how many segments it takes, and how to make it fit in a given number of
+// segments. Carriers bill for each segment, so a long message, or a short one
+// with a single character that GSM-7 can't encode, can cost several times as
+// much as expected.
+package sms
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// An Encoding is the character encoding that an SMS message is sent in.
+type Encoding int
+
+const (
+	// GSM7 is the GSM 03.38 7-bit alphabet. A segment holds 160 characters,
+	// or 153 when the message takes more than one.
+	GSM7 Encoding = iota
+	// UCS2 is used when any character is outside the GSM 03.38 alphabet. A
+	// segment holds 70 UTF-16 code units, or 67 when the message takes more
+	// than one.
+	UCS2
+)
+
+// The things that can be done with a message that takes more segments than
+// it is allowed.
+const (
+	OverflowTruncate = "truncate"
+	OverflowSplit    = "split"
+	OverflowReject   = "reject"
+)
+
+// The characters of the GSM 03.38 basic character set, apart from the
+// escape to the extension table.
+const gsmBasic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// The characters of the GSM 03.38 extension table, each of which takes two
+// septets.
+const gsmExtension = "\f^{}\\[~]|€"
+
+// The text that ends a truncated message. It is in the GSM 03.38 alphabet,
+// so it doesn't change the encoding.
+const ellipsis = "..."
+
+// Returns the name of the Encoding, for example "GSM-7".
+func (e Encoding) String() string {
+	switch e {
+	case GSM7:
+		return "GSM-7"
+	case UCS2:
+		return "UCS-2"
+	default:
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+}
+
+// Returns the number of units (septets or UTF-16 code units) that fit in a
+// segment of a message in e, depending on whether the message takes a single
+// segment.
+func (e Encoding) segmentSize(single bool) int {
+	switch {
+	case e == GSM7 && single:
+		return 160
+	case e == GSM7:
+		return 153
+	case single:
+		return 70
+	default:
+		return 67
+	}
+}
+
+// Returns the Encoding that text is sent in.
+func EncodingOf(text string) Encoding {
+	for _, r := range text {
+		if !strings.ContainsRune(gsmBasic, r) && !strings.ContainsRune(gsmExtension, r) {
+			return UCS2
+		}
+	}
+	return GSM7
+}
+
+// Returns the number of units that r takes in encoding.
+func units(r rune, encoding Encoding) int {
+	if encoding == GSM7 {
+		if strings.ContainsRune(gsmExtension, r) {
+			return 2
+		}
+		return 1
+	}
+	return len(utf16.Encode([]rune{r}))
+}
+
+// Returns the number of characters in text, as the recipient's phone counts
+// them: septets for GSM-7 and UTF-16 code units for UCS-2.
+func Length(text string) int {
+	encoding := EncodingOf(text)
+	length := 0
+	for _, r := range text {
+		length = length + units(r, encoding)
+	}
+	return length
+}
+
+// Returns the number of segments that text is sent as. A character is never
+// split across two segments, so this can be more than the length divided by
+// the segment size. Empty text takes a single segment.
+func Segments(text string) int {
+	encoding := EncodingOf(text)
+	if Length(text) <= encoding.segmentSize(true) {
+		return 1
+	}
+	size := encoding.segmentSize(false)
+	segments, used := 1, 0
+	for _, r := range text {
+		n := units(r, encoding)
+		if used+n > size {
+			segments, used = segments+1, 0
+		}
+		used = used + n
+	}
+	return segments
+}
+
+// Returns the longest prefix of the runes of text whose ending, formed by
+// ending(prefix), fits in max_segments segments. The prefix is found by
+// binary search, which works because a longer prefix never takes fewer
+// segments.
+func longestFit(text []rune, max_segments int, ending func(prefix []rune) string) int {
+	low, high := 0, len(text)
+	for low < high {
+		middle := (low + high + 1) / 2
+		if Segments(ending(text[:middle])) <= max_segments {
+			low = middle
+		} else {
+			high = middle - 1
+		}
+	}
+	return low
+}
+
+// Returns text cut short and ended with "..." so that it fits in
+// max_segments segments, at a space if there is one near the end. Text that
+// already fits is returned unchanged.
+func Truncate(text string, max_segments int) string {
+	if Segments(text) <= max_segments {
+		return text
+	}
+	ending := func(prefix []rune) string {
+		return strings.TrimRight(string(prefix), " \n") + ellipsis
+	}
+	runes := []rune(text)
+	end := longestFit(runes, max_segments, ending)
+	if end < len(runes) {
+		if space := lastSpace(runes[:end]); space > end*3/4 {
+			end = space
+		}
+	}
+	return ending(runes[:end])
+}
+
+// Splits text into numbered messages of a single segment each, like
+// "(1/3) ...". Parts are broken at a space where there is one in the second
+// half of a part. If more than max_parts parts would be needed, the last one
+// is cut short and ended with "...". Text that fits in a single segment is
+// returned as it is.
+func Split(text string, max_parts int) []string {
+	if Segments(text) == 1 {
+		return []string{text}
+	}
+	if max_parts < 2 {
+		return []string{Truncate(text, 1)}
+	}
+	total := 2
+	chunks := splitChunks(text, numbering(total, total), total)
+	for ; total < max_parts && len(chunks) == total && chunks[total-1].truncated; total++ {
+		chunks = splitChunks(text, numbering(total+1, total+1), total+1)
+	}
+	parts := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		parts = append(parts, numbering(i+1, len(chunks))+chunk.text)
+	}
+	return parts
+}
+
+// Returns the numbering that starts part i of total, for example "(1/3) ".
+func numbering(i int, total int) string {
+	return fmt.Sprintf("(%d/%d) ", i, total)
+}
+
+// A chunk is the text of one part of a split message. If truncated is true,
+// it was cut short because there were too many parts.
+type chunk struct {
+	text      string
+	truncated bool
+}
+
+// Cuts text into at most max_chunks chunks that each fit in a single segment
+// after prefix, which is at least as long as any of the numberings that the
+// chunks are given. If that isn't enough, the last chunk is cut short and
+// ended with "...".
+func splitChunks(text string, prefix string, max_chunks int) []chunk {
+	chunks := make([]chunk, 0, max_chunks)
+	runes := []rune(strings.TrimSpace(text))
+	for len(runes) > 0 {
+		last := len(chunks) == max_chunks-1
+		ending := func(part []rune) string {
+			return prefix + string(part)
+		}
+		if last && Segments(ending(runes)) > 1 {
+			ending = func(part []rune) string {
+				return prefix + strings.TrimRight(string(part), " \n") + ellipsis
+			}
+		}
+		end := longestFit(runes, 1, ending)
+		if end < len(runes) {
+			if space := lastSpace(runes[:end]); space > end/2 {
+				end = space
+			}
+		}
+		if last && end < len(runes) {
+			return append(chunks, chunk{text: strings.TrimSpace(string(runes[:end])) + ellipsis, truncated: true})
+		}
+		if end == 0 {
+			// the prefix alone fills the segment
+			return append(chunks, chunk{text: string(runes)})
+		}
+		chunks = append(chunks, chunk{text: strings.TrimSpace(string(runes[:end]))})
+		runes = []rune(strings.TrimLeft(string(runes[end:]), " \n"))
+	}
+	return chunks
+}
+
+// Returns the index of the last space in runes, or -1 if there is none.
+func lastSpace(runes []rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == ' ' || runes[i] == '\n' {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the messages that text is sent as when it may take at most
+// max_segments segments. With OverflowSplit, text that takes more than one
+// segment is always split into numbered messages of one segment each, at most
+// max_segments of them; see Split. Otherwise, text that takes more than
+// max_segments is cut short with OverflowTruncate, and is an error with
+// OverflowReject.
+func Fit(text string, max_segments int, overflow string) ([]string, error) {
+	if overflow == OverflowSplit {
+		return Split(text, max_segments), nil
+	}
+	segments := Segments(text)
+	if segments <= max_segments {
+		return []string{text}, nil
+	}
+	switch overflow {
+	case OverflowTruncate:
+		return []string{Truncate(text, max_segments)}, nil
+	case OverflowReject:
+		return nil, fmt.Errorf("message takes %d %s segments, more than the %d allowed", segments,
+			EncodingOf(text), max_segments)
+	default:
+		return nil, fmt.Errorf("unknown overflow \"%s\"", overflow)
+	}
+}
@@ -0,0 +1,126 @@
+package sms
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSegments(t *testing.T) {
+	test_cases := []struct {
+		text     string
+		encoding Encoding
+		length   int
+		segments int
+	}{
+		{"", GSM7, 0, 1},
+		{"Take your pills.", GSM7, 16, 1},
+		{strings.Repeat("a", 160), GSM7, 160, 1},
+		{strings.Repeat("a", 161), GSM7, 161, 2},
+		{strings.Repeat("a", 306), GSM7, 306, 2},
+		{strings.Repeat("a", 307), GSM7, 307, 3},
+		// characters from the extension table take two septets
+		{strings.Repeat("€", 80), GSM7, 160, 1},
+		{strings.Repeat("€", 81), GSM7, 162, 2},
+		// and are never split across segments
+		{strings.Repeat("a", 152) + "{" + strings.Repeat("a", 7), GSM7, 161, 2},
+		{strings.Repeat("a", 152) + "{" + strings.Repeat("a", 152), GSM7, 306, 3},
+		{"Café Ñoño à 10:00", GSM7, 17, 1},
+		// a single character outside GSM-7 makes the whole message UCS-2
+		{"Café Ñandú", UCS2, 10, 1},
+		{"Take your pills 💊", UCS2, 18, 1},
+		{strings.Repeat("a", 69) + "ç", UCS2, 70, 1},
+		{strings.Repeat("a", 70) + "ç", UCS2, 71, 2},
+		{strings.Repeat("a", 66) + "💊" + "aaaa", UCS2, 72, 2},
+		{strings.Repeat("a", 66) + "💊" + strings.Repeat("a", 66), UCS2, 134, 3},
+	}
+	for _, test_case := range test_cases {
+		encoding, length, segments := EncodingOf(test_case.text), Length(test_case.text), Segments(test_case.text)
+		if encoding != test_case.encoding || length != test_case.length || segments != test_case.segments {
+			t.Errorf("text \"%s\" is %s, %d long and takes %d segments (%s, %d and %d expected)", test_case.text,
+				encoding, length, segments, test_case.encoding, test_case.length, test_case.segments)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	short := "Water the plants."
+	if truncated := Truncate(short, 1); truncated != short {
+		t.Errorf("got \"%s\" for text that fits", truncated)
+	}
+
+	long := strings.Repeat("word ", 40)
+	truncated := Truncate(long, 1)
+	if Segments(truncated) != 1 || !strings.HasSuffix(truncated, "word...") || len(truncated) > 160 {
+		t.Errorf("got \"%s\"", truncated)
+	}
+	if truncated = Truncate(long, 2); truncated != long {
+		t.Errorf("got \"%s\" for text that fits in 2 segments", truncated)
+	}
+
+	emoji := strings.Repeat("💊", 40)
+	truncated = Truncate(emoji, 1)
+	if Segments(truncated) != 1 || truncated != strings.Repeat("💊", 33)+"..." {
+		t.Errorf("got \"%s\"", truncated)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 8)
+	parts := Split(text, 5)
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts (3 expected): %v", len(parts), parts)
+	}
+	words := make([]string, 0)
+	for i, part := range parts {
+		if Segments(part) != 1 {
+			t.Errorf("part %d takes %d segments", i+1, Segments(part))
+		}
+		prefix := "(" + string(rune('1'+i)) + "/3) "
+		if !strings.HasPrefix(part, prefix) {
+			t.Errorf("part %d is \"%s\"", i+1, part)
+		}
+		words = append(words, strings.Fields(strings.TrimPrefix(part, prefix))...)
+	}
+	// parts are broken between words
+	if strings.Join(words, " ") != strings.TrimSpace(text) {
+		t.Errorf("parts %v don't add up to the text", parts)
+	}
+
+	if parts := Split("Short.", 3); len(parts) != 1 || parts[0] != "Short." {
+		t.Errorf("got parts %v for text that fits", parts)
+	}
+	// the last part is cut short if there would be too many
+	parts = Split(text, 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "(2/2) ") || !strings.HasSuffix(parts[1], " over...") ||
+		Segments(parts[1]) != 1 {
+		t.Errorf("got parts %v", parts)
+	}
+}
+
+func TestFit(t *testing.T) {
+	long := strings.Repeat("a", 200)
+	test_cases := []struct {
+		overflow     string
+		max_segments int
+		parts        int
+		is_error     bool
+	}{
+		{OverflowTruncate, 2, 1, false},
+		{OverflowTruncate, 1, 1, false},
+		{OverflowReject, 2, 1, false},
+		{OverflowReject, 1, 0, true},
+		// text that takes more than one segment is always split
+		{OverflowSplit, 2, 2, false},
+		{OverflowSplit, 3, 2, false},
+	}
+	for _, test_case := range test_cases {
+		parts, err := Fit(long, test_case.max_segments, test_case.overflow)
+		if len(parts) != test_case.parts || (err != nil) != test_case.is_error {
+			t.Errorf("%s with %d segments: got %d parts and error %v", test_case.overflow,
+				test_case.max_segments, len(parts), err)
+		}
+	}
+	if parts, _ := Fit(long, 2, OverflowTruncate); parts[0] != long {
+		t.Errorf("got \"%s\" for text that fits", parts[0])
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+
+	"github.com/adamkpickering/reminder-boi/reminder"
+)
+
+// The subject of the emails that topics send to their email subscribers.
+const topic_subject = "text-me-when reminder"
+
+// sns_options are the settings that the AWS SNS client is made with. Each may
+// be empty, in which case the AWS SDK's usual environment variables and
+// shared config files are used.
+type sns_options struct {
+	profile      string
+	region       string
+	endpoint_url string
+}
+
+// Returns an AWS SNS client, and the name of the provider that its
+// credentials came from. Credentials come from the AWS SDK's default chain:
+// the environment, the shared credentials and config files, a web identity
+// token, or the instance or container role. If options.profile is set, that
+// profile of the shared files is used first. An error is returned if no region
+// or no credentials can be found.
+func new_sns_client(options sns_options) (*sns.SNS, string, error) {
+	cfg := aws.NewConfig()
+	if options.region != "" {
+		cfg = cfg.WithRegion(options.region)
+	}
+	if options.endpoint_url != "" {
+		cfg = cfg.WithEndpoint(options.endpoint_url)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		Profile:           options.profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create AWS session: %w", err)
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		return nil, "", fmt.Errorf("no AWS region was found; give one with -region, AWS_REGION, " +
+			"AWS_DEFAULT_REGION or the profile")
+	}
+	creds, err := sess.Config.Credentials.Get()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find AWS credentials: %w", err)
+	}
+	return sns.New(sess), creds.ProviderName, nil
+}
+
+// Sends a message via AWS SNS to recipient, which is either a phone number in
+// E.164 format or the ARN of an SNS topic. attributes are sent as string
+// message attributes, such as "AWS.SNS.SMS.SMSType", and may be nil. Returns
+// the ID that SNS gave the message.
+func send_message(sns_client *sns.SNS, message string, recipient string, attributes map[string]string) (string, error) {
+	pi := &sns.PublishInput{}
+	if reminder.IsTopicArn(recipient) {
+		structured, err := topic_message(message)
+		if err != nil {
+			return "", err
+		}
+		pi.TopicArn = &recipient
+		pi.Message = &structured
+		pi.MessageStructure = aws.String("json")
+		pi.Subject = aws.String(topic_subject)
+	} else {
+		pi.PhoneNumber = &recipient
+		pi.Message = &message
+	}
+	if len(attributes) > 0 {
+		pi.MessageAttributes = message_attributes(attributes)
+	}
+	if err := pi.Validate(); err != nil {
+		return "", fmt.Errorf("pi.Validate: %w", err)
+	}
+	po, err := sns_client.Publish(pi)
+	if err != nil {
+		return "", fmt.Errorf("sns_client.Publish: %w", err)
+	}
+	return aws.StringValue(po.MessageId), nil
+}
+
+// Returns the JSON message structure that message is published to a topic
+// with, which gives the message for each protocol that the topic's
+// subscribers may use. Subscribers over protocols that aren't given, such as
+// SQS, get the "default" message.
+func topic_message(message string) (string, error) {
+	structure := map[string]string{
+		"default": message,
+		"sms":     message,
+		"email":   message,
+	}
+	encoded, err := json.Marshal(structure)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode message for topic: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// Checks that every topic in recipients is in region, since an SNS client
+// can only publish to topics in its own region.
+func check_topic_regions(recipients []string, region string) error {
+	for _, recipient := range recipients {
+		if !reminder.IsTopicArn(recipient) {
+			continue
+		}
+		topic, err := reminder.ParseTopicArn(recipient)
+		if err != nil {
+			return err
+		}
+		if topic.Region != region {
+			return fmt.Errorf("SNS topic %s is in region %s, but messages are sent from region %s", recipient,
+				topic.Region, region)
+		}
+	}
+	return nil
+}
+
+// Returns the channel that messages to recipient go through: "sns_topic" for
+// SNS topics and "sms" for phone numbers.
+func channel_of(recipient string) string {
+	if reminder.IsTopicArn(recipient) {
+		return "sns_topic"
+	}
+	return "sms"
+}
+
+// The SMS attributes that SNS takes as numbers rather than strings.
+var number_attributes = map[string]bool{"AWS.SNS.SMS.MaxPrice": true}
+
+// Converts attributes into SNS message attributes, which are strings unless
+// SNS defines them as numbers.
+func message_attributes(attributes map[string]string) map[string]*sns.MessageAttributeValue {
+	values := map[string]*sns.MessageAttributeValue{}
+	for name, value := range attributes {
+		data_type := "String"
+		if number_attributes[name] {
+			data_type = "Number"
+		}
+		values[name] = &sns.MessageAttributeValue{
+			DataType:    aws.String(data_type),
+			StringValue: aws.String(value),
+		}
+	}
+	return values
+}
+
+// sns_sender is a delivery.Sender that sends messages via AWS SNS, to phone
+// numbers or topics.
+type sns_sender struct {
+	sns_client *sns.SNS
+}
+
+// Sends message to recipient via AWS SNS, returning the ID that SNS gave it.
+func (s sns_sender) Send(message string, recipient string, attributes map[string]string) (string, error) {
+	return send_message(s.sns_client, message, recipient, attributes)
+}
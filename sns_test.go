@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// The environment variables that the AWS SDK reads credentials, regions and
+// profiles from. Tests clear them, so that the environment they are run in
+// doesn't matter.
+var aws_env_keys = []string{
+	"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION",
+	"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_SHARED_CREDENTIALS_FILE", "AWS_CONFIG_FILE",
+	"AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_EC2_METADATA_DISABLED",
+}
+
+// Clears the AWS environment variables, sets those in env, and returns a
+// function that restores them. Shared files that env doesn't point elsewhere
+// are pointed at files that don't exist, and the instance metadata service is
+// disabled.
+func with_aws_env(t *testing.T, env map[string]string) func() {
+	t.Helper()
+	saved := map[string]string{}
+	for _, key := range aws_env_keys {
+		if value, ok := os.LookupEnv(key); ok {
+			saved[key] = value
+		}
+		os.Unsetenv(key)
+	}
+	defaults := map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(os.TempDir(), "text-me-when-no-credentials"),
+		"AWS_CONFIG_FILE":             filepath.Join(os.TempDir(), "text-me-when-no-config"),
+		"AWS_EC2_METADATA_DISABLED":   "true",
+	}
+	for key, value := range defaults {
+		os.Setenv(key, value)
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+	}
+	return func() {
+		for _, key := range aws_env_keys {
+			os.Unsetenv(key)
+		}
+		for key, value := range saved {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+// fake_sns is an HTTP server that answers AWS SNS Publish requests. It
+// records the form of each request, and the Authorization header of the last
+// one. Messages to phone numbers in reject are answered with an error.
+type fake_sns struct {
+	server        *httptest.Server
+	requests      []url.Values
+	authorization string
+	reject        map[string]bool
+}
+
+func new_fake_sns() *fake_sns {
+	f := &fake_sns{reject: map[string]bool{}}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.requests = append(f.requests, r.PostForm)
+		f.authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "text/xml")
+		if f.reject[r.PostForm.Get("PhoneNumber")] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>InvalidParameter</Code>` +
+				`<Message>Invalid parameter: PhoneNumber</Message></Error><RequestId>2</RequestId></ErrorResponse>`))
+			return
+		}
+		w.Write([]byte(`<PublishResponse xmlns="http://sns.amazonaws.com/doc/2010-03-31/"><PublishResult>` +
+			`<MessageId>1</MessageId></PublishResult><ResponseMetadata><RequestId>1</RequestId>` +
+			`</ResponseMetadata></PublishResponse>`))
+	}))
+	return f
+}
+
+func TestSendMessage(t *testing.T) {
+	defer with_aws_env(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIDENV",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_REGION":            "us-west-2",
+	})()
+	fake := new_fake_sns()
+	defer fake.server.Close()
+
+	sns_client, provider, err := new_sns_client(sns_options{endpoint_url: fake.server.URL})
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if provider != "EnvConfigCredentials" {
+		t.Errorf("got credentials from %s", provider)
+	}
+	attributes := map[string]string{"AWS.SNS.SMS.SMSType": "Transactional"}
+	message_id, err := send_message(sns_client, "Take your pills.", "+15555550123", attributes)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if message_id != "1" {
+		t.Errorf("got message ID \"%s\" (\"1\" expected)", message_id)
+	}
+	if len(fake.requests) != 1 {
+		t.Fatalf("got %d requests (1 expected)", len(fake.requests))
+	}
+	expected := map[string]string{
+		"Action":                         "Publish",
+		"Message":                        "Take your pills.",
+		"PhoneNumber":                    "+15555550123",
+		"MessageAttributes.entry.1.Name": "AWS.SNS.SMS.SMSType",
+		"MessageAttributes.entry.1.Value.DataType":    "String",
+		"MessageAttributes.entry.1.Value.StringValue": "Transactional",
+	}
+	for key, value := range expected {
+		if fake.requests[0].Get(key) != value {
+			t.Errorf("got %s \"%s\" (\"%s\" expected)", key, fake.requests[0].Get(key), value)
+		}
+	}
+	if !strings.Contains(fake.authorization, "Credential=AKIDENV/") ||
+		!strings.Contains(fake.authorization, "/us-west-2/sns/") {
+		t.Errorf("got authorization \"%s\"", fake.authorization)
+	}
+
+	// messages without attributes have none
+	if _, err := send_message(sns_client, "Water the plants.", "+15555550123", nil); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	for key := range fake.requests[1] {
+		if strings.HasPrefix(key, "MessageAttributes") {
+			t.Errorf("got attribute %s", key)
+		}
+	}
+
+	fake.reject["+15555550124"] = true
+	_, err = sns_sender{sns_client}.Send("Take your pills.", "+15555550124", nil)
+	if err == nil || !strings.Contains(err.Error(), "InvalidParameter") {
+		t.Errorf("got error %v for a rejected message", err)
+	}
+}
+
+func TestMessageAttributes(t *testing.T) {
+	attributes := map[string]string{
+		"AWS.SNS.SMS.SMSType":  "Transactional",
+		"AWS.SNS.SMS.SenderID": "MyClinic",
+		"AWS.SNS.SMS.MaxPrice": "0.50",
+	}
+	expected := map[string]string{
+		"AWS.SNS.SMS.SMSType":  "String",
+		"AWS.SNS.SMS.SenderID": "String",
+		"AWS.SNS.SMS.MaxPrice": "Number",
+	}
+	values := message_attributes(attributes)
+	if len(values) != len(expected) {
+		t.Fatalf("got %d attributes (%d expected)", len(values), len(expected))
+	}
+	for name, data_type := range expected {
+		value := values[name]
+		if value == nil || aws.StringValue(value.DataType) != data_type ||
+			aws.StringValue(value.StringValue) != attributes[name] {
+			t.Errorf("got attribute %s %v (data type %s expected)", name, value, data_type)
+		}
+	}
+}
+
+func TestSNSProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "text-me-when-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	credentials_path := filepath.Join(dir, "credentials")
+	config_path := filepath.Join(dir, "config")
+	credentials := "[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = secret\n" +
+		"[reminders]\naws_access_key_id = AKIDPROFILE\naws_secret_access_key = secret\n"
+	config := "[default]\nregion = us-east-1\n[profile reminders]\nregion = eu-west-1\n"
+	if err := ioutil.WriteFile(credentials_path, []byte(credentials), 0600); err != nil {
+		t.Fatalf("failed to write credentials: %s", err)
+	}
+	if err := ioutil.WriteFile(config_path, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+	defer with_aws_env(t, map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE": credentials_path,
+		"AWS_CONFIG_FILE":             config_path,
+	})()
+	fake := new_fake_sns()
+	defer fake.server.Close()
+
+	test_cases := []struct {
+		options sns_options
+		key_id  string
+		region  string
+	}{
+		{sns_options{}, "AKIDDEFAULT", "us-east-1"},
+		{sns_options{profile: "reminders"}, "AKIDPROFILE", "eu-west-1"},
+		{sns_options{profile: "reminders", region: "ca-central-1"}, "AKIDPROFILE", "ca-central-1"},
+	}
+	for _, test_case := range test_cases {
+		test_case.options.endpoint_url = fake.server.URL
+		sns_client, provider, err := new_sns_client(test_case.options)
+		if err != nil {
+			t.Errorf("got unexpected error with %v: %s", test_case.options, err)
+			continue
+		}
+		if !strings.HasPrefix(provider, "SharedConfigCredentials") {
+			t.Errorf("got credentials from %s with %v", provider, test_case.options)
+		}
+		if _, err := send_message(sns_client, "Take your pills.", "+15555550123", nil); err != nil {
+			t.Errorf("got unexpected error with %v: %s", test_case.options, err)
+			continue
+		}
+		if !strings.Contains(fake.authorization, "Credential="+test_case.key_id+"/") ||
+			!strings.Contains(fake.authorization, "/"+test_case.region+"/sns/") {
+			t.Errorf("got authorization \"%s\" with %v", fake.authorization, test_case.options)
+		}
+	}
+
+	if _, _, err := new_sns_client(sns_options{profile: "missing"}); err == nil {
+		t.Error("no error for a profile that doesn't exist")
+	}
+}
+
+func TestSNSMissingSettings(t *testing.T) {
+	defer with_aws_env(t, map[string]string{"AWS_REGION": "us-west-2"})()
+	if _, _, err := new_sns_client(sns_options{}); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("got error %v without credentials", err)
+	}
+
+	defer with_aws_env(t, map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "secret"})()
+	if _, _, err := new_sns_client(sns_options{}); err == nil || !strings.Contains(err.Error(), "region") {
+		t.Errorf("got error %v without a region", err)
+	}
+	if _, _, err := new_sns_client(sns_options{region: "us-west-2"}); err != nil {
+		t.Errorf("got unexpected error with a region: %s", err)
+	}
+}
+
+func TestSendToTopic(t *testing.T) {
+	defer with_aws_env(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIDENV",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_REGION":            "us-west-2",
+	})()
+	fake := new_fake_sns()
+	defer fake.server.Close()
+	sns_client, _, err := new_sns_client(sns_options{endpoint_url: fake.server.URL})
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+
+	topic := "arn:aws:sns:us-west-2:123456789012:reminders"
+	attributes := map[string]string{"AWS.SNS.SMS.SMSType": "Transactional"}
+	if _, err := send_message(sns_client, "Stand-up in 5 minutes.", topic, attributes); err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	form := fake.requests[0]
+	if form.Get("TopicArn") != topic || form.Get("PhoneNumber") != "" || form.Get("MessageStructure") != "json" ||
+		form.Get("Subject") != topic_subject || form.Get("MessageAttributes.entry.1.Name") != "AWS.SNS.SMS.SMSType" {
+		t.Errorf("got request %v", form)
+	}
+	structure := map[string]string{}
+	if err := json.Unmarshal([]byte(form.Get("Message")), &structure); err != nil {
+		t.Fatalf("message is not JSON: %s", err)
+	}
+	for _, protocol := range []string{"default", "sms", "email"} {
+		if structure[protocol] != "Stand-up in 5 minutes." {
+			t.Errorf("got message %v for protocol %s", structure, protocol)
+		}
+	}
+}
+
+func TestCheckTopicRegions(t *testing.T) {
+	recipients := []string{"+15555550123", "arn:aws:sns:us-west-2:123456789012:reminders"}
+	if err := check_topic_regions(recipients, "us-west-2"); err != nil {
+		t.Errorf("got unexpected error: %s", err)
+	}
+	if err := check_topic_regions(recipients, "eu-west-1"); err == nil {
+		t.Error("no error for a topic in another region")
+	}
+}
@@ -0,0 +1,255 @@
+// Package state keeps the information that text-me-when needs to remember
+// across restarts, such as how many times each reminder has been sent. It is
+// stored as a JSON file that is rewritten whenever it changes.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReminderState is what is remembered about a single reminder.
+type ReminderState struct {
+	Count    int       `json:"count"`
+	LastSent time.Time `json:"last_sent"`
+}
+
+// DeferredMessage is a message that was held back because it was sent during
+// its recipient's quiet hours. It is sent once Until has passed. Parts are the
+// numbered SMS messages that Body was split into, if it was, and Attributes
+// are the attributes that it is sent with. FireTime is when the reminder fired.
+// Attempts is the number of times that sending it has failed since Until
+// passed; it is deferred again after each failure. HistoryID is the ID of its
+// record in the history, which is updated when it is sent.
+type DeferredMessage struct {
+	ReminderID string            `json:"reminder_id"`
+	Recipient  string            `json:"recipient"`
+	Body       string            `json:"body"`
+	Parts      []string          `json:"parts,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	FireTime   time.Time         `json:"fire_time"`
+	Until      time.Time         `json:"until"`
+	Attempts   int               `json:"attempts,omitempty"`
+	HistoryID  string            `json:"history_id,omitempty"`
+}
+
+// Spend counts the messages that have been sent in the current day and
+// calendar month, for enforcing budgets. Day and Month are in the forms
+// "2021-03-04" and "2021-03".
+type Spend struct {
+	Day        string `json:"day"`
+	DayCount   int    `json:"day_count"`
+	Month      string `json:"month"`
+	MonthCount int    `json:"month_count"`
+}
+
+// State is the persistent state of text-me-when. Reminders are keyed by ID,
+// so reminders should be given explicit IDs if their state is to survive
+// changes to the config. It is safe for concurrent use.
+type State struct {
+	mutex     sync.Mutex
+	path      string
+	Reminders map[string]*ReminderState `json:"reminders"`
+	Deferred  []DeferredMessage         `json:"deferred,omitempty"`
+	Spend     Spend                     `json:"spend"`
+	// Suppressed counts the messages that were not sent because the budget
+	// ran out, by recipient and then by reminder ID, until they are summarized.
+	Suppressed map[string]map[string]int `json:"suppressed,omitempty"`
+}
+
+// Reads the state file at path. If the file does not exist, an empty State
+// is returned; it is created the first time the State is saved.
+func Load(path string) (*State, error) {
+	s := &State{path: path, Reminders: map[string]*ReminderState{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if s.Reminders == nil {
+		s.Reminders = map[string]*ReminderState{}
+	}
+	return s, nil
+}
+
+// Returns the number of times the reminder with the given ID has been sent.
+func (s *State) Count(id string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if reminder_state, ok := s.Reminders[id]; ok {
+		return reminder_state.Count
+	}
+	return 0
+}
+
+// Records that the reminder with the given ID was sent at sent_time, and
+// saves the State.
+func (s *State) RecordSend(id string, sent_time time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	reminder_state, ok := s.Reminders[id]
+	if !ok {
+		reminder_state = &ReminderState{}
+		s.Reminders[id] = reminder_state
+	}
+	reminder_state.Count = reminder_state.Count + 1
+	reminder_state.LastSent = sent_time
+	return s.save()
+}
+
+// Adds message to the deferred messages and saves the State. A message that
+// is already deferred for the same reminder and recipient is replaced, so that
+// a reminder that fires again and again during quiet hours is only sent once
+// when they end.
+func (s *State) Defer(message DeferredMessage) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, existing := range s.Deferred {
+		if existing.ReminderID == message.ReminderID && existing.Recipient == message.Recipient {
+			s.Deferred[i] = message
+			return s.save()
+		}
+	}
+	s.Deferred = append(s.Deferred, message)
+	return s.save()
+}
+
+// Removes the deferred messages whose Until is not after now and returns
+// them in the order they were deferred. The State is saved if any were
+// removed.
+func (s *State) TakeDue(now time.Time) ([]DeferredMessage, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	due := make([]DeferredMessage, 0)
+	kept := make([]DeferredMessage, 0, len(s.Deferred))
+	for _, message := range s.Deferred {
+		if message.Until.After(now) {
+			kept = append(kept, message)
+		} else {
+			due = append(due, message)
+		}
+	}
+	if len(due) == 0 {
+		return due, nil
+	}
+	s.Deferred = kept
+	return due, s.save()
+}
+
+// Returns the number of messages that have been sent on the day and in the
+// month of now, in now's time zone.
+func (s *State) Spent(now time.Time) (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	day, month := 0, 0
+	if s.Spend.Day == now.Format("2006-01-02") {
+		day = s.Spend.DayCount
+	}
+	if s.Spend.Month == now.Format("2006-01") {
+		month = s.Spend.MonthCount
+	}
+	return day, month
+}
+
+// Records that count messages were sent at now, and saves the State.
+func (s *State) RecordSpend(now time.Time, count int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	day, month := now.Format("2006-01-02"), now.Format("2006-01")
+	if s.Spend.Day != day {
+		s.Spend.Day, s.Spend.DayCount = day, 0
+	}
+	if s.Spend.Month != month {
+		s.Spend.Month, s.Spend.MonthCount = month, 0
+	}
+	s.Spend.DayCount = s.Spend.DayCount + count
+	s.Spend.MonthCount = s.Spend.MonthCount + count
+	return s.save()
+}
+
+// Records that a message from the reminder with the given ID to recipient was
+// not sent because the budget ran out, and saves the State.
+func (s *State) Suppress(recipient string, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Suppressed == nil {
+		s.Suppressed = map[string]map[string]int{}
+	}
+	if s.Suppressed[recipient] == nil {
+		s.Suppressed[recipient] = map[string]int{}
+	}
+	s.Suppressed[recipient][id] = s.Suppressed[recipient][id] + 1
+	return s.save()
+}
+
+// Returns the recipients that have suppressed messages, in no particular
+// order.
+func (s *State) SuppressedRecipients() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	recipients := make([]string, 0, len(s.Suppressed))
+	for recipient := range s.Suppressed {
+		recipients = append(recipients, recipient)
+	}
+	return recipients
+}
+
+// Removes the counts of suppressed messages to recipient and returns them,
+// keyed by reminder ID. The State is saved if there were any.
+func (s *State) TakeSuppressed(recipient string) (map[string]int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	counts, ok := s.Suppressed[recipient]
+	if !ok {
+		return map[string]int{}, nil
+	}
+	delete(s.Suppressed, recipient)
+	return counts, s.save()
+}
+
+// Adds counts, keyed by reminder ID, back to the counts of suppressed messages
+// to recipient, for when their summary could not be sent, and saves the State.
+func (s *State) RestoreSuppressed(recipient string, counts map[string]int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Suppressed == nil {
+		s.Suppressed = map[string]map[string]int{}
+	}
+	if s.Suppressed[recipient] == nil {
+		s.Suppressed[recipient] = map[string]int{}
+	}
+	for id, count := range counts {
+		s.Suppressed[recipient][id] = s.Suppressed[recipient][id] + count
+	}
+	return s.save()
+}
+
+// Writes the State to its file. The file is replaced atomically so that a
+// crash cannot leave it half-written. The caller must hold s.mutex.
+func (s *State) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp_path := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp_path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp_path, s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	return nil
+}
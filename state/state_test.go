@@ -0,0 +1,57 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "text-me-when-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "state.json")
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("got unexpected error loading missing state file: %s", err)
+	}
+	if s.Count("pills") != 0 {
+		t.Errorf("got count %d for new state (0 expected)", s.Count("pills"))
+	}
+	sent_time := time.Date(2021, time.March, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := s.RecordSend("pills", sent_time); err != nil {
+			t.Fatalf("got unexpected error: %s", err)
+		}
+	}
+
+	s, err = Load(path)
+	if err != nil {
+		t.Fatalf("got unexpected error: %s", err)
+	}
+	if s.Count("pills") != 3 || s.Count("other") != 0 {
+		t.Errorf("got counts %d and %d after reload (3 and 0 expected)", s.Count("pills"), s.Count("other"))
+	}
+	if !s.Reminders["pills"].LastSent.Equal(sent_time) {
+		t.Errorf("got last sent time %s (%s expected)", s.Reminders["pills"].LastSent, sent_time)
+	}
+}
+
+func TestLoadCorruptState(t *testing.T) {
+	file, err := ioutil.TempFile("", "text-me-when-state")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %s", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("{not json")
+	file.Close()
+
+	if _, err := Load(file.Name()); err == nil {
+		t.Error("no error for corrupt state file")
+	}
+}
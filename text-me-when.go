@@ -1,142 +1,475 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"net"
+	"net/http"
 	"os"
-	"regexp"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sns"
 
+	"github.com/adamkpickering/reminder-boi/delivery"
+	"github.com/adamkpickering/reminder-boi/history"
+	"github.com/adamkpickering/reminder-boi/logging"
 	"github.com/adamkpickering/reminder-boi/reminder"
+	"github.com/adamkpickering/reminder-boi/state"
 )
 
-// Sends an SMS message to a phone number via AWS SNS. The phone number must be in E.164 format.
-func send_message(sns_client *sns.SNS, message string, phone_number string) error {
-	pi := &sns.PublishInput{
-		Message:     &message,
-		PhoneNumber: &phone_number,
+// logger writes the log records of the main loop. Its options are set from
+// the command line.
+var logger = logging.New(os.Stdout, logging.Options{Level: logging.Info, Format: logging.Logfmt})
+
+// Logs what happened to a message that was given to the deliverer, and the
+// alert that came with it, if any. keyvals are extra fields, such as the
+// trigger that fired the reminder and how long delivery took.
+func log_result(result delivery.Result, keyvals ...interface{}) {
+	message := result.Message
+	if result.Alert != "" {
+		logger.Warn("alert", "alert", result.Alert)
+	}
+	fields := []interface{}{
+		"reminder_id", message.ReminderID,
+		"recipient", message.Recipient,
+		"channel", channel_of(message.Recipient),
+		"outcome", result.Outcome,
 	}
-	if err := pi.Validate(); err != nil {
-		return fmt.Errorf("pi.Validate: %w", err)
+	fields = append(fields, keyvals...)
+	switch result.Outcome {
+	case delivery.Sent:
+		fields = append(fields, "parts", len(message.Parts), "body", message.Body)
+		if result.Reason != "" {
+			logger.Warn("sent reminder", append(fields, "error", result.Reason)...)
+		} else {
+			logger.Info("sent reminder", fields...)
+		}
+	case delivery.Failed:
+		logger.Error("failed to send reminder", append(fields, "error", result.Reason)...)
+	default:
+		logger.Info(result.Outcome.String()+" reminder", append(fields, "reason", result.Reason)...)
 	}
-	_, err := sns_client.Publish(pi)
+}
+
+// Returns the number of milliseconds in d, for latency fields.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Sends the deferred messages whose recipients' quiet hours have ended, and
+// records them in mon and hist. Only messages that failed before count as retries.
+func flush_deferred(eval_time time.Time, deliverer *delivery.Deliverer, mon *monitor, hist *history_recorder) {
+	results, err := deliverer.Flush(eval_time)
 	if err != nil {
-		return fmt.Errorf("sns_client.Publish: %w", err)
+		logger.Error("failed to flush deferred messages", "error", err)
+	}
+	for _, result := range results {
+		log_result(result, "deferred", true)
+		mon.record_result(result, result.Attempts > 0)
+		hist.record(result, eval_time)
 	}
-	return nil
+}
+
+// A due_reminder is a reminder whose triggers say it should be sent at an
+// eval_time. fields are logged with every record about it, after its ID. holds
+// and detail are the result of checking its condition, if it has one, and
+// message and err are the result of building its message if the condition
+// holds.
+type due_reminder struct {
+	reminder reminder.ReminderV2
+	fields   []interface{}
+	holds    bool
+	detail   string
+	message  string
+	err      error
+}
+
+// Returns the fields of a log record about the due reminder, followed by keyvals.
+func (d *due_reminder) log_fields(keyvals ...interface{}) []interface{} {
+	return append(append([]interface{}{"reminder_id", d.reminder.ID}, d.fields...), keyvals...)
+}
+
+// Checks the conditions of the due reminders and builds the messages of those
+// whose conditions hold, concurrently, so that however many of them run a slow
+// command, they take no longer than the slowest one.
+func prepare_reminders(due []*due_reminder, eval_time time.Time) {
+	var wg sync.WaitGroup
+	for _, d := range due {
+		wg.Add(1)
+		go func(d *due_reminder) {
+			defer wg.Done()
+			d.holds = true
+			if d.reminder.Condition != nil {
+				d.holds, d.detail = d.reminder.Condition.Evaluate(eval_time)
+			}
+			if d.holds {
+				d.message, d.err = d.reminder.BuildMessage(eval_time)
+			}
+		}(d)
+	}
+	wg.Wait()
 }
 
 // Iterates through reminders and fires the ones that should be fired at the eval_time.
-func fire_reminders(eval_time time.Time, phone_number string, sns_client *sns.SNS,
-	reminder_list []reminder.ReminderV1) {
+// Each reminder is sent to its own recipients, or to default_recipients if it has none.
+// Reminders that have been sent their max_count times are not sent again, and
+// reminders with a condition are only sent if it holds. A reminder's message
+// command is run once per send, and its fallback is used if it fails. The
+// conditions and message commands of the reminders that are due are run
+// concurrently. Messages
+// that take more SMS segments than the reminder allows are truncated, split or
+// not sent, depending on its settings. Messages go through deliverer, which
+// applies the recipients' quiet hours; a reminder whose message is deferred
+// counts as sent. What happens to each message is logged along with the
+// trigger that fired the reminder and how long delivery took, and recorded in
+// mon and hist.
+func fire_reminders(eval_time time.Time, default_recipients []string, deliverer *delivery.Deliverer,
+	reminder_list []reminder.ReminderV2, st *state.State, mon *monitor, hist *history_recorder) {
+	due := make([]*due_reminder, 0)
 	for _, reminder := range reminder_list {
-		if reminder.ShouldRun(eval_time) {
-			err := send_message(sns_client, reminder.Message, phone_number)
-			if err != nil {
-				log.Printf("send_message failed: %s", err)
+		decision := reminder.Check(eval_time)
+		if !decision.Fire {
+			continue
+		}
+		d := &due_reminder{reminder: reminder, fields: []interface{}{"trigger", decision.Trigger.TriggerType()}}
+		if expired, reason := reminder.Expired(eval_time, st.Count(reminder.ID)); expired {
+			logger.Info("not sending reminder", d.log_fields("reason", reason)...)
+			continue
+		}
+		due = append(due, d)
+	}
+	prepare_reminders(due, eval_time)
+	for _, d := range due {
+		reminder := d.reminder
+		if reminder.Condition != nil {
+			if !d.holds {
+				logger.Info("not sending reminder", d.log_fields("reason", "condition does not hold: "+d.detail)...)
 				continue
 			}
-			log.Printf("sent message \"%s\" to %s", reminder.Message, phone_number)
+			d.fields = append(d.fields, "condition", d.detail)
+		}
+		message, err := d.message, d.err
+		if err != nil {
+			if message == "" {
+				logger.Error("not sending reminder", d.log_fields("reason", "message command failed",
+					"error", err)...)
+				continue
+			}
+			logger.Warn("message command failed, sending fallback", d.log_fields("error", err)...)
+		}
+		parts, err := reminder.FitMessage(message)
+		if err != nil {
+			logger.Warn("not sending reminder", d.log_fields("error", err, "body", message)...)
+			continue
+		}
+		body := parts[0]
+		if len(parts) > 1 {
+			body = message
+		} else {
+			parts = nil
+		}
+		var attributes map[string]string
+		if reminder.SMS != nil {
+			attributes = reminder.SMS.Attributes()
+		}
+		mon.fires.Inc(reminder.ID)
+		sent := false
+		for _, phone_number := range reminder.RecipientsOr(default_recipients) {
+			start := time.Now()
+			result := deliverer.Deliver(delivery.Message{
+				ReminderID: reminder.ID,
+				Recipient:  phone_number,
+				Body:       body,
+				Parts:      parts,
+				Attributes: attributes,
+				Urgent:     reminder.Urgent,
+				FireTime:   eval_time,
+				HistoryID:  history.NewID(),
+			}, eval_time)
+			log_result(result, append(d.fields, "latency_ms", milliseconds(time.Since(start)))...)
+			mon.record_result(result, false)
+			hist.record(result, eval_time)
+			if result.Outcome == delivery.Sent || result.Outcome == delivery.Deferred {
+				sent = true
+			}
+		}
+		if sent {
+			if err := st.RecordSend(reminder.ID, eval_time); err != nil {
+				logger.Error("failed to record send", d.log_fields("error", err)...)
+			}
+		}
+	}
+}
+
+// Returns every phone number and topic that the reminders are sent to, without duplicates.
+func all_recipients(reminder_list []reminder.ReminderV2, default_recipients []string) []string {
+	seen := map[string]bool{}
+	recipients := make([]string, 0)
+	for _, r := range reminder_list {
+		for _, phone_number := range r.RecipientsOr(default_recipients) {
+			if !seen[phone_number] {
+				seen[phone_number] = true
+				recipients = append(recipients, phone_number)
+			}
 		}
 	}
+	return recipients
 }
 
 func main() {
-	// set up logging
-	log.SetOutput(os.Stdout)
+	// dispatch to commands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "describe":
+			os.Exit(run_describe(os.Args[2:]))
+		case "history":
+			os.Exit(run_history(os.Args[2:]))
+		case "migrate":
+			os.Exit(run_migrate(os.Args[2:]))
+		case "next":
+			os.Exit(run_next(os.Args[2:]))
+		case "validate":
+			os.Exit(run_validate(os.Args[2:]))
+		}
+	}
 
 	// parse CLI flags
 	flag.Usage = func() {
-		usage_header := "Usage: %s [OPTIONS] PHONE_NUMBER\n" +
+		usage_header := "Usage: %s [OPTIONS] [PHONE_NUMBER]\n" +
+			"       %s describe [OPTIONS]\n" +
+			"       %s history [OPTIONS]\n" +
+			"       %s migrate [OPTIONS]\n" +
+			"       %s next [OPTIONS]\n" +
+			"       %s validate [OPTIONS]\n" +
 			"\n" +
-			"  Checks once a minute for reminders whose messages should be sent out.\n" +
+			"  Checks once a minute (or once a second, if any reminder uses seconds) for\n" +
+			"  reminders whose messages should be sent out.\n" +
 			"  PHONE_NUMBER is the phone number, in E.164 format, that you want the messages\n" +
-			"  to be sent to.\n" +
+			"  to be sent to, or the ARN of an SNS topic to publish them to. It may be left\n" +
+			"  out if every reminder has its own recipients.\n" +
 			"\n" +
-			"  The environment variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and\n" +
-			"  AWS_DEFAULT_REGION are required to send text messages via AWS SNS. For more\n" +
-			"  information on what these mean please see the AWS documentation.\n" +
+			"  Text messages are sent via AWS SNS. AWS credentials are found the way the\n" +
+			"  AWS CLI finds them: from the environment, the shared credentials and config\n" +
+			"  files (using the profile given by -profile or AWS_PROFILE), a web identity\n" +
+			"  token, or the instance or container role. The region is given by -region,\n" +
+			"  AWS_REGION, AWS_DEFAULT_REGION or the profile. For more information please\n" +
+			"  see the AWS documentation.\n" +
+			"\n" +
+			"  Logs are written to standard output as logfmt or JSON records, one per\n" +
+			"  line. Phone numbers in them are masked. With -listen, metrics are served\n" +
+			"  at /metrics in the Prometheus text format, and /healthz reports whether\n" +
+			"  the scheduler is still ticking.\n" +
+			"\n" +
+			"  The describe command prints an English description of when each reminder\n" +
+			"  is sent. The history command prints what happened to each message, and\n" +
+			"  acknowledges sent ones. The migrate command rewrites the config to the\n" +
+			"  latest schema version. The next command prints the next times at which each\n" +
+			"  reminder will be sent. The validate command checks the config, prints the\n" +
+			"  number of SMS segments that each message takes, and warns if the reminders\n" +
+			"  are projected to send more messages than the budget allows.\n" +
 			"\n" +
 			"Options:\n"
-		fmt.Fprintf(flag.CommandLine.Output(), usage_header, os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), usage_header, os.Args[0], os.Args[0], os.Args[0], os.Args[0],
+			os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
-	reminders_path := flag.String("c", "/etc/text-me-when.json", "The path to the reminders config")
-	send_test := flag.Bool("t", false, "Send a test SMS to the configured phone number before entering main loop")
+	reminders_path := flag.String("c", "/etc/text-me-when.json", "The path to the reminders config file or directory")
+	state_path := flag.String("s", "/var/lib/text-me-when/state.json", "The path to the state file")
+	history_path := flag.String("history", "/var/lib/text-me-when/history.jsonl",
+		"The path to the history file of sent messages; if empty, no history is kept")
+	history_retention_days := flag.Int("history-retention-days", 0,
+		"Drop history records fired more than this many days ago; 0 keeps them forever")
+	tags := flag.String("tags", "", "Only serve reminders that have at least one of these comma-separated tags")
+	send_test := flag.Bool("t", false, "Send a test SMS to every recipient before entering main loop")
+	profile := flag.String("profile", "", "The AWS profile to use from the shared credentials and config files")
+	region := flag.String("region", "", "The AWS region to send text messages from")
+	endpoint_url := flag.String("endpoint-url", "", "The URL of the AWS SNS endpoint, if not the region's usual one")
+	log_level := flag.String("log-level", "info", "Only log records at this level or above: debug, info, warn or error")
+	log_format := flag.String("log-format", logging.Logfmt, "The format of log records: logfmt or json")
+	listen := flag.String("listen", "", "The address, such as :9090, to serve /metrics and /healthz on over HTTP")
+	stale_after := flag.Duration("stale-after", 0,
+		"How long after the scheduler's last tick /healthz reports unhealthy (default twice the tick interval plus 30s)")
+	redact_bodies := flag.Bool("redact-bodies", false, "Leave the bodies of messages out of log records")
 	flag.Parse()
 
-	// parse phone number
-	if flag.NArg() != 1 {
-		flag.Usage()
-		os.Exit(1)
-	}
-	phone_number := flag.Args()[0]
-	match, err := regexp.MatchString(`^\+[0-9]{11,15}$`, phone_number)
+	// set up logging
+	level, err := logging.ParseLevel(*log_level)
 	if err != nil {
-		fmt.Printf("There was a problem while validating phone number: %s\n", err)
+		fmt.Printf("%s\n", err)
 		os.Exit(1)
 	}
-	if !match {
-		fmt.Printf("%s is not a valid phone number. It must consist of a + followed by up to 15 digits.\n")
+	if err := logging.CheckFormat(*log_format); err != nil {
+		fmt.Printf("%s\n", err)
 		os.Exit(1)
 	}
+	logger.SetOptions(logging.Options{Level: level, Format: *log_format, RedactBodies: *redact_bodies})
 
-	// read environment variables
-	region_key := "AWS_DEFAULT_REGION"
-	region, ok := os.LookupEnv(region_key)
-	if !ok {
-		fmt.Printf("Could not find required env var %s.\n", region_key)
+	// parse phone number
+	if flag.NArg() > 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
+	default_recipients := flag.Args()
+	for _, recipient := range default_recipients {
+		if reminder.IsTopicArn(recipient) {
+			if _, err := reminder.ParseTopicArn(recipient); err != nil {
+				fmt.Printf("%s\n", err)
+				os.Exit(1)
+			}
+		} else if !reminder.IsPhoneNumber(recipient) {
+			fmt.Printf("%s is not a valid phone number. It must consist of a + followed by up to 15 digits.\n", recipient)
+			os.Exit(1)
+		}
+	}
 
 	// construct sns client
-	creds := credentials.NewEnvCredentials()
-	cfg := aws.NewConfig().WithCredentials(creds).WithRegion(region)
-	session := session.Must(session.NewSession(cfg))
-	sns_client := sns.New(session)
-	log.Print("constructed AWS SNS client")
-
-	// parse config file
-	raw_file, err := ioutil.ReadFile(*reminders_path)
+	sns_client, provider, err := new_sns_client(sns_options{
+		profile:      *profile,
+		region:       *region,
+		endpoint_url: *endpoint_url,
+	})
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	logger.Info("constructed AWS SNS client", "provider", provider, "region", aws.StringValue(sns_client.Config.Region))
+
+	// parse config and state files
+	config, err := load_config(*reminders_path)
 	if err != nil {
-		fmt.Printf("Failed to read config file: %s\n", err)
+		fmt.Printf("%s\n", err)
 		os.Exit(1)
 	}
-	reminder_list := make([]reminder.ReminderV1, 0)
-	err = json.Unmarshal(raw_file, &reminder_list)
+	reminder_list := config.Reminders
+	logger.Info("read reminder config", "path", *reminders_path, "reminders", len(reminder_list))
+	st, err := state.Load(*state_path)
 	if err != nil {
-		fmt.Printf("Failed to parse config file: %s\n", err)
+		fmt.Printf("%s\n", err)
+		os.Exit(1)
+	}
+	reminder_list = select_reminders(reminder_list, parse_tags(*tags))
+	warn_generated_ids(reminder_list)
+	reminder_list = drop_expired(reminder_list, st, time.Now())
+	for _, r := range reminder_list {
+		if len(r.RecipientsOr(default_recipients)) == 0 {
+			fmt.Printf("Reminder %s has no recipients and no PHONE_NUMBER was given.\n", r.ID)
+			os.Exit(1)
+		}
+		logger.Info("loaded reminder", "reminder_id", r.ID, "schedule", r.Describe(),
+			"recipient", r.RecipientsOr(default_recipients))
+	}
+	for _, recipient := range config.Recipients {
+		logger.Info("loaded recipient", "recipient", recipient.Address, "settings", recipient.Describe())
+	}
+	if config.Limits != nil {
+		logger.Info("loaded limits", "limits", config.Limits.Describe())
+	}
+	region_name := aws.StringValue(sns_client.Config.Region)
+	if err := check_topic_regions(all_recipients(reminder_list, default_recipients), region_name); err != nil {
+		fmt.Printf("%s\n", err)
 		os.Exit(1)
 	}
-	log.Printf("read in %d reminders from reminder config", len(reminder_list))
+	deliverer := delivery.New(sns_sender{sns_client}, config.Recipients, config.Limits, st)
 
 	// send test message if configured
 	if *send_test {
 		msg := "text-me-when: this is a test message. If you got this, " +
 			"you can be sure that message sending is working."
-		err := send_message(sns_client, msg, phone_number)
+		for _, phone_number := range all_recipients(reminder_list, default_recipients) {
+			message_id, err := send_message(sns_client, msg, phone_number, nil)
+			if err != nil {
+				fmt.Printf("There was a problem with sending test message: %s\n", err)
+				os.Exit(1)
+			}
+			logger.Info("sent test message", "recipient", phone_number, "channel", channel_of(phone_number),
+				"message_id", message_id)
+		}
+	}
+
+	// serve metrics and health checks if configured
+	mon := new_monitor(*stale_after)
+	if *listen != "" {
+		listener, err := net.Listen("tcp", *listen)
 		if err != nil {
-			fmt.Printf("There was a problem with sending test message: %s\n", err)
+			fmt.Printf("Failed to listen for metrics and health checks: %s\n", err)
 			os.Exit(1)
 		}
-		log.Printf("sent test message to %s", phone_number)
+		logger.Info("serving /metrics and /healthz", "address", listener.Addr().String())
+		go func() {
+			err := http.Serve(listener, mon.handler())
+			logger.Error("stopped serving /metrics and /healthz", "error", err)
+		}()
 	}
 
 	// main loop
-	var wait_time time.Duration = 60
-	log.Print("entering main loop")
-	ticker := time.NewTicker(wait_time * time.Second)
+	logger.Info("entering main loop")
+	hist := new_history_recorder(*history_path, *history_retention_days)
+	run_loop(default_recipients, deliverer, reminder_list, st, mon, hist)
+}
+
+// Checks the reminders forever, once a minute. If any reminder uses seconds,
+// the loop instead ticks once a second: reminders that use seconds are checked
+// at every second, and the others at the first second of every minute.
+// Deferred messages are sent once a minute, when their quiet hours have ended.
+// Each tick and check is recorded in mon, and what happens to each message in
+// hist, which is compacted once a day.
+func run_loop(default_recipients []string, deliverer *delivery.Deliverer, reminder_list []reminder.ReminderV2,
+	st *state.State, mon *monitor, hist *history_recorder) {
+	minute_reminders := make([]reminder.ReminderV2, 0, len(reminder_list))
+	second_reminders := make([]reminder.ReminderV2, 0)
+	for _, r := range reminder_list {
+		if r.UsesSeconds() {
+			second_reminders = append(second_reminders, r)
+		} else {
+			minute_reminders = append(minute_reminders, r)
+		}
+	}
+	mon.update_next_fires(reminder_list, st, time.Now())
+	hist.compact_daily(time.Now())
+
+	if len(second_reminders) == 0 {
+		var wait_time time.Duration = 60
+		ticker := time.NewTicker(wait_time * time.Second)
+		mon.set_tick_interval(wait_time * time.Second)
+		for {
+			received_time := <-ticker.C
+			mon.tick()
+			start := mon.start_check(received_time)
+			logger.Debug("checking reminders", "eval_time", received_time.Format(time.RFC3339))
+			hist.compact_daily(received_time)
+			flush_deferred(received_time, deliverer, mon, hist)
+			fire_reminders(received_time, default_recipients, deliverer, minute_reminders, st, mon, hist)
+			mon.update_next_fires(reminder_list, st, received_time)
+			mon.finish_check(start)
+		}
+	}
+
+	logger.Info("checking once a second", "reason", fmt.Sprintf("%d reminders use seconds", len(second_reminders)))
+	ticker := time.NewTicker(time.Second)
+	mon.set_tick_interval(time.Second)
+	last_time := time.Now().Truncate(time.Second)
 	for {
 		received_time := <-ticker.C
-		log.Print("checking reminders")
-		fire_reminders(received_time, phone_number, sns_client, reminder_list)
+		mon.tick()
+		now := received_time.Truncate(time.Second)
+		// check any seconds that were missed because ticks were dropped, but not
+		// more than a minute of them
+		if now.Sub(last_time) > time.Minute {
+			last_time = now.Add(-time.Minute)
+		}
+		for eval_time := last_time.Add(time.Second); !eval_time.After(now); eval_time = eval_time.Add(time.Second) {
+			start := mon.start_check(eval_time)
+			if eval_time.Second() == 0 {
+				logger.Debug("checking reminders", "eval_time", eval_time.Format(time.RFC3339))
+				hist.compact_daily(eval_time)
+				flush_deferred(eval_time, deliverer, mon, hist)
+				fire_reminders(eval_time, default_recipients, deliverer, minute_reminders, st, mon, hist)
+			}
+			fire_reminders(eval_time, default_recipients, deliverer, second_reminders, st, mon, hist)
+			mon.finish_check(start)
+		}
+		mon.update_next_fires(reminder_list, st, now)
+		last_time = now
 	}
 }
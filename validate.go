@@ -0,0 +1,295 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adamkpickering/reminder-boi/reminder"
+	"github.com/adamkpickering/reminder-boi/sms"
+)
+
+// The number of days ahead that the validate command projects the number of
+// messages for.
+const projection_days = 30
+
+// projection is the number of messages that the reminders are projected to
+// send over the next projection_days days, in total and by local day, and the
+// total number of SMS segments that they take. by_month is the number of
+// messages by local calendar month, through the end of the next one, so that
+// a whole month is always projected.
+type projection struct {
+	total    int
+	segments int
+	by_day   map[string]int
+	by_month map[string]int
+	// by_day_and_reminder and by_month_and_reminder are keyed by day or month
+	// and then by reminder ID.
+	by_day_and_reminder   map[string]map[string]int
+	by_month_and_reminder map[string]map[string]int
+}
+
+// measurement is how a reminder's message is sent as SMS messages: the
+// number of messages and segments that each send takes, and a description
+// such as "2 UCS-2 segments (90 characters), truncated to 1". If the message
+// is rejected for taking too many segments, err says so.
+type measurement struct {
+	messages    int
+	segments    int
+	description string
+	err         error
+}
+
+// Implements the validate command, which checks the config for errors and
+// warns about configs whose projected number of messages goes over the budget.
+func run_validate(args []string) int {
+	flag_set := flag.NewFlagSet("validate", flag.ExitOnError)
+	flag_set.Usage = func() {
+		usage_header := "Usage: %s validate [OPTIONS]\n" +
+			"\n" +
+			"  Checks the config for errors and projects how many messages the reminders\n" +
+			"  will send over the next 30 days, and in each calendar month until the end\n" +
+			"  of the next one, before quiet hours and rate limits. Prints a warning if a\n" +
+			"  day goes over the daily budget or a month over the monthly budget. Also\n" +
+			"  prints the number of SMS segments that each reminder's message takes.\n" +
+			"  Exits with status 1 if the config has errors.\n" +
+			"\n" +
+			"Options:\n"
+		fmt.Fprintf(flag_set.Output(), usage_header, os.Args[0])
+		flag_set.PrintDefaults()
+	}
+	reminders_path := flag_set.String("c", "/etc/text-me-when.json", "The path to the reminders config file or directory")
+	tags := flag_set.String("tags", "", "Only check reminders that have at least one of these comma-separated tags")
+	flag_set.Parse(args)
+	if flag_set.NArg() != 0 {
+		flag_set.Usage()
+		return 1
+	}
+
+	config, err := load_config(*reminders_path)
+	if err != nil {
+		fmt.Printf("%s\n", err)
+		return 1
+	}
+	tag_list := parse_tags(*tags)
+	reminder_list := make([]reminder.ReminderV2, 0, len(config.Reminders))
+	for _, r := range config.Reminders {
+		if r.Enabled && r.HasAnyTag(tag_list) {
+			reminder_list = append(reminder_list, r)
+		}
+	}
+	fmt.Printf("config is valid: %s, %s with settings\n", reminder.CountOf(len(reminder_list), "reminder"),
+		reminder.CountOf(len(config.Recipients), "recipient"))
+	phone_numbers, topics := split_recipients(all_recipients(reminder_list, nil))
+	fmt.Printf("recipients: %s, %s\n", reminder.CountOf(len(phone_numbers), "phone number"),
+		reminder.CountOf(len(topics), "SNS topic"))
+
+	now := time.Now()
+	measurements := map[string]measurement{}
+	warnings := topic_warnings(topics)
+	if len(reminder_list) > 0 {
+		fmt.Printf("segments:\n")
+	}
+	for _, r := range reminder_list {
+		m := measure(r, now)
+		measurements[r.ID] = m
+		fmt.Printf("  %s: %s\n", r.ID, m.description)
+		if m.err != nil {
+			warnings = append(warnings, fmt.Sprintf("reminder %s is never sent: %s", r.ID, m.err))
+		}
+	}
+
+	p := project(reminder_list, measurements, now)
+	fmt.Printf("projected volume: up to %d messages a day, %d in the next %d days (%s)\n",
+		p.by_day[busiest(p.by_day)], p.total, projection_days, reminder.CountOf(p.segments, "segment"))
+	warnings = append(warnings, budget_warnings(p, config.Limits)...)
+	for _, warning := range warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+	return 0
+}
+
+// Splits recipients into phone numbers and SNS topic ARNs.
+func split_recipients(recipients []string) ([]string, []string) {
+	phone_numbers := make([]string, 0, len(recipients))
+	topics := make([]string, 0)
+	for _, recipient := range recipients {
+		if reminder.IsTopicArn(recipient) {
+			topics = append(topics, recipient)
+		} else {
+			phone_numbers = append(phone_numbers, recipient)
+		}
+	}
+	return phone_numbers, topics
+}
+
+// Returns a warning if topics, which are SNS topic ARNs that have already been
+// checked, are in more than one region, since messages are only sent from
+// one.
+func topic_warnings(topics []string) []string {
+	regions := make([]string, 0)
+	seen := map[string]bool{}
+	for _, arn := range topics {
+		topic, err := reminder.ParseTopicArn(arn)
+		if err != nil || seen[topic.Region] {
+			continue
+		}
+		seen[topic.Region] = true
+		regions = append(regions, topic.Region)
+	}
+	if len(regions) < 2 {
+		return []string{}
+	}
+	sort.Strings(regions)
+	return []string{fmt.Sprintf("SNS topics are in several regions (%s), but messages can only be sent "+
+		"to topics in the region that text-me-when is run with", strings.Join(regions, ", "))}
+}
+
+// Measures the message that r would send at now. A message that is set by a
+// message command can't be measured, and is counted as a single segment.
+func measure(r reminder.ReminderV2, now time.Time) measurement {
+	if r.MessageCommand != nil {
+		return measurement{messages: 1, segments: 1, description: "set by its message command"}
+	}
+	message := r.RenderMessage(now)
+	segments := sms.Segments(message)
+	encoding := sms.EncodingOf(message).String()
+	m := measurement{description: fmt.Sprintf("%s (%s)", reminder.CountOf(segments, encoding+" segment"),
+		reminder.CountOf(sms.Length(message), "character"))}
+	parts, err := r.FitMessage(message)
+	if err != nil {
+		m.err = err
+		m.description = m.description + ", rejected"
+		return m
+	}
+	m.messages = len(parts)
+	for _, part := range parts {
+		m.segments = m.segments + sms.Segments(part)
+	}
+	if len(parts) > 1 {
+		m.description = m.description + fmt.Sprintf(", split into %d messages", len(parts))
+	} else if m.segments < segments {
+		m.description = m.description + fmt.Sprintf(", truncated to %d", m.segments)
+	}
+	return m
+}
+
+// Projects the number of messages that reminder_list will send in the
+// projection_days days after now, and by month until the end of the next
+// calendar month. Each occurrence counts once for each of a reminder's
+// recipients, and reminders without recipients count as having one, times the
+// number of messages in its measurement.
+func project(reminder_list []reminder.ReminderV2, measurements map[string]measurement, now time.Time) *projection {
+	p := &projection{
+		by_day:                map[string]int{},
+		by_month:              map[string]int{},
+		by_day_and_reminder:   map[string]map[string]int{},
+		by_month_and_reminder: map[string]map[string]int{},
+	}
+	end := now.AddDate(0, 0, projection_days)
+	local_now := now.In(time.Local)
+	months_end := time.Date(local_now.Year(), local_now.Month()+2, 1, 0, 0, 0, 0, time.Local)
+	if months_end.Before(end) {
+		months_end = end
+	}
+	for _, r := range reminder_list {
+		recipients := len(r.Recipients)
+		if recipients == 0 {
+			recipients = 1
+		}
+		m := measurements[r.ID]
+		messages := recipients * m.messages
+		for _, occurrence := range r.OccurrencesUntil(now, months_end, math.MaxInt32) {
+			if occurrence.Skipped {
+				continue
+			}
+			month := occurrence.Time.In(time.Local).Format("2006-01")
+			p.by_month[month] = p.by_month[month] + messages
+			if p.by_month_and_reminder[month] == nil {
+				p.by_month_and_reminder[month] = map[string]int{}
+			}
+			p.by_month_and_reminder[month][r.ID] = p.by_month_and_reminder[month][r.ID] + messages
+			if !occurrence.Time.Before(end) {
+				continue
+			}
+			day := occurrence.Time.In(time.Local).Format("2006-01-02")
+			p.total = p.total + messages
+			p.segments = p.segments + recipients*m.segments
+			p.by_day[day] = p.by_day[day] + messages
+			if p.by_day_and_reminder[day] == nil {
+				p.by_day_and_reminder[day] = map[string]int{}
+			}
+			p.by_day_and_reminder[day][r.ID] = p.by_day_and_reminder[day][r.ID] + messages
+		}
+	}
+	return p
+}
+
+// Returns the key of counts with the highest count, where keys are days or
+// months. Ties go to the earliest.
+func busiest(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	busiest := ""
+	for _, key := range keys {
+		if busiest == "" || counts[key] > counts[busiest] {
+			busiest = key
+		}
+	}
+	return busiest
+}
+
+// Returns warnings for the budgets in limits that the projection goes over,
+// each naming the reminders that send the most messages.
+func budget_warnings(p *projection, limits *reminder.Limits) []string {
+	warnings := make([]string, 0)
+	if limits == nil {
+		return warnings
+	}
+	day := busiest(p.by_day)
+	if limits.DailyBudget > 0 && p.by_day[day] > limits.DailyBudget {
+		warnings = append(warnings, fmt.Sprintf(
+			"projected volume of %d messages on %s is over the daily budget of %d (%s)",
+			p.by_day[day], day, limits.DailyBudget, top_reminders(p.by_day_and_reminder[day])))
+	}
+	month := busiest(p.by_month)
+	if limits.MonthlyBudget > 0 && p.by_month[month] > limits.MonthlyBudget {
+		warnings = append(warnings, fmt.Sprintf(
+			"projected volume of %d messages in %s is over the monthly budget of %d (%s)",
+			p.by_month[month], month, limits.MonthlyBudget, top_reminders(p.by_month_and_reminder[month])))
+	}
+	return warnings
+}
+
+// Describes the three reminders with the most messages in counts, which is
+// keyed by reminder ID, for example "every-minute: 1440, standup: 1".
+func top_reminders(counts map[string]int) string {
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		if counts[ids[a]] != counts[ids[b]] {
+			return counts[ids[a]] > counts[ids[b]]
+		}
+		return ids[a] < ids[b]
+	})
+	description := ""
+	for i, id := range ids {
+		if i == 3 {
+			break
+		}
+		if i > 0 {
+			description = description + ", "
+		}
+		description = description + fmt.Sprintf("%s: %d", id, counts[id])
+	}
+	return description
+}